@@ -0,0 +1,422 @@
+package log4go
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+const (
+	alertGroupWindowDefault = time.Minute
+	alertRateLimitDefault   = 10
+	alertRateWindow         = time.Minute
+	alertSummaryIntervalMin = 10 * time.Millisecond
+)
+
+// alert writer webhook formats
+const (
+	AlertFormatSlack = "slack" // slack incoming webhook, default
+	AlertFormatTeams = "teams" // microsoft teams message card
+	AlertFormatJSON  = "json"  // the alert json object, or the template
+)
+
+// AlertWriterOptions alert writer options
+type AlertWriterOptions struct {
+	Enable   bool   `json:"enable" mapstructure:"enable"`
+	Level    string `json:"level" mapstructure:"level"` // default CRITICAL
+	URL      string `json:"url" mapstructure:"url"`
+	Format   string `json:"format" mapstructure:"format"`     // slack, teams or json, default slack
+	Template string `json:"template" mapstructure:"template"` // the json format body, text/template executed with the alert
+	Service  string `json:"service" mapstructure:"service"`   // default the program name
+
+	GroupWindow time.Duration `json:"group_window" mapstructure:"group_window"` // identical messages within the window are grouped, default 1m, -1 means no grouping
+	RateLimit   int           `json:"rate_limit" mapstructure:"rate_limit"`     // alerts per minute, default 10, -1 means unlimited
+
+	// every alert is one request, the batch options are ignored
+	HTTPBatchOptions `mapstructure:",squash"`
+}
+
+// alertData the alert passed to the template, use {{.Field "name"}} for the record fields
+// and {{json .Message}} for the quoted json string
+type alertData struct {
+	Service    string
+	Level      string
+	Message    string
+	Caller     string
+	Time       time.Time
+	Fields     Fields
+	Suppressed int    // the number of the suppressed alerts if the alert is a summary
+	Title      string // [LEVEL] service
+	Text       string // the message, caller and fields, or the summary
+}
+
+// Field return the field value as string, empty if not exist
+func (a *alertData) Field(name string) string {
+	v, ok := a.Fields[name]
+	if !ok || v == nil {
+		return ""
+	}
+	if err, ok := v.(error); ok {
+		return err.Error()
+	}
+	return fmt.Sprint(v)
+}
+
+// alertGroup the identical messages within the group window
+type alertGroup struct {
+	level  int
+	alert  *alertData
+	expire time.Time
+	count  int // the suppressed messages
+}
+
+// AlertWriter post the alerts to the webhook, the identical messages are grouped and the alerts are rate limited,
+// the suppressed alerts are sent as the summary
+type AlertWriter struct {
+	level      int
+	options    AlertWriterOptions
+	service    string
+	format     func(a *alertData) ([]byte, error)
+	template   *template.Template
+	window     time.Duration
+	rateLimit  int
+	rateWindow time.Duration
+	batcher    *httpBatcher
+
+	lock         sync.Mutex
+	groups       map[string]*alertGroup
+	sent         []time.Time // the send times within the rate window
+	limited      int         // the alerts suppressed by the rate limit
+	limitedLevel int         // the most severe level of the limited alerts
+	stop         chan struct{}
+	quit         chan struct{}
+
+	suppressed int64
+}
+
+// NewAlertWriter create new alert writer
+func NewAlertWriter(options AlertWriterOptions) *AlertWriter {
+	defaultLevel := CRITICAL
+	if len(options.Level) > 0 {
+		defaultLevel = getLevelDefault(options.Level, defaultLevel, "")
+	}
+	return &AlertWriter{
+		level:      defaultLevel,
+		options:    options,
+		rateWindow: alertRateWindow,
+	}
+}
+
+// Init check the options and start the batcher
+func (w *AlertWriter) Init() (err error) {
+	if w.options.URL == "" {
+		return errors.New("alert writer requires url")
+	}
+	switch w.options.Format {
+	case "", AlertFormatSlack:
+		w.format = w.formatSlack
+	case AlertFormatTeams:
+		w.format = w.formatTeams
+	case AlertFormatJSON:
+		w.format = w.formatJSON
+	default:
+		return fmt.Errorf("alert writer invalid format (%s)", w.options.Format)
+	}
+	if w.options.Template != "" {
+		if w.options.Format != AlertFormatJSON {
+			return fmt.Errorf("alert writer template requires json format (%s)", w.options.Format)
+		}
+		funcs := template.FuncMap{"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		}}
+		if w.template, err = template.New("alert").Funcs(funcs).Parse(w.options.Template); err != nil {
+			return fmt.Errorf("alert writer invalid template: %v", err)
+		}
+	}
+
+	w.service = w.options.Service
+	if w.service == "" {
+		w.service = filepath.Base(os.Args[0])
+	}
+	w.window = w.options.GroupWindow
+	if w.window == 0 {
+		w.window = alertGroupWindowDefault
+	}
+	w.rateLimit = w.options.RateLimit
+	if w.rateLimit == 0 {
+		w.rateLimit = alertRateLimitDefault
+	}
+
+	batch := w.options.HTTPBatchOptions
+	batch.BatchSize = 1
+	if w.batcher, err = newHTTPBatcher("alert writer", "POST", batch); err != nil {
+		return err
+	}
+	w.batcher.build = func(items [][]byte) (*httpPayload, error) {
+		return &httpPayload{url: w.options.URL, body: items[0], contentType: "application/json"}, nil
+	}
+	w.groups = make(map[string]*alertGroup)
+	w.stop = make(chan struct{})
+	w.quit = make(chan struct{})
+	w.batcher.start()
+	go w.daemonSummary()
+	return nil
+}
+
+// Write send the alert, or count it to the summary if grouped or rate limited
+func (w *AlertWriter) Write(r *Record) error {
+	if r.level > w.level {
+		return nil
+	}
+	if w.batcher == nil {
+		return errors.New("alert writer not running")
+	}
+	a := w.newAlert(r)
+	now := time.Now()
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.groups == nil {
+		return errors.New("alert writer not running")
+	}
+	if w.window > 0 {
+		key := a.Level + "\x00" + a.Message
+		if g := w.groups[key]; g != nil && now.Before(g.expire) {
+			g.count++
+			atomic.AddInt64(&w.suppressed, 1)
+			return nil
+		}
+		w.groups[key] = &alertGroup{level: r.level, alert: a, expire: now.Add(w.window)}
+	}
+	if !w.allow(now) {
+		w.limit(r.level, 1)
+		atomic.AddInt64(&w.suppressed, 1)
+		return nil
+	}
+	return w.send(a)
+}
+
+func (w *AlertWriter) newAlert(r *Record) *alertData {
+	a := &alertData{
+		Service: w.service,
+		Level:   LevelFlags[r.level],
+		Message: r.msg,
+		Caller:  r.file,
+		Time:    recordTime(r),
+		Title:   "[" + LevelFlags[r.level] + "] " + w.service,
+	}
+	var b strings.Builder
+	b.WriteString(r.msg)
+	if r.file != "" {
+		b.WriteString(" (" + r.file + ")")
+	}
+	if len(r.fields) > 0 {
+		// the record fields may be reused, copy them for the summary
+		a.Fields = make(Fields, len(r.fields))
+		for i, k := range r.fields.sortedKeys() {
+			a.Fields[k] = r.fields[k]
+			if i == 0 {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(' ')
+			}
+			b.WriteString(k + "=" + a.Field(k))
+		}
+	}
+	a.Text = b.String()
+	return a
+}
+
+// allow check the rate limit and take the slot, must hold the lock
+func (w *AlertWriter) allow(now time.Time) bool {
+	if w.rateLimit < 0 {
+		return true
+	}
+	i := 0
+	for i < len(w.sent) && !w.sent[i].After(now.Add(-w.rateWindow)) {
+		i++
+	}
+	w.sent = w.sent[i:]
+	if len(w.sent) >= w.rateLimit {
+		return false
+	}
+	w.sent = append(w.sent, now)
+	return true
+}
+
+// limit count the alerts suppressed by the rate limit, must hold the lock
+func (w *AlertWriter) limit(level, n int) {
+	if w.limited == 0 || level < w.limitedLevel {
+		w.limitedLevel = level
+	}
+	w.limited += n
+}
+
+// send format the alert and queue it, must hold the lock
+func (w *AlertWriter) send(a *alertData) error {
+	body, err := w.format(a)
+	if err != nil {
+		return err
+	}
+	return w.batcher.add(body)
+}
+
+// summary send the summaries of the expired groups and the rate limit, all of them if force, must hold the lock
+func (w *AlertWriter) summary(now time.Time, force bool) {
+	for key, g := range w.groups {
+		if !force && now.Before(g.expire) {
+			continue
+		}
+		delete(w.groups, key)
+		if g.count == 0 {
+			continue
+		}
+		if !force && !w.allow(now) {
+			w.limit(g.level, g.count)
+			continue
+		}
+		s := *g.alert
+		s.Time, s.Suppressed = now, g.count
+		s.Text = fmt.Sprintf("suppressed %d similar alerts in %v: %s", g.count, w.window, g.alert.Message)
+		if err := w.send(&s); err != nil {
+			log.Printf("[log4go] alert writer send summary err: %v", err.Error())
+		}
+	}
+
+	if w.limited == 0 || !force && !w.allow(now) {
+		return
+	}
+	s := &alertData{
+		Service:    w.service,
+		Level:      LevelFlags[w.limitedLevel],
+		Time:       now,
+		Suppressed: w.limited,
+		Title:      "[" + LevelFlags[w.limitedLevel] + "] " + w.service,
+		Text:       fmt.Sprintf("suppressed %d alerts over the rate limit of %d per %v", w.limited, w.rateLimit, w.rateWindow),
+	}
+	w.limited = 0
+	if err := w.send(s); err != nil {
+		log.Printf("[log4go] alert writer send summary err: %v", err.Error())
+	}
+}
+
+func (w *AlertWriter) daemonSummary() {
+	defer close(w.quit)
+	interval := time.Second
+	if w.window > 0 && w.window/2 < interval {
+		interval = w.window / 2
+	}
+	if interval < alertSummaryIntervalMin {
+		interval = alertSummaryIntervalMin
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			w.lock.Lock()
+			w.summary(now, false)
+			w.lock.Unlock()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *AlertWriter) formatSlack(a *alertData) ([]byte, error) {
+	return json.Marshal(map[string]string{"text": "*" + a.Title + "* " + a.Text})
+}
+
+func (w *AlertWriter) formatTeams(a *alertData) ([]byte, error) {
+	color := "FFA500"
+	switch a.Level {
+	case LevelFlagEmergency, LevelFlagAlert:
+		color = "8B0000"
+	case LevelFlagCritical:
+		color = "FF0000"
+	}
+	return json.Marshal(map[string]string{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"themeColor": color,
+		"summary":    a.Title,
+		"title":      a.Title,
+		"text":       strings.ReplaceAll(a.Text, "\n", "\n\n"), // the markdown line break
+	})
+}
+
+func (w *AlertWriter) formatJSON(a *alertData) ([]byte, error) {
+	if w.template == nil {
+		return json.Marshal(map[string]interface{}{
+			"service":    a.Service,
+			"level":      a.Level,
+			"message":    a.Message,
+			"caller":     a.Caller,
+			"time":       a.Time.Format(time.RFC3339Nano),
+			"fields":     a.Fields,
+			"suppressed": a.Suppressed,
+			"title":      a.Title,
+			"text":       a.Text,
+		})
+	}
+	var b bytes.Buffer
+	if err := w.template.Execute(&b, a); err != nil {
+		return nil, fmt.Errorf("alert writer execute template err: %v", err)
+	}
+	if !json.Valid(b.Bytes()) {
+		return nil, fmt.Errorf("alert writer template output invalid json: %s", b.String())
+	}
+	return b.Bytes(), nil
+}
+
+// Suppressed return the number of alerts grouped or rate limited, they are sent as the summaries
+func (w *AlertWriter) Suppressed() int64 {
+	return atomic.LoadInt64(&w.suppressed)
+}
+
+// Dropped return the number of alerts dropped by the full queue
+func (w *AlertWriter) Dropped() int64 {
+	if w.batcher == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&w.batcher.dropped)
+}
+
+// Failed return the number of alerts failed to send after retries
+func (w *AlertWriter) Failed() int64 {
+	if w.batcher == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&w.batcher.failed)
+}
+
+// Close send the pending summaries regardless of the rate limit, and the queued alerts within the close timeout
+func (w *AlertWriter) Close() error {
+	if w.batcher == nil {
+		return nil
+	}
+	w.lock.Lock()
+	if w.groups == nil {
+		w.lock.Unlock()
+		return nil
+	}
+	close(w.stop)
+	w.lock.Unlock()
+	<-w.quit
+
+	w.lock.Lock()
+	w.summary(time.Now(), true)
+	w.groups = nil
+	w.lock.Unlock()
+	return w.batcher.close()
+}
@@ -0,0 +1,235 @@
+package log4go
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// alertTestServer collect the webhook bodies
+type alertTestServer struct {
+	*httptest.Server
+	lock   sync.Mutex
+	bodies []map[string]interface{}
+}
+
+func newAlertTestServer(t *testing.T) *alertTestServer {
+	s := &alertTestServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		var body map[string]interface{}
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("invalid body %s", data)
+		}
+		s.lock.Lock()
+		s.bodies = append(s.bodies, body)
+		s.lock.Unlock()
+	}))
+	return s
+}
+
+// wait the number of bodies until the deadline
+func (s *alertTestServer) wait(t *testing.T, n int) []map[string]interface{} {
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		s.lock.Lock()
+		bodies := append([]map[string]interface{}(nil), s.bodies...)
+		s.lock.Unlock()
+		if len(bodies) >= n || time.Now().After(deadline) {
+			if len(bodies) != n {
+				t.Fatalf("bodies got %d, want %d: %v", len(bodies), n, bodies)
+			}
+			return bodies
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_AlertWriterGroup(t *testing.T) {
+	server := newAlertTestServer(t)
+	defer server.Close()
+
+	w := NewAlertWriter(AlertWriterOptions{
+		URL:         server.URL,
+		Service:     "order",
+		GroupWindow: 200 * time.Millisecond,
+		RateLimit:   -1,
+	})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err := w.Write(&Record{level: ERROR, msg: "ignored"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := w.Write(&Record{level: CRITICAL, msg: "db down", file: "main.go:42", fields: Fields{"db": "orders", "n": i}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Write(&Record{level: ALERT, msg: "disk full"}); err != nil {
+		t.Fatal(err)
+	}
+	bodies := server.wait(t, 2)
+	if bodies[0]["text"] != "*[CRITICAL] order* db down (main.go:42)\ndb=orders n=0" || bodies[1]["text"] != "*[ALERT] order* disk full" {
+		t.Errorf("alerts got %v", bodies)
+	}
+	if w.Suppressed() != 4 {
+		t.Errorf("suppressed got %d, want 4", w.Suppressed())
+	}
+
+	// the summary after the group window
+	bodies = server.wait(t, 3)
+	if bodies[2]["text"] != "*[CRITICAL] order* suppressed 4 similar alerts in 200ms: db down" {
+		t.Errorf("summary got %v", bodies[2])
+	}
+	// the group expired, the message alerts again
+	if err := w.Write(&Record{level: CRITICAL, msg: "db down"}); err != nil {
+		t.Fatal(err)
+	}
+	server.wait(t, 4)
+}
+
+func Test_AlertWriterRateLimit(t *testing.T) {
+	server := newAlertTestServer(t)
+	defer server.Close()
+
+	w := NewAlertWriter(AlertWriterOptions{
+		URL:         server.URL,
+		Format:      AlertFormatTeams,
+		Service:     "order",
+		GroupWindow: 100 * time.Millisecond,
+		RateLimit:   2,
+	})
+	w.rateWindow = 300 * time.Millisecond
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []*Record{
+		{level: CRITICAL, msg: "first"},
+		{level: CRITICAL, msg: "second"},
+		{level: CRITICAL, msg: "third"},
+		{level: EMERGENCY, msg: "fourth"},
+		{level: CRITICAL, msg: "fourth"},
+	} {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bodies := server.wait(t, 2)
+	if bodies[0]["@type"] != "MessageCard" || bodies[0]["title"] != "[CRITICAL] order" || bodies[0]["text"] != "first" {
+		t.Errorf("alert got %v", bodies[0])
+	}
+	if w.Suppressed() != 3 {
+		t.Errorf("suppressed got %d, want 3", w.Suppressed())
+	}
+
+	// the summary after the rate window, with the most severe level
+	bodies = server.wait(t, 3)
+	if bodies[2]["title"] != "[EMERGENCY] order" || bodies[2]["themeColor"] != "8B0000" ||
+		bodies[2]["text"] != "suppressed 3 alerts over the rate limit of 2 per 300ms" {
+		t.Errorf("summary got %v", bodies[2])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(&Record{level: CRITICAL, msg: "closed"}); err == nil {
+		t.Error("write after close should fail")
+	}
+}
+
+func Test_AlertWriterJSON(t *testing.T) {
+	server := newAlertTestServer(t)
+	defer server.Close()
+
+	w := NewAlertWriter(AlertWriterOptions{
+		URL:      server.URL,
+		Level:    "error",
+		Format:   AlertFormatJSON,
+		Template: `{"summary": {{json .Text}}, "user": {{json (.Field "user")}}, "suppressed": {{.Suppressed}}}`,
+	})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := w.Write(&Record{level: ERROR, msg: `say "hi"`, fields: Fields{"user": "xwi88"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the pending summary is sent when closed
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bodies := server.wait(t, 2)
+	if bodies[0]["summary"] != "say \"hi\"\nuser=xwi88" || bodies[0]["user"] != "xwi88" || bodies[0]["suppressed"] != 0.0 {
+		t.Errorf("alert got %v", bodies[0])
+	}
+	if !strings.HasPrefix(bodies[1]["summary"].(string), "suppressed 2 similar alerts") || bodies[1]["suppressed"] != 2.0 {
+		t.Errorf("summary got %v", bodies[1])
+	}
+
+	w = NewAlertWriter(AlertWriterOptions{URL: server.URL, Format: AlertFormatJSON})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(&Record{level: CRITICAL, msg: "default", fields: Fields{"n": 1}}); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+	body := server.wait(t, 3)[2]
+	if body["message"] != "default" || body["level"] != LevelFlagCritical || body["fields"].(map[string]interface{})["n"] != 1.0 {
+		t.Errorf("json got %v", body)
+	}
+}
+
+func Test_AlertWriterShortWindow(t *testing.T) {
+	server := newAlertTestServer(t)
+	defer server.Close()
+
+	// the summary ticker has a floor, the tiny window does not panic
+	w := NewAlertWriter(AlertWriterOptions{URL: server.URL, GroupWindow: time.Nanosecond, RateLimit: -1})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(&Record{level: CRITICAL, msg: "db down"}); err != nil {
+		t.Fatal(err)
+	}
+	server.wait(t, 1)
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_AlertWriterOptions(t *testing.T) {
+	for _, options := range []AlertWriterOptions{
+		{},
+		{URL: "http://127.0.0.1", Format: "discord"},
+		{URL: "http://127.0.0.1", Template: `{"text": {{json .Text}}}`},
+		{URL: "http://127.0.0.1", Format: AlertFormatJSON, Template: `{{.Text`},
+	} {
+		if err := NewAlertWriter(options).Init(); err == nil {
+			t.Errorf("options %+v should be invalid", options)
+		}
+	}
+
+	w := NewAlertWriter(AlertWriterOptions{URL: "http://127.0.0.1", Format: AlertFormatJSON, Template: `{{.Text}}`})
+	if err := w.Write(&Record{level: CRITICAL}); err == nil {
+		t.Error("write before init should fail")
+	}
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Write(&Record{level: CRITICAL, msg: "not json"}); err == nil {
+		t.Error("invalid json template output should fail")
+	}
+}
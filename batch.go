@@ -0,0 +1,248 @@
+package log4go
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	batchSizeDefault            = 100
+	batchFlushIntervalDefault   = time.Second
+	batchBufferSizeDefault      = 16
+	batchRetryMaxDefault        = 3
+	batchRetryBackoffDefault    = 500 * time.Millisecond
+	batchRetryBackoffMaxDefault = 30 * time.Second
+	batchCloseTimeoutDefault    = 5 * time.Second
+)
+
+// batchOptions the batch, queue and retry options of the batching writers
+type batchOptions struct {
+	size            int           // records to trigger a send, default 100
+	bytes           int           // encoded bytes to trigger a send, not limited if 0
+	flushInterval   time.Duration // max delay of a record, default 1s
+	bufferSize      int           // queued batches, the oldest dropped when full, default 16
+	retryMax        int           // default 3, -1 means no retry
+	retryBackoff    time.Duration // first retry delay, doubled on retries, default 500ms
+	retryBackoffMax time.Duration // default 30s
+	closeTimeout    time.Duration // the deadline to send the queued batches when closed, default 5s
+}
+
+// batcher batch the encoded records and send them by one sender in order, the transport is plugged by send
+type batcher struct {
+	name    string // the writer name in logs and errors
+	options batchOptions
+
+	// send the items once, return the items to retry, the number of failed items
+	// and the delay before the retry, the backoff is used if 0
+	send func(ctx context.Context, items [][]byte) (retry [][]byte, failed int, delay time.Duration, err error)
+	// quit called by the sender when stopped, optional, ex: close the connection
+	quit func()
+
+	lock       sync.Mutex
+	items      [][]byte
+	bytes      int
+	batches    chan [][]byte
+	closed     bool
+	stop       chan struct{} // closed to stop the flush daemon
+	ctx        context.Context
+	cancel     context.CancelFunc // abort the sending when close timeout
+	senderQuit chan struct{}
+
+	pending int64 // records buffered or sending
+	dropped int64 // records dropped by the full queue
+	failed  int64 // records failed after retries
+}
+
+// newBatcher create the batcher, start it by start
+func newBatcher(name string, options batchOptions, send func(ctx context.Context, items [][]byte) ([][]byte, int, time.Duration, error)) *batcher {
+	b := &batcher{
+		name:       name,
+		options:    options,
+		send:       send,
+		stop:       make(chan struct{}),
+		senderQuit: make(chan struct{}),
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	return b
+}
+
+func (b *batcher) start() {
+	size := b.options.bufferSize
+	if size <= 0 {
+		size = batchBufferSizeDefault
+	}
+	b.batches = make(chan [][]byte, size)
+	go b.daemonFlush()
+	go b.daemonSender()
+}
+
+// add append the encoded record to the batch, send the batch if full
+func (b *batcher) add(item []byte) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.batches == nil || b.closed {
+		return fmt.Errorf("%s not running", b.name)
+	}
+	atomic.AddInt64(&b.pending, 1)
+	b.items = append(b.items, item)
+	b.bytes += len(item)
+
+	size := b.options.size
+	if size <= 0 {
+		size = batchSizeDefault
+	}
+	if len(b.items) >= size || b.options.bytes > 0 && b.bytes >= b.options.bytes {
+		b.push()
+	}
+	return nil
+}
+
+// push queue the batch, drop the oldest batch if the queue is full, must hold the lock
+func (b *batcher) push() {
+	if len(b.items) == 0 {
+		return
+	}
+	items := b.items
+	b.items, b.bytes = nil, 0
+	for {
+		select {
+		case b.batches <- items:
+			return
+		default:
+		}
+		select {
+		case oldest := <-b.batches:
+			n := int64(len(oldest))
+			atomic.AddInt64(&b.pending, -n)
+			atomic.AddInt64(&b.dropped, n)
+			log.Printf("[log4go] %s queue full, dropped %d records", b.name, n)
+		default:
+		}
+	}
+}
+
+// daemonFlush send the batch by the flush interval
+func (b *batcher) daemonFlush() {
+	interval := b.options.flushInterval
+	if interval <= 0 {
+		interval = batchFlushIntervalDefault
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.lock.Lock()
+			b.push()
+			b.lock.Unlock()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+func (b *batcher) daemonSender() {
+	defer close(b.senderQuit)
+	if b.quit != nil {
+		defer b.quit()
+	}
+	for items := range b.batches {
+		if b.ctx.Err() != nil {
+			return
+		}
+		failed, err := b.deliver(items)
+		atomic.AddInt64(&b.pending, -int64(len(items)))
+		atomic.AddInt64(&b.failed, int64(failed))
+		if err != nil {
+			log.Printf("[log4go] %s send %d records, %d failed, err: %v", b.name, len(items), failed, err.Error())
+		}
+	}
+}
+
+// deliver send the batch with retries, only the items to retry are sent again, return the number of failed items
+func (b *batcher) deliver(items [][]byte) (int, error) {
+	retryMax := b.options.retryMax
+	if retryMax == 0 {
+		retryMax = batchRetryMaxDefault
+	} else if retryMax < 0 {
+		retryMax = 0
+	}
+
+	failed := 0
+	for attempt := 0; ; attempt++ {
+		retry, n, delay, err := b.send(b.ctx, items)
+		failed += n
+		if len(retry) == 0 {
+			return failed, err
+		}
+		if attempt >= retryMax {
+			return failed + len(retry), err
+		}
+		if delay <= 0 {
+			delay = retryBackoff(b.options.retryBackoff, b.options.retryBackoffMax, attempt)
+		}
+		log.Printf("[log4go] %s send err: %v, retry %d records in %v", b.name, err, len(retry), delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-b.ctx.Done():
+			timer.Stop()
+			return failed + len(retry), err
+		}
+		items = retry
+	}
+}
+
+// retryBackoff the exponential backoff of the attempt
+func retryBackoff(backoff, max time.Duration, attempt int) time.Duration {
+	if backoff <= 0 {
+		backoff = batchRetryBackoffDefault
+	}
+	if max <= 0 {
+		max = batchRetryBackoffMaxDefault
+	}
+	for i := 0; i < attempt && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// close send the buffered records within the close timeout, return the error if some records undelivered
+func (b *batcher) close() error {
+	b.lock.Lock()
+	if b.batches == nil || b.closed {
+		b.lock.Unlock()
+		return nil
+	}
+	b.push()
+	b.closed = true
+	close(b.batches)
+	close(b.stop)
+	b.lock.Unlock()
+
+	timeout := b.options.closeTimeout
+	if timeout <= 0 {
+		timeout = batchCloseTimeoutDefault
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-b.senderQuit:
+	case <-timer.C:
+		b.cancel()
+		<-b.senderQuit
+	}
+	b.cancel()
+
+	if n := atomic.LoadInt64(&b.pending); n > 0 {
+		return fmt.Errorf("%s closed with %d undelivered records", b.name, n)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package log4go
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_retryBackoff(t *testing.T) {
+	for attempt, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond,
+		800 * time.Millisecond, time.Second, time.Second} {
+		if got := retryBackoff(100*time.Millisecond, time.Second, attempt); got != want {
+			t.Errorf("attempt %d backoff got %v, want %v", attempt, got, want)
+		}
+	}
+	if got := retryBackoff(0, 0, 0); got != batchRetryBackoffDefault {
+		t.Errorf("default backoff got %v", got)
+	}
+}
+
+func Test_Batcher(t *testing.T) {
+	var lock sync.Mutex
+	var sent []string
+	attempts := 0
+	send := func(ctx context.Context, items [][]byte) ([][]byte, int, time.Duration, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		// the first attempt retries the last item and fails the first one
+		if attempts++; attempts == 1 {
+			return items[len(items)-1:], 1, time.Millisecond, errors.New("partial")
+		}
+		for _, item := range items {
+			sent = append(sent, string(item))
+		}
+		return nil, 0, 0, nil
+	}
+	quit := make(chan struct{})
+	b := newBatcher("test writer", batchOptions{size: 3, flushInterval: time.Hour}, send)
+	b.quit = func() { close(quit) }
+	if err := b.add([]byte("early")); err == nil {
+		t.Error("add before start should fail")
+	}
+	b.start()
+	for _, item := range []string{"a", "b", "c", "d"} {
+		if err := b.add([]byte(item)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the last batch of d is sent when closed
+	if err := b.close(); err != nil {
+		t.Fatal(err)
+	}
+	<-quit
+	if strings.Join(sent, ",") != "c,d" || b.failed != 1 || b.pending != 0 {
+		t.Errorf("sent %v, failed %d, pending %d", sent, b.failed, b.pending)
+	}
+	if err := b.add([]byte("closed")); err == nil {
+		t.Error("add after close should fail")
+	}
+}
+
+func Test_BatcherDropOldest(t *testing.T) {
+	block := make(chan struct{})
+	send := func(ctx context.Context, items [][]byte) ([][]byte, int, time.Duration, error) {
+		<-block
+		return items, 0, 0, errors.New("down")
+	}
+	b := newBatcher("test writer", batchOptions{size: 1, bufferSize: 1, flushInterval: time.Hour,
+		retryBackoff: time.Hour, closeTimeout: 50 * time.Millisecond}, send)
+	b.start()
+	// the sender holds the first, the second is dropped by the third
+	for _, item := range []string{"a", "b", "c"} {
+		if err := b.add([]byte(item)); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(block)
+	if b.dropped != 1 {
+		t.Errorf("dropped got %d, want 1", b.dropped)
+	}
+	// the retry of a is aborted by the close timeout, c is not sent
+	if err := b.close(); err == nil || !strings.Contains(err.Error(), "test writer closed with 1 undelivered records") {
+		t.Errorf("close got %v", err)
+	}
+	if b.failed != 1 {
+		t.Errorf("failed got %d, want 1", b.failed)
+	}
+}
@@ -11,19 +11,39 @@ import (
 var GlobalLevel = DEBUG
 
 const (
-	WriterNameConsole = "console_writer"
-	WriterNameFile    = "file_writer"
-	WriterNameKafka   = "kafka_writer"
+	WriterNameConsole  = "console_writer"
+	WriterNameFile     = "file_writer"
+	WriterNameKafka    = "kafka_writer"
+	WriterNameSyslog   = "syslog_writer"
+	WriterNameNet      = "net_writer"
+	WriterNameHTTP     = "http_writer"
+	WriterNameES       = "elasticsearch_writer"
+	WriterNameLoki     = "loki_writer"
+	WriterNameGELF     = "gelf_writer"
+	WriterNameFluent   = "fluent_writer"
+	WriterNameOTLP     = "otlp_writer"
+	WriterNameJournald = "journald_writer"
+	WriterNameAlert    = "alert_writer"
 )
 
 // LogConfig log config
 type LogConfig struct {
-	Level         string               `json:"level" mapstructure:"level"`
-	Debug         bool                 `json:"debug" mapstructure:"debug"` // output log info or not for log4go
-	FullPath      bool                 `json:"full_path" mapstructure:"full_path"`
-	ConsoleWriter ConsoleWriterOptions `json:"console_writer" mapstructure:"console_writer"`
-	FileWriter    FileWriterOptions    `json:"file_writer" mapstructure:"file_writer"`
-	KafKaWriter   KafKaWriterOptions   `json:"kafka_writer" mapstructure:"kafka_writer"`
+	Level          string                     `json:"level" mapstructure:"level"`
+	Debug          bool                       `json:"debug" mapstructure:"debug"` // output log info or not for log4go
+	FullPath       bool                       `json:"full_path" mapstructure:"full_path"`
+	ConsoleWriter  ConsoleWriterOptions       `json:"console_writer" mapstructure:"console_writer"`
+	FileWriter     FileWriterOptions          `json:"file_writer" mapstructure:"file_writer"`
+	KafKaWriter    KafKaWriterOptions         `json:"kafka_writer" mapstructure:"kafka_writer"`
+	SyslogWriter   SyslogWriterOptions        `json:"syslog_writer" mapstructure:"syslog_writer"`
+	NetWriter      NetWriterOptions           `json:"net_writer" mapstructure:"net_writer"`
+	HTTPWriter     HTTPWriterOptions          `json:"http_writer" mapstructure:"http_writer"`
+	ESWriter       ElasticsearchWriterOptions `json:"elasticsearch_writer" mapstructure:"elasticsearch_writer"`
+	LokiWriter     LokiWriterOptions          `json:"loki_writer" mapstructure:"loki_writer"`
+	GELFWriter     GELFWriterOptions          `json:"gelf_writer" mapstructure:"gelf_writer"`
+	FluentWriter   FluentWriterOptions        `json:"fluent_writer" mapstructure:"fluent_writer"`
+	OTLPWriter     OTLPWriterOptions          `json:"otlp_writer" mapstructure:"otlp_writer"`
+	JournaldWriter JournaldWriterOptions      `json:"journald_writer" mapstructure:"journald_writer"`
+	AlertWriter    AlertWriterOptions         `json:"alert_writer" mapstructure:"alert_writer"`
 }
 
 // SetupLog setup log
@@ -45,6 +65,16 @@ func SetupLog(lc LogConfig) (err error) {
 	fileWriterLevelDefault := GlobalLevel
 	consoleWriterLevelDefault := GlobalLevel
 	kafkaWriterLevelDefault := GlobalLevel
+	syslogWriterLevelDefault := GlobalLevel
+	netWriterLevelDefault := GlobalLevel
+	httpWriterLevelDefault := GlobalLevel
+	esWriterLevelDefault := GlobalLevel
+	lokiWriterLevelDefault := GlobalLevel
+	gelfWriterLevelDefault := GlobalLevel
+	fluentWriterLevelDefault := GlobalLevel
+	otlpWriterLevelDefault := GlobalLevel
+	journaldWriterLevelDefault := GlobalLevel
+	alertWriterLevelDefault := CRITICAL
 
 	if lc.ConsoleWriter.Enable {
 		consoleWriterLevelDefault = getLevelDefault(lc.ConsoleWriter.Level, GlobalLevel, WriterNameConsole)
@@ -70,6 +100,86 @@ func SetupLog(lc LogConfig) (err error) {
 		}
 	}
 
+	if lc.SyslogWriter.Enable {
+		syslogWriterLevelDefault = getLevelDefault(lc.SyslogWriter.Level, GlobalLevel, WriterNameSyslog)
+		validGlobalMinLevel = maxInt(syslogWriterLevelDefault, validGlobalMinLevel)
+		if validGlobalMinLevel == syslogWriterLevelDefault {
+			validGlobalMinLevelBy = WriterNameSyslog
+		}
+	}
+
+	if lc.NetWriter.Enable {
+		netWriterLevelDefault = getLevelDefault(lc.NetWriter.Level, GlobalLevel, WriterNameNet)
+		validGlobalMinLevel = maxInt(netWriterLevelDefault, validGlobalMinLevel)
+		if validGlobalMinLevel == netWriterLevelDefault {
+			validGlobalMinLevelBy = WriterNameNet
+		}
+	}
+
+	if lc.HTTPWriter.Enable {
+		httpWriterLevelDefault = getLevelDefault(lc.HTTPWriter.Level, GlobalLevel, WriterNameHTTP)
+		validGlobalMinLevel = maxInt(httpWriterLevelDefault, validGlobalMinLevel)
+		if validGlobalMinLevel == httpWriterLevelDefault {
+			validGlobalMinLevelBy = WriterNameHTTP
+		}
+	}
+
+	if lc.ESWriter.Enable {
+		esWriterLevelDefault = getLevelDefault(lc.ESWriter.Level, GlobalLevel, WriterNameES)
+		validGlobalMinLevel = maxInt(esWriterLevelDefault, validGlobalMinLevel)
+		if validGlobalMinLevel == esWriterLevelDefault {
+			validGlobalMinLevelBy = WriterNameES
+		}
+	}
+
+	if lc.LokiWriter.Enable {
+		lokiWriterLevelDefault = getLevelDefault(lc.LokiWriter.Level, GlobalLevel, WriterNameLoki)
+		validGlobalMinLevel = maxInt(lokiWriterLevelDefault, validGlobalMinLevel)
+		if validGlobalMinLevel == lokiWriterLevelDefault {
+			validGlobalMinLevelBy = WriterNameLoki
+		}
+	}
+
+	if lc.GELFWriter.Enable {
+		gelfWriterLevelDefault = getLevelDefault(lc.GELFWriter.Level, GlobalLevel, WriterNameGELF)
+		validGlobalMinLevel = maxInt(gelfWriterLevelDefault, validGlobalMinLevel)
+		if validGlobalMinLevel == gelfWriterLevelDefault {
+			validGlobalMinLevelBy = WriterNameGELF
+		}
+	}
+
+	if lc.FluentWriter.Enable {
+		fluentWriterLevelDefault = getLevelDefault(lc.FluentWriter.Level, GlobalLevel, WriterNameFluent)
+		validGlobalMinLevel = maxInt(fluentWriterLevelDefault, validGlobalMinLevel)
+		if validGlobalMinLevel == fluentWriterLevelDefault {
+			validGlobalMinLevelBy = WriterNameFluent
+		}
+	}
+
+	if lc.OTLPWriter.Enable {
+		otlpWriterLevelDefault = getLevelDefault(lc.OTLPWriter.Level, GlobalLevel, WriterNameOTLP)
+		validGlobalMinLevel = maxInt(otlpWriterLevelDefault, validGlobalMinLevel)
+		if validGlobalMinLevel == otlpWriterLevelDefault {
+			validGlobalMinLevelBy = WriterNameOTLP
+		}
+	}
+
+	if lc.JournaldWriter.Enable {
+		journaldWriterLevelDefault = getLevelDefault(lc.JournaldWriter.Level, GlobalLevel, WriterNameJournald)
+		validGlobalMinLevel = maxInt(journaldWriterLevelDefault, validGlobalMinLevel)
+		if validGlobalMinLevel == journaldWriterLevelDefault {
+			validGlobalMinLevelBy = WriterNameJournald
+		}
+	}
+
+	if lc.AlertWriter.Enable {
+		alertWriterLevelDefault = getLevelDefault(lc.AlertWriter.Level, CRITICAL, WriterNameAlert)
+		validGlobalMinLevel = maxInt(alertWriterLevelDefault, validGlobalMinLevel)
+		if validGlobalMinLevel == alertWriterLevelDefault {
+			validGlobalMinLevelBy = WriterNameAlert
+		}
+	}
+
 	fullPath := lc.FullPath
 	WithFullPath(fullPath)
 	SetLevel(validGlobalMinLevel)
@@ -78,21 +188,117 @@ func SetupLog(lc LogConfig) (err error) {
 		w := NewConsoleWriterWithOptions(lc.ConsoleWriter)
 		w.level = consoleWriterLevelDefault
 		log.Printf("[log4go] enable " + WriterNameConsole + " with level " + LevelFlags[consoleWriterLevelDefault])
-		Register(w)
+		if err = Register(w); err != nil {
+			return err
+		}
 	}
 
 	if lc.FileWriter.Enable {
 		w := NewFileWriterWithOptions(lc.FileWriter)
 		w.level = fileWriterLevelDefault
 		log.Printf("[log4go] enable    " + WriterNameFile + " with level " + LevelFlags[fileWriterLevelDefault])
-		Register(w)
+		if err = Register(w); err != nil {
+			return err
+		}
 	}
 
 	if lc.KafKaWriter.Enable {
 		w := NewKafKaWriter(lc.KafKaWriter)
 		w.level = kafkaWriterLevelDefault
 		log.Printf("[log4go] enable   " + WriterNameKafka + " with level " + LevelFlags[kafkaWriterLevelDefault])
-		Register(w)
+		if err = Register(w); err != nil {
+			return err
+		}
+	}
+
+	if lc.SyslogWriter.Enable {
+		w := NewSyslogWriter(lc.SyslogWriter)
+		w.level = syslogWriterLevelDefault
+		log.Printf("[log4go] enable  " + WriterNameSyslog + " with level " + LevelFlags[syslogWriterLevelDefault])
+		if err = Register(w); err != nil {
+			return err
+		}
+	}
+
+	if lc.NetWriter.Enable {
+		w := NewNetWriter(lc.NetWriter)
+		w.level = netWriterLevelDefault
+		log.Printf("[log4go] enable     " + WriterNameNet + " with level " + LevelFlags[netWriterLevelDefault])
+		if err = Register(w); err != nil {
+			return err
+		}
+	}
+
+	if lc.HTTPWriter.Enable {
+		w := NewHTTPWriter(lc.HTTPWriter)
+		w.level = httpWriterLevelDefault
+		log.Printf("[log4go] enable    " + WriterNameHTTP + " with level " + LevelFlags[httpWriterLevelDefault])
+		if err = Register(w); err != nil {
+			return err
+		}
+	}
+
+	if lc.ESWriter.Enable {
+		w := NewElasticsearchWriter(lc.ESWriter)
+		w.level = esWriterLevelDefault
+		log.Printf("[log4go] enable " + WriterNameES + " with level " + LevelFlags[esWriterLevelDefault])
+		if err = Register(w); err != nil {
+			return err
+		}
+	}
+
+	if lc.LokiWriter.Enable {
+		w := NewLokiWriter(lc.LokiWriter)
+		w.level = lokiWriterLevelDefault
+		log.Printf("[log4go] enable    " + WriterNameLoki + " with level " + LevelFlags[lokiWriterLevelDefault])
+		if err = Register(w); err != nil {
+			return err
+		}
+	}
+
+	if lc.GELFWriter.Enable {
+		w := NewGELFWriter(lc.GELFWriter)
+		w.level = gelfWriterLevelDefault
+		log.Printf("[log4go] enable    " + WriterNameGELF + " with level " + LevelFlags[gelfWriterLevelDefault])
+		if err = Register(w); err != nil {
+			return err
+		}
+	}
+
+	if lc.FluentWriter.Enable {
+		w := NewFluentWriter(lc.FluentWriter)
+		w.level = fluentWriterLevelDefault
+		log.Printf("[log4go] enable  " + WriterNameFluent + " with level " + LevelFlags[fluentWriterLevelDefault])
+		if err = Register(w); err != nil {
+			return err
+		}
+	}
+
+	if lc.OTLPWriter.Enable {
+		w := NewOTLPWriter(lc.OTLPWriter)
+		w.level = otlpWriterLevelDefault
+		log.Printf("[log4go] enable    " + WriterNameOTLP + " with level " + LevelFlags[otlpWriterLevelDefault])
+		if err = Register(w); err != nil {
+			return err
+		}
+	}
+
+	if lc.JournaldWriter.Enable {
+		w := NewJournaldWriter(lc.JournaldWriter)
+		w.level = journaldWriterLevelDefault
+		log.Printf("[log4go] enable " + WriterNameJournald + " with level " + LevelFlags[journaldWriterLevelDefault])
+		if err = Register(w); err != nil {
+			return err
+		}
+	}
+
+	if lc.AlertWriter.Enable {
+		w := NewAlertWriter(lc.AlertWriter)
+		w.level = alertWriterLevelDefault
+		log.Printf("[log4go] enable   " + WriterNameAlert + " with level " + LevelFlags[alertWriterLevelDefault])
+		if err = Register(w); err != nil {
+			return err
+		}
 	}
 
 	log.Printf("[log4go] valid global_level(min:%v, flag:%v, by:%v), default(%v, flag:%v)",
@@ -0,0 +1,151 @@
+package log4go
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Console writer modes
+const (
+	ConsoleModeDefault = "default" // the same format as file writer
+	ConsoleModePretty  = "pretty"  // human-oriented format for local development
+)
+
+const (
+	prettyTimeWidth      = 8  // width of relative timestamp, like "+12.345s"
+	prettyLevelWidth     = 5  // width of short level flag
+	prettyCallerMaxWidth = 32 // max width of caller column, longer caller will not be aligned
+)
+
+// prettyLevelFlags short level flags for pretty mode
+var prettyLevelFlags = []string{
+	"EMERG",
+	"ALERT",
+	"CRIT",
+	"ERROR",
+	"WARN",
+	"NOTE",
+	"INFO",
+	"DEBUG",
+}
+
+// dim brush for field values in pretty mode
+var dimBrush = newBrush("2")
+
+// prettyString format the record in pretty mode:
+// relative timestamp, short level, abbreviated caller, message, dimmed fields, then errors with stack
+func (w *ConsoleWriter) prettyString(r *Record, color bool) string {
+	theme := w.theme
+	if theme == nil || !color {
+		theme = plainConsoleTheme
+	}
+	dim := dimBrush
+	if !color {
+		dim = plainConsoleTheme.message
+	}
+
+	caller := prettyCaller(r)
+	if len(caller) > w.callerWidth && len(caller) <= prettyCallerMaxWidth {
+		w.callerWidth = len(caller)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(theme.timestamp(fmt.Sprintf("%*s", prettyTimeWidth, prettyElapsed(r.now.Sub(w.start)))))
+	buf.WriteByte(' ')
+	buf.WriteString(theme.levels[r.level](fmt.Sprintf("%-*s", prettyLevelWidth, prettyLevelFlags[r.level])))
+	buf.WriteByte(' ')
+	buf.WriteString(theme.caller(caller))
+	if pad := w.callerWidth - len(caller); pad > 0 {
+		buf.WriteString(strings.Repeat(" ", pad))
+	}
+	buf.WriteByte(' ')
+
+	indent := strings.Repeat(" ", prettyTimeWidth+prettyLevelWidth+w.callerWidth+3)
+	lines := strings.Split(strings.TrimRight(r.msg, "\n"), "\n")
+	for i, line := range lines {
+		if i > 0 {
+			buf.WriteByte('\n')
+			buf.WriteString(indent)
+		}
+		buf.WriteString(theme.message(line))
+	}
+
+	var errKeys []string
+	fields := make(Fields, len(r.fields))
+	for k, v := range r.fields {
+		if _, ok := v.(error); ok {
+			errKeys = append(errKeys, k)
+			continue
+		}
+		fields[k] = v
+	}
+	buf.WriteString(formatFields(fields, theme.fieldKey, dim))
+	buf.WriteByte('\n')
+
+	sort.Strings(errKeys)
+	for _, k := range errKeys {
+		buf.WriteString(prettyError(k, r.fields[k].(error), indent, theme, dim))
+	}
+	return buf.String()
+}
+
+// prettyError format the error in lines, with stack trace if the error support %+v, like github.com/pkg/errors
+func prettyError(key string, err error, indent string, theme *consoleTheme, dim brush) string {
+	var buf bytes.Buffer
+	msg := err.Error()
+	buf.WriteString(indent)
+	buf.WriteString(theme.fieldKey(key + ":"))
+	buf.WriteByte(' ')
+	buf.WriteString(theme.levels[ERROR](msg))
+	buf.WriteByte('\n')
+
+	detail := fmt.Sprintf("%+v", err)
+	if detail == msg {
+		return buf.String()
+	}
+	detail = strings.TrimPrefix(detail, msg)
+	for _, line := range strings.Split(strings.Trim(detail, "\n"), "\n") {
+		buf.WriteString(indent)
+		buf.WriteString("  ")
+		buf.WriteString(dim(line))
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// prettyCaller abbreviated caller, only keep the last dir of the file, like "log4go/log.go:42"
+func prettyCaller(r *Record) string {
+	if r.fileName == "" {
+		return r.file
+	}
+	file := filepath.ToSlash(r.fileName)
+	if i := strings.LastIndex(file, "/"); i >= 0 {
+		if j := strings.LastIndex(file[:i], "/"); j >= 0 {
+			file = file[j+1:]
+		}
+	}
+	return file + ":" + strconv.Itoa(r.line)
+}
+
+// prettyElapsed short relative timestamp, like "+12.345s", "+12m05s" or "+2h03m"
+func prettyElapsed(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("+%.3fs", d.Seconds())
+	case d < time.Hour:
+		return fmt.Sprintf("+%dm%02ds", int(d/time.Minute), int(d%time.Minute/time.Second))
+	default:
+		return fmt.Sprintf("+%dh%02dm", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	}
+}
+
+// plainConsoleTheme the theme without color
+var plainConsoleTheme, _ = ConsoleTheme{}.compile()
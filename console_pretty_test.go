@@ -0,0 +1,130 @@
+package log4go
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stackError error with stack trace for %+v, like github.com/pkg/errors
+type stackError struct {
+	msg string
+}
+
+func (e *stackError) Error() string {
+	return e.msg
+}
+
+func (e *stackError) Format(s fmt.State, verb rune) {
+	_, _ = fmt.Fprint(s, e.msg)
+	if verb == 'v' && s.Flag('+') {
+		_, _ = fmt.Fprint(s, "\nmain.handler\n\t/app/main.go:42")
+	}
+}
+
+func generatePrettyConsoleWriter(out *bytes.Buffer) *ConsoleWriter {
+	w := NewConsoleWriterWithOptions(ConsoleWriterOptions{
+		Level:     LevelFlagDebug,
+		ColorMode: ColorModeNever,
+		Mode:      ConsoleModePretty,
+		Output:    out,
+	})
+	return w
+}
+
+func Test_PrettyElapsed(t *testing.T) {
+	cases := map[time.Duration]string{
+		-time.Second:                          "+0.000s",
+		1234 * time.Millisecond:               "+1.234s",
+		12*time.Minute + 5*time.Second:        "+12m05s",
+		2*time.Hour + 3*time.Minute + 1:       "+2h03m",
+		59*time.Second + 999*time.Microsecond: "+59.001s",
+	}
+	for d, want := range cases {
+		if got := prettyElapsed(d); got != want {
+			t.Errorf("elapsed(%v) got %s, want %s", d, got, want)
+		}
+	}
+}
+
+func Test_NewConsoleWriterWithPretty(t *testing.T) {
+	var out bytes.Buffer
+	w := generatePrettyConsoleWriter(&out)
+
+	_ = w.Write(&Record{
+		level:    INFO,
+		msg:      "first line\nsecond line",
+		now:      w.start.Add(1500 * time.Millisecond),
+		fileName: "/home/xwi88/go/src/log4go/pretty.go",
+		line:     12,
+		fields:   Fields{"user": "xwi88", "msg": "a b", "id": 1},
+	})
+	want := " +1.500s INFO  log4go/pretty.go:12 first line\n" +
+		"                                   second line id=1 msg=\"a b\" user=xwi88\n"
+	if out.String() != want {
+		t.Errorf("pretty got:\n%q\nwant:\n%q", out.String(), want)
+	}
+
+	out.Reset()
+	_ = w.Write(&Record{
+		level:    ERROR,
+		msg:      "request failed",
+		now:      w.start.Add(2 * time.Minute),
+		fileName: "handler.go",
+		line:     7,
+		fields:   Fields{"error": &stackError{msg: "boom"}, "cause": errors.New("timeout"), "path": "/"},
+	})
+	want = "  +2m00s ERROR handler.go:7        request failed path=/\n" +
+		"                                   cause: timeout\n" +
+		"                                   error: boom\n" +
+		"                                     main.handler\n" +
+		"                                     \t/app/main.go:42\n"
+	if out.String() != want {
+		t.Errorf("pretty got:\n%q\nwant:\n%q", out.String(), want)
+	}
+}
+
+func Test_NewConsoleWriterWithPrettyColor(t *testing.T) {
+	var out bytes.Buffer
+	w := generatePrettyConsoleWriter(&out)
+	w.SetColorMode(ColorModeAlways)
+
+	_ = w.Write(&Record{level: WARNING, msg: "color", now: w.start, file: "pretty.go:1", fields: Fields{"k": "v"}})
+	got := out.String()
+	for _, part := range []string{
+		"\033[36m +0.000s\033[0m",
+		"\033[33mWARN \033[0m",
+		"\033[30;47mpretty.go:1\033[0m",
+		"\033[36mk\033[0m\033[2m=v\033[0m",
+	} {
+		if !strings.Contains(got, part) {
+			t.Errorf("pretty color %q should contain %q", got, part)
+		}
+	}
+}
+
+func Test_NewConsoleWriterWithPrettyLogger(t *testing.T) {
+	var out bytes.Buffer
+	records := make(chan *Record, uint(16))
+	loggerDefaultTest := newLoggerWithRecords(records)
+	w := generatePrettyConsoleWriter(&out)
+	generateRegisterConsoleWriter(loggerDefaultTest, w, false, false, "")
+
+	args := []interface{}{"xwi88", Fields{"id": 1}, Fields{"role": "admin"}}
+	loggerDefaultTest.Info("user %s login", args...)
+	loggerDefaultTest.Close()
+
+	if _, ok := args[1].(Fields); !ok {
+		t.Error("args should not be modified")
+	}
+	got := out.String()
+	if !strings.Contains(got, "user xwi88 login id=1 role=admin\n") {
+		t.Errorf("pretty logger got %q", got)
+	}
+	if !strings.Contains(got, "/console_pretty_test.go:") || strings.Count(got, "/") != 1 {
+		t.Errorf("pretty logger caller should be abbreviated, got %q", got)
+	}
+}
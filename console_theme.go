@@ -0,0 +1,332 @@
+package log4go
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Console theme names
+const (
+	ThemeDark         = "dark" // default theme
+	ThemeLight        = "light"
+	ThemeHighContrast = "high_contrast"
+)
+
+// ColorStyle console color style
+// color can be the name (ex: red, bright_red), 256-color index (ex: 208) or truecolor (ex: #ff8800)
+type ColorStyle struct {
+	Foreground string   `json:"fg" mapstructure:"fg"`
+	Background string   `json:"bg" mapstructure:"bg"`
+	Effects    []string `json:"effects" mapstructure:"effects"` // bold, dim, italic, underline, blink, reverse
+}
+
+// ConsoleTheme console color theme, the empty style will use the base theme style
+type ConsoleTheme struct {
+	Levels    map[string]ColorStyle `json:"levels" mapstructure:"levels"` // level flag style, key is the level flag
+	Lines     map[string]ColorStyle `json:"lines" mapstructure:"lines"`   // full color line style, key is the level flag
+	Timestamp ColorStyle            `json:"timestamp" mapstructure:"timestamp"`
+	Caller    ColorStyle            `json:"caller" mapstructure:"caller"`
+	Message   ColorStyle            `json:"message" mapstructure:"message"`
+	FieldKey  ColorStyle            `json:"field_key" mapstructure:"field_key"`
+}
+
+// ConsoleThemes built-in console themes
+var ConsoleThemes = map[string]ConsoleTheme{
+	ThemeDark: {
+		Levels: map[string]ColorStyle{
+			LevelFlagEmergency: {Foreground: "red"},
+			LevelFlagAlert:     {Foreground: "cyan"},
+			LevelFlagCritical:  {Foreground: "magenta"},
+			LevelFlagError:     {Foreground: "red"},
+			LevelFlagWarning:   {Foreground: "yellow"},
+			LevelFlagNotice:    {Foreground: "green"},
+			LevelFlagInfo:      {Foreground: "blue"},
+			LevelFlagDebug:     {Background: "blue"},
+		},
+		Lines: map[string]ColorStyle{
+			LevelFlagEmergency: {Foreground: "red", Effects: []string{"bold"}},
+			LevelFlagAlert:     {Foreground: "cyan", Effects: []string{"bold"}},
+			LevelFlagCritical:  {Foreground: "magenta", Effects: []string{"bold"}},
+			LevelFlagError:     {Foreground: "red", Effects: []string{"bold"}},
+			LevelFlagWarning:   {Foreground: "yellow", Effects: []string{"bold"}},
+			LevelFlagNotice:    {Foreground: "green", Effects: []string{"bold"}},
+			LevelFlagInfo:      {Foreground: "blue", Effects: []string{"bold"}},
+			LevelFlagDebug:     {Foreground: "white", Effects: []string{"dim"}},
+		},
+		Timestamp: ColorStyle{Foreground: "cyan"},
+		Caller:    ColorStyle{Foreground: "black", Background: "white"},
+		FieldKey:  ColorStyle{Foreground: "cyan"},
+	},
+	ThemeLight: {
+		Levels: map[string]ColorStyle{
+			LevelFlagEmergency: {Foreground: "white", Background: "red", Effects: []string{"bold"}},
+			LevelFlagAlert:     {Foreground: "magenta", Effects: []string{"bold"}},
+			LevelFlagCritical:  {Foreground: "red", Effects: []string{"bold"}},
+			LevelFlagError:     {Foreground: "red"},
+			LevelFlagWarning:   {Foreground: "130"},
+			LevelFlagNotice:    {Foreground: "green"},
+			LevelFlagInfo:      {Foreground: "blue"},
+			LevelFlagDebug:     {Foreground: "bright_black"},
+		},
+		Lines: map[string]ColorStyle{
+			LevelFlagEmergency: {Foreground: "red", Effects: []string{"bold"}},
+			LevelFlagAlert:     {Foreground: "magenta", Effects: []string{"bold"}},
+			LevelFlagCritical:  {Foreground: "red", Effects: []string{"bold"}},
+			LevelFlagError:     {Foreground: "red"},
+			LevelFlagWarning:   {Foreground: "130"},
+			LevelFlagNotice:    {Foreground: "green"},
+			LevelFlagInfo:      {Foreground: "blue"},
+			LevelFlagDebug:     {Foreground: "bright_black"},
+		},
+		Timestamp: ColorStyle{Foreground: "bright_black"},
+		Caller:    ColorStyle{Foreground: "black", Effects: []string{"underline"}},
+		FieldKey:  ColorStyle{Foreground: "blue"},
+	},
+	ThemeHighContrast: {
+		Levels: map[string]ColorStyle{
+			LevelFlagEmergency: {Foreground: "bright_white", Background: "red", Effects: []string{"bold"}},
+			LevelFlagAlert:     {Foreground: "bright_white", Background: "magenta", Effects: []string{"bold"}},
+			LevelFlagCritical:  {Foreground: "black", Background: "bright_red", Effects: []string{"bold"}},
+			LevelFlagError:     {Foreground: "bright_red", Effects: []string{"bold"}},
+			LevelFlagWarning:   {Foreground: "bright_yellow", Effects: []string{"bold"}},
+			LevelFlagNotice:    {Foreground: "bright_green", Effects: []string{"bold"}},
+			LevelFlagInfo:      {Foreground: "bright_cyan", Effects: []string{"bold"}},
+			LevelFlagDebug:     {Foreground: "bright_white"},
+		},
+		Lines: map[string]ColorStyle{
+			LevelFlagEmergency: {Foreground: "bright_white", Background: "red", Effects: []string{"bold"}},
+			LevelFlagAlert:     {Foreground: "bright_white", Background: "magenta", Effects: []string{"bold"}},
+			LevelFlagCritical:  {Foreground: "black", Background: "bright_red", Effects: []string{"bold"}},
+			LevelFlagError:     {Foreground: "bright_red", Effects: []string{"bold"}},
+			LevelFlagWarning:   {Foreground: "bright_yellow", Effects: []string{"bold"}},
+			LevelFlagNotice:    {Foreground: "bright_green", Effects: []string{"bold"}},
+			LevelFlagInfo:      {Foreground: "bright_cyan", Effects: []string{"bold"}},
+			LevelFlagDebug:     {Foreground: "bright_white"},
+		},
+		Timestamp: ColorStyle{Foreground: "bright_white"},
+		Caller:    ColorStyle{Foreground: "black", Background: "bright_white"},
+		Message:   ColorStyle{Foreground: "bright_white"},
+		FieldKey:  ColorStyle{Foreground: "bright_yellow"},
+	},
+}
+
+// consoleTheme the compiled theme brushes
+type consoleTheme struct {
+	levels    []brush
+	lines     []brush
+	timestamp brush
+	caller    brush
+	message   brush
+	fieldKey  brush
+}
+
+var (
+	colorNames = map[string]int{
+		"black":   0,
+		"red":     1,
+		"green":   2,
+		"yellow":  3,
+		"blue":    4,
+		"magenta": 5,
+		"purple":  5,
+		"cyan":    6,
+		"white":   7,
+		"grey":    7,
+		"gray":    7,
+	}
+
+	colorEffects = map[string]string{
+		"bold":      "1",
+		"dim":       "2",
+		"italic":    "3",
+		"underline": "4",
+		"blink":     "5",
+		"reverse":   "7",
+	}
+)
+
+// code return the SGR parameters of style, like "1;31;47"
+func (s ColorStyle) code() (string, error) {
+	codes := make([]string, 0, len(s.Effects)+2)
+	for _, e := range s.Effects {
+		c, ok := colorEffects[strings.ToLower(strings.TrimSpace(e))]
+		if !ok {
+			return "", fmt.Errorf("invalid color effect (%s)", e)
+		}
+		codes = append(codes, c)
+	}
+	if s.Foreground != "" {
+		c, err := colorCode(s.Foreground, false)
+		if err != nil {
+			return "", err
+		}
+		codes = append(codes, c)
+	}
+	if s.Background != "" {
+		c, err := colorCode(s.Background, true)
+		if err != nil {
+			return "", err
+		}
+		codes = append(codes, c)
+	}
+	return strings.Join(codes, ";"), nil
+}
+
+func (s ColorStyle) isEmpty() bool {
+	return s.Foreground == "" && s.Background == "" && len(s.Effects) == 0
+}
+
+// colorCode return the SGR parameter of color name, 256-color index or #rrggbb truecolor
+func colorCode(color string, background bool) (string, error) {
+	color = strings.ToLower(strings.TrimSpace(color))
+	base, extended := 30, 38
+	if background {
+		base, extended = 40, 48
+	}
+
+	if color == "default" {
+		return strconv.Itoa(base + 9), nil
+	}
+	if n, ok := colorNames[color]; ok {
+		return strconv.Itoa(base + n), nil
+	}
+	if strings.HasPrefix(color, "bright_") {
+		if n, ok := colorNames[strings.TrimPrefix(color, "bright_")]; ok {
+			return strconv.Itoa(base + 60 + n), nil
+		}
+	}
+	if strings.HasPrefix(color, "#") && len(color) == 7 {
+		rgb, err := strconv.ParseUint(color[1:], 16, 32)
+		if err == nil {
+			return fmt.Sprintf("%d;2;%d;%d;%d", extended, rgb>>16, (rgb>>8)&0xff, rgb&0xff), nil
+		}
+	}
+	if n, err := strconv.ParseUint(color, 10, 8); err == nil {
+		return fmt.Sprintf("%d;5;%d", extended, n), nil
+	}
+	return "", fmt.Errorf("invalid color (%s)", color)
+}
+
+// merge return the theme with the non-empty styles of custom override
+func (t ConsoleTheme) merge(custom ConsoleTheme) ConsoleTheme {
+	merged := ConsoleTheme{
+		Levels:    make(map[string]ColorStyle, len(LevelFlags)),
+		Lines:     make(map[string]ColorStyle, len(LevelFlags)),
+		Timestamp: t.Timestamp,
+		Caller:    t.Caller,
+		Message:   t.Message,
+		FieldKey:  t.FieldKey,
+	}
+	for k, v := range t.Levels {
+		merged.Levels[k] = v
+	}
+	for k, v := range t.Lines {
+		merged.Lines[k] = v
+	}
+	for k, v := range custom.Levels {
+		merged.Levels[themeLevelFlag(k)] = v
+	}
+	for k, v := range custom.Lines {
+		merged.Lines[themeLevelFlag(k)] = v
+	}
+	for _, s := range []struct {
+		dst *ColorStyle
+		src ColorStyle
+	}{
+		{&merged.Timestamp, custom.Timestamp},
+		{&merged.Caller, custom.Caller},
+		{&merged.Message, custom.Message},
+		{&merged.FieldKey, custom.FieldKey},
+	} {
+		if !s.src.isEmpty() {
+			*s.dst = s.src
+		}
+	}
+	return merged
+}
+
+// compile compile the theme to brushes
+func (t ConsoleTheme) compile() (*consoleTheme, error) {
+	for k := range t.Levels {
+		if !isLevelFlag(themeLevelFlag(k)) {
+			return nil, fmt.Errorf("invalid theme level (%s)", k)
+		}
+	}
+	for k := range t.Lines {
+		if !isLevelFlag(themeLevelFlag(k)) {
+			return nil, fmt.Errorf("invalid theme level (%s)", k)
+		}
+	}
+
+	ct := &consoleTheme{
+		levels: make([]brush, len(LevelFlags)),
+		lines:  make([]brush, len(LevelFlags)),
+	}
+	var err error
+	for i, flag := range LevelFlags {
+		if ct.levels[i], err = styleBrush(t.Levels[flag]); err != nil {
+			return nil, err
+		}
+		if ct.lines[i], err = styleBrush(t.Lines[flag]); err != nil {
+			return nil, err
+		}
+	}
+	if ct.timestamp, err = styleBrush(t.Timestamp); err != nil {
+		return nil, err
+	}
+	if ct.caller, err = styleBrush(t.Caller); err != nil {
+		return nil, err
+	}
+	if ct.message, err = styleBrush(t.Message); err != nil {
+		return nil, err
+	}
+	if ct.fieldKey, err = styleBrush(t.FieldKey); err != nil {
+		return nil, err
+	}
+	return ct, nil
+}
+
+// newConsoleTheme compile the named built-in theme with the custom override
+func newConsoleTheme(name string, custom *ConsoleTheme) (*consoleTheme, error) {
+	if name == "" {
+		name = ThemeDark
+	}
+	theme, ok := ConsoleThemes[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("invalid console theme (%s)", name)
+	}
+	if custom != nil {
+		theme = theme.merge(*custom)
+	}
+	return theme.compile()
+}
+
+func styleBrush(s ColorStyle) (brush, error) {
+	code, err := s.code()
+	if err != nil {
+		return nil, err
+	}
+	return newBrush(code), nil
+}
+
+// themeLevelFlag normalize the level flag of theme key, WARN == WARNING
+func themeLevelFlag(flag string) string {
+	flag = strings.ToUpper(strings.TrimSpace(flag))
+	if flag == LevelFlagWarn {
+		return LevelFlagWarning
+	}
+	return flag
+}
+
+func isLevelFlag(flag string) bool {
+	for _, f := range LevelFlags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultConsoleTheme the compiled default theme
+var defaultConsoleTheme, _ = newConsoleTheme(ThemeDark, nil)
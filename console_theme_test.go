@@ -0,0 +1,131 @@
+package log4go
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func Test_ColorCode(t *testing.T) {
+	cases := []struct {
+		color      string
+		background bool
+		want       string
+	}{
+		{"red", false, "31"},
+		{"Purple", false, "35"},
+		{"white", true, "47"},
+		{"bright_red", false, "91"},
+		{"bright_black", true, "100"},
+		{"default", false, "39"},
+		{"208", false, "38;5;208"},
+		{"0", true, "48;5;0"},
+		{"#ff8800", false, "38;2;255;136;0"},
+		{"#000010", true, "48;2;0;0;16"},
+	}
+	for _, c := range cases {
+		got, err := colorCode(c.color, c.background)
+		if err != nil {
+			t.Errorf("color(%s) err: %v", c.color, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("color(%s) background(%v) got %s, want %s", c.color, c.background, got, c.want)
+		}
+	}
+
+	for _, color := range []string{"pink", "256", "#ff88", "#gg0000", "bright_"} {
+		if _, err := colorCode(color, false); err == nil {
+			t.Errorf("color(%s) should be invalid", color)
+		}
+	}
+}
+
+func Test_ColorStyleCode(t *testing.T) {
+	s := ColorStyle{Foreground: "black", Background: "white", Effects: []string{"bold", "underline"}}
+	code, err := s.code()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "1;4;30;47" {
+		t.Errorf("style code got %s, want 1;4;30;47", code)
+	}
+
+	if _, err := (ColorStyle{Effects: []string{"shiny"}}).code(); err == nil {
+		t.Error("effect shiny should be invalid")
+	}
+}
+
+func Test_ConsoleThemeBuiltin(t *testing.T) {
+	for name := range ConsoleThemes {
+		if _, err := newConsoleTheme(name, nil); err != nil {
+			t.Errorf("built-in theme %s err: %v", name, err)
+		}
+	}
+	if _, err := newConsoleTheme("no-such-theme", nil); err == nil {
+		t.Error("theme no-such-theme should be invalid")
+	}
+
+	r := &colorRecord{level: ERROR, time: "2006/01/02 15:04:05", file: "theme_test.go:1", msg: "theme"}
+	want := "\033[36m2006/01/02 15:04:05\033[0m [\033[31mERROR\033[0m] \033[30;47mtheme_test.go:1\033[0m theme\n"
+	if got := r.PartColorString(defaultConsoleTheme); got != want {
+		t.Errorf("dark theme got %q, want %q", got, want)
+	}
+	want = "\033[1;31m2006/01/02 15:04:05 ERROR theme_test.go:1 theme\n\033[0m"
+	if got := r.ColorString(defaultConsoleTheme); got != want {
+		t.Errorf("dark theme full color got %q, want %q", got, want)
+	}
+}
+
+func Test_NewConsoleWriterWithThemeConfig(t *testing.T) {
+	var out bytes.Buffer
+	var options ConsoleWriterOptions
+	config := `{
+  "color_mode": "always",
+  "theme": "light",
+  "theme_config": {
+    "levels": {"warn": {"fg": "#ffaf00", "effects": ["bold"]}},
+    "timestamp": {"fg": "244"},
+    "caller": {"fg": "default"}
+  }
+}`
+	if err := json.Unmarshal([]byte(config), &options); err != nil {
+		t.Fatal(err)
+	}
+	options.Output = &out
+	w := NewConsoleWriterWithOptions(options)
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = w.Write(&Record{level: WARNING, time: "2006/01/02 15:04:05", file: "theme_test.go:1", msg: "theme"})
+	want := "\033[38;5;244m2006/01/02 15:04:05\033[0m [\033[1;38;2;255;175;0mWARNING\033[0m] \033[39mtheme_test.go:1\033[0m theme\n"
+	if out.String() != want {
+		t.Errorf("custom theme got %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	_ = w.Write(&Record{level: DEBUG, time: "2006/01/02 15:04:05", file: "theme_test.go:1", msg: "theme"})
+	want = "\033[38;5;244m2006/01/02 15:04:05\033[0m [\033[90mDEBUG\033[0m] \033[39mtheme_test.go:1\033[0m theme\n"
+	if out.String() != want {
+		t.Errorf("light theme got %q, want %q", out.String(), want)
+	}
+}
+
+func Test_NewConsoleWriterWithErrorTheme(t *testing.T) {
+	w := NewConsoleWriterWithOptions(ConsoleWriterOptions{
+		ThemeConfig: &ConsoleTheme{Levels: map[string]ColorStyle{"VERBOSE": {Foreground: "red"}}},
+	})
+	if err := w.Init(); err == nil {
+		t.Error("theme level VERBOSE should be invalid")
+	}
+	if err := w.SetTheme(ConsoleTheme{Message: ColorStyle{Foreground: "pink"}}); err == nil {
+		t.Error("theme message color pink should be invalid")
+	}
+	if err := w.SetTheme(ConsoleTheme{Message: ColorStyle{Foreground: "bright_white"}}); err != nil {
+		t.Error(err)
+	}
+	if err := w.Init(); err != nil {
+		t.Errorf("valid theme should clear the theme error, got %v", err)
+	}
+}
@@ -2,7 +2,20 @@ package log4go
 
 import (
 	"fmt"
+	"io"
+	"log"
 	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// ColorMode console color mode
+const (
+	ColorModeAuto   = "auto"   // color only if the output is a terminal, honour NO_COLOR, FORCE_COLOR and TERM=dumb
+	ColorModeAlways = "always" // always color
+	ColorModeNever  = "never"  // never color
 )
 
 type colorRecord Record
@@ -10,8 +23,13 @@ type colorRecord Record
 // brush is a color join function
 type brush func(string) string
 
-// newBrush return a fix color Brush
+// newBrush return a fix color Brush, empty color means no color
 func newBrush(color string) brush {
+	if color == "" {
+		return func(text string) string {
+			return text
+		}
+	}
 	pre := "\033["
 	reset := "\033[0m"
 	return func(text string) string {
@@ -19,85 +37,77 @@ func newBrush(color string) brush {
 	}
 }
 
-// effect: 0~8
-// 0:no, 1: Highlight (deepen) display, 2: Low light (dimmed) display,
-// 4: underline, 5: blink, 7: Reverse display (replace background color and font color)
-// 8: blank
-
-// font color: 30~39
-// 30: black, 31: red, 32: green, 33: yellow, 34: blue, 35: purple, 36: dark green, 37: grey
-// 38: Sets the underline on the default foreground color, 39: Turn off underlining on the default foreground color
-
-// background color: 40~49
-// 40: black, 41: red, 42: green, 43: yellow, 44: blue, 45: purple, 46: dark green, 47: grey
-
-// (background;font;effect)
-var colors = []brush{
-	newBrush("1;31"), // Emergency          red
-	newBrush("1;36"), // Alert              dark green
-	newBrush("1;35"), // Critical           purple
-	newBrush("1;31"), // Error              red
-	newBrush("1;33"), // Warning            yellow
-	newBrush("1;32"), // Notice             green
-	newBrush("1;34"), // Informational      blue
-	newBrush("2;37"), // Debug              grey
-}
-
-func (r *colorRecord) ColorString() string {
-	inf := fmt.Sprintf("%s %s %s %s\n", r.time, LevelFlags[r.level], r.file, r.msg)
-	return colors[r.level](inf)
-}
-
-func (r *colorRecord) String() string {
-	inf := ""
-	switch r.level {
-	case EMERGENCY:
-		inf = fmt.Sprintf("\033[36m%s\033[0m [\033[31m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LevelFlags[r.level], r.file, r.msg)
-	case ALERT:
-		inf = fmt.Sprintf("\033[36m%s\033[0m [\033[36m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LevelFlags[r.level], r.file, r.msg)
-	case CRITICAL:
-		inf = fmt.Sprintf("\033[36m%s\033[0m [\033[35m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LevelFlags[r.level], r.file, r.msg)
-	case ERROR:
-		inf = fmt.Sprintf("\033[36m%s\033[0m [\033[31m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LevelFlags[r.level], r.file, r.msg)
-	case WARNING:
-		inf = fmt.Sprintf("\033[36m%s\033[0m [\033[33m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LevelFlags[r.level], r.file, r.msg)
-	case NOTICE:
-		inf = fmt.Sprintf("\033[36m%s\033[0m [\033[32m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LevelFlags[r.level], r.file, r.msg)
-	case INFO:
-		inf = fmt.Sprintf("\033[36m%s\033[0m [\033[34m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LevelFlags[r.level], r.file, r.msg)
-	case DEBUG:
-		inf = fmt.Sprintf("\033[36m%s\033[0m [\033[44m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LevelFlags[r.level], r.file, r.msg)
-	}
-
-	return inf
+// ColorString full line color string
+func (r *colorRecord) ColorString(t *consoleTheme) string {
+	inf := fmt.Sprintf("%s %s %s %s%s\n", r.time, LevelFlags[r.level], r.file, r.msg, formatFields(r.fields, nil, nil))
+	return t.lines[r.level](inf)
+}
+
+// PartColorString color string by parts
+func (r *colorRecord) PartColorString(t *consoleTheme) string {
+	return fmt.Sprintf("%s [%s] %s %s%s\n", t.timestamp(r.time), t.levels[r.level](LevelFlags[r.level]),
+		t.caller(r.file), t.message(r.msg), formatFields(r.fields, t.fieldKey, nil))
 }
 
 // ConsoleWriter console writer define
 type ConsoleWriter struct {
 	level     int
-	color     bool
+	colorMode string
 	fullColor bool // line all with color
+	outColor  bool // resolved color for out
+	errColor  bool // resolved color for errOut
+
+	out       io.Writer // default os.Stdout
+	errOut    io.Writer // default os.Stderr
+	errLevel  int       // records with level <= errLevel write to errOut, -1 means never
+	stderrErr error     // invalid stderr level, return by Init
+
+	theme    *consoleTheme
+	themeErr error // invalid theme, return by Init
+
+	pretty      bool      // pretty mode
+	start       time.Time // the relative timestamp start of pretty mode
+	callerWidth int       // the caller column width of pretty mode
 }
 
 // ConsoleWriterOptions color field options
 type ConsoleWriterOptions struct {
 	Enable    bool   `json:"enable" mapstructure:"enable"`
-	Color     bool   `json:"color" mapstructure:"color"`
+	Color     bool   `json:"color" mapstructure:"color"` // deprecated, true means color_mode always if color_mode not set
 	FullColor bool   `json:"full_color" mapstructure:"full_color"`
 	Level     string `json:"level" mapstructure:"level"`
+
+	// ColorMode auto, always or never, default auto
+	ColorMode string `json:"color_mode" mapstructure:"color_mode"`
+
+	// StderrLevel records with this level and above write to stderr, ex: WARNING, empty means never
+	StderrLevel string `json:"stderr_level" mapstructure:"stderr_level"`
+
+	// Output and ErrOutput replace the os.Stdout and os.Stderr, can only set by code
+	Output    io.Writer `json:"-" mapstructure:"-"`
+	ErrOutput io.Writer `json:"-" mapstructure:"-"`
+
+	// Theme built-in theme name: dark, light or high_contrast, default dark
+	Theme string `json:"theme" mapstructure:"theme"`
+	// ThemeConfig custom theme, the non-empty styles override the Theme
+	ThemeConfig *ConsoleTheme `json:"theme_config" mapstructure:"theme_config"`
+
+	// Mode default or pretty, the pretty mode is human-oriented for local development
+	Mode string `json:"mode" mapstructure:"mode"`
 }
 
 // NewConsoleWriter create new console writer
 func NewConsoleWriter() *ConsoleWriter {
-	return &ConsoleWriter{}
+	w := &ConsoleWriter{
+		colorMode: ColorModeAuto,
+		out:       os.Stdout,
+		errOut:    os.Stderr,
+		errLevel:  -1,
+		theme:     defaultConsoleTheme,
+		start:     time.Now(),
+	}
+	w.detectColor()
+	return w
 }
 
 // NewConsoleWriterWithOptions create new console writer with level
@@ -108,11 +118,57 @@ func NewConsoleWriterWithOptions(options ConsoleWriterOptions) *ConsoleWriter {
 		defaultLevel = getLevelDefault(options.Level, defaultLevel, "")
 	}
 
-	return &ConsoleWriter{
+	errLevel := -1
+	var stderrErr error
+	if len(options.StderrLevel) > 0 {
+		if level, ok := lookupLevel(options.StderrLevel); ok {
+			errLevel = level
+		} else {
+			stderrErr = fmt.Errorf("console writer invalid stderr_level (%s)", options.StderrLevel)
+			log.Printf("[log4go] %v, never write to stderr", stderrErr.Error())
+		}
+	}
+
+	colorMode := strings.ToLower(strings.TrimSpace(options.ColorMode))
+	if colorMode == "" && options.Color {
+		// the legacy color option forced the color on
+		colorMode = ColorModeAlways
+	}
+	switch colorMode {
+	case ColorModeAuto, ColorModeAlways, ColorModeNever:
+	default:
+		colorMode = ColorModeAuto
+	}
+
+	w := &ConsoleWriter{
 		level:     defaultLevel,
-		color:     options.Color,
+		colorMode: colorMode,
 		fullColor: options.FullColor,
+		out:       os.Stdout,
+		errOut:    os.Stderr,
+		errLevel:  errLevel,
+		stderrErr: stderrErr,
+		pretty:    strings.EqualFold(options.Mode, ConsoleModePretty),
+		start:     time.Now(),
+	}
+	if options.Output != nil {
+		w.out = options.Output
 	}
+	if options.ErrOutput != nil {
+		w.errOut = options.ErrOutput
+	}
+	w.detectColor()
+
+	w.theme = defaultConsoleTheme
+	if options.Theme != "" || options.ThemeConfig != nil {
+		if theme, err := newConsoleTheme(options.Theme, options.ThemeConfig); err == nil {
+			w.theme = theme
+		} else {
+			w.themeErr = err
+			log.Printf("[log4go] console writer theme err: %v", err.Error())
+		}
+	}
+	return w
 }
 
 // Write console write
@@ -120,29 +176,141 @@ func (w *ConsoleWriter) Write(r *Record) error {
 	if r.level > w.level {
 		return nil
 	}
-	if w.color {
+	out, color := w.output(r.level)
+	if w.pretty {
+		_, _ = fmt.Fprint(out, w.prettyString(r, color))
+		return nil
+	}
+	if color {
+		theme := w.theme
+		if theme == nil {
+			theme = defaultConsoleTheme
+		}
 		if w.fullColor {
-			_, _ = fmt.Fprint(os.Stdout, ((*colorRecord)(r)).ColorString())
+			_, _ = fmt.Fprint(out, ((*colorRecord)(r)).ColorString(theme))
 		} else {
-			_, _ = fmt.Fprint(os.Stdout, ((*colorRecord)(r)).String())
+			_, _ = fmt.Fprint(out, ((*colorRecord)(r)).PartColorString(theme))
 		}
 	} else {
-		_, _ = fmt.Fprint(os.Stdout, r.String())
+		_, _ = fmt.Fprint(out, r.String())
 	}
 	return nil
 }
 
-// Init console init without implement
+// output return the target writer for the level and if it should be colored
+func (w *ConsoleWriter) output(level int) (io.Writer, bool) {
+	if level <= w.errLevel {
+		if w.errOut == nil {
+			return os.Stderr, w.errColor
+		}
+		return w.errOut, w.errColor
+	}
+	if w.out == nil {
+		return os.Stdout, w.outColor
+	}
+	return w.out, w.outColor
+}
+
+// detectColor resolve the color for outputs by color mode, should call after the mode or outputs changed
+func (w *ConsoleWriter) detectColor() {
+	w.outColor = resolveColor(w.colorMode, w.out)
+	w.errColor = resolveColor(w.colorMode, w.errOut)
+}
+
+// resolveColor return whether the output should be colored by the mode
+func resolveColor(mode string, out io.Writer) bool {
+	switch mode {
+	case ColorModeAlways:
+		return true
+	case ColorModeNever:
+		return false
+	}
+
+	// ref: https://no-color.org
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	if force, ok := os.LookupEnv("FORCE_COLOR"); ok {
+		switch strings.ToLower(force) {
+		case "0", "false", "no", "off":
+			return false
+		}
+		return true
+	}
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(out)
+}
+
+// isTerminal return true if the writer is a terminal, not the other char devices like /dev/null
+func isTerminal(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	if !ok || f == nil {
+		return false
+	}
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// Init console init, resolve the color for outputs
 func (w *ConsoleWriter) Init() error {
-	return nil
+	w.detectColor()
+	if w.stderrErr != nil {
+		return w.stderrErr
+	}
+	return w.themeErr
 }
 
-// SetColor console output color control
+// SetColor console output color control, true means always and false means never
 func (w *ConsoleWriter) SetColor(c bool) {
-	w.color = c
+	if c {
+		w.SetColorMode(ColorModeAlways)
+	} else {
+		w.SetColorMode(ColorModeNever)
+	}
+}
+
+// SetColorMode console output color mode: auto, always or never
+func (w *ConsoleWriter) SetColorMode(mode string) {
+	w.colorMode = mode
+	w.detectColor()
 }
 
 // SetFullColor console output full line color control
 func (w *ConsoleWriter) SetFullColor(c bool) {
 	w.fullColor = c
 }
+
+// SetPretty console output with pretty mode
+func (w *ConsoleWriter) SetPretty(pretty bool) {
+	w.pretty = pretty
+}
+
+// SetTheme set the console color theme, the empty styles use the dark theme
+func (w *ConsoleWriter) SetTheme(theme ConsoleTheme) error {
+	t, err := ConsoleThemes[ThemeDark].merge(theme).compile()
+	if err != nil {
+		return err
+	}
+	w.theme = t
+	w.themeErr = nil
+	return nil
+}
+
+// SetOutput set the writer for records, default os.Stdout
+func (w *ConsoleWriter) SetOutput(out io.Writer) {
+	w.out = out
+	w.detectColor()
+}
+
+// SetErrOutput set the writer for records reach the stderr level, default os.Stderr
+func (w *ConsoleWriter) SetErrOutput(out io.Writer) {
+	w.errOut = out
+	w.detectColor()
+}
+
+// SetStderrLevel records with the level and above write to the err output, -1 means never
+func (w *ConsoleWriter) SetStderrLevel(level int) {
+	w.errLevel = level
+	w.stderrErr = nil
+}
@@ -1,6 +1,10 @@
 package log4go
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -303,3 +307,154 @@ func Benchmark_NewConsoleWriterAll(b *testing.B) {
 	loggerDefaultTest.Emergency("log4go by %s", name)
 	loggerDefaultTest.Alert("%#v", loggerDefaultTest)
 }
+
+func Test_NewConsoleWriterWithStderrLevel(t *testing.T) {
+	var out, errOut bytes.Buffer
+	c := NewConsoleWriterWithOptions(ConsoleWriterOptions{
+		Level:       LevelFlagDebug,
+		StderrLevel: LevelFlagWarning,
+		Output:      &out,
+		ErrOutput:   &errOut,
+	})
+
+	for level := range LevelFlags {
+		_ = c.Write(&Record{level: level, time: "2006/01/02 15:04:05", file: "console_writer_test.go:1", msg: LevelFlags[level]})
+	}
+
+	for level, flag := range LevelFlags {
+		toErr := strings.Contains(errOut.String(), "["+flag+"]")
+		toOut := strings.Contains(out.String(), "["+flag+"]")
+		if level <= WARNING && (!toErr || toOut) {
+			t.Errorf("level %s should only write to err output", flag)
+		}
+		if level > WARNING && (toErr || !toOut) {
+			t.Errorf("level %s should only write to output", flag)
+		}
+	}
+}
+
+func Test_NewConsoleWriterWithInvalidStderrLevel(t *testing.T) {
+	var out, errOut bytes.Buffer
+	c := NewConsoleWriterWithOptions(ConsoleWriterOptions{
+		StderrLevel: "WARN1",
+		Output:      &out,
+		ErrOutput:   &errOut,
+	})
+	if err := c.Init(); err == nil || !strings.Contains(err.Error(), "WARN1") {
+		t.Errorf("init got %v, want invalid stderr_level", err)
+	}
+	_ = c.Write(&Record{level: EMERGENCY, time: "2006/01/02 15:04:05", file: "console_writer_test.go:1", msg: "output"})
+	if out.Len() == 0 || errOut.Len() != 0 {
+		t.Errorf("record should write to output, out: %q, err: %q", out.String(), errOut.String())
+	}
+}
+
+func Test_NewConsoleWriterWithOutput(t *testing.T) {
+	var out bytes.Buffer
+	c := NewConsoleWriter()
+	c.level = DEBUG
+	c.SetOutput(&out)
+
+	_ = c.Write(&Record{level: EMERGENCY, time: "2006/01/02 15:04:05", file: "console_writer_test.go:1", msg: "output"})
+	if out.String() != "2006/01/02 15:04:05 [EMERGENCY] <console_writer_test.go:1> output\n" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+
+	out.Reset()
+	var errOut bytes.Buffer
+	c.SetErrOutput(&errOut)
+	c.SetStderrLevel(ERROR)
+	_ = c.Write(&Record{level: ERROR, time: "2006/01/02 15:04:05", file: "console_writer_test.go:1", msg: "err output"})
+	if out.Len() != 0 || errOut.Len() == 0 {
+		t.Errorf("error record should write to err output, out: %q, err: %q", out.String(), errOut.String())
+	}
+}
+
+func setColorEnv(env map[string]string) func() {
+	keys := []string{"NO_COLOR", "FORCE_COLOR", "TERM"}
+	old := make(map[string]*string, len(keys))
+	for _, k := range keys {
+		if v, ok := os.LookupEnv(k); ok {
+			old[k] = &v
+		}
+		if v, ok := env[k]; ok {
+			_ = os.Setenv(k, v)
+		} else {
+			_ = os.Unsetenv(k)
+		}
+	}
+	return func() {
+		for _, k := range keys {
+			if v := old[k]; v != nil {
+				_ = os.Setenv(k, *v)
+			} else {
+				_ = os.Unsetenv(k)
+			}
+		}
+	}
+}
+
+func Test_NewConsoleWriterWithColorMode(t *testing.T) {
+	var out bytes.Buffer
+	cases := []struct {
+		mode  string
+		color bool // the legacy color option
+		env   map[string]string
+		want  bool
+	}{
+		{ColorModeAuto, false, nil, false},
+		{ColorModeAuto, false, map[string]string{"FORCE_COLOR": "1"}, true},
+		{ColorModeAuto, false, map[string]string{"FORCE_COLOR": "0"}, false},
+		{ColorModeAuto, false, map[string]string{"FORCE_COLOR": "1", "NO_COLOR": "1"}, false},
+		{ColorModeAuto, false, map[string]string{"FORCE_COLOR": "1", "TERM": "dumb"}, true},
+		{"", false, map[string]string{"FORCE_COLOR": "1"}, true},
+		{ColorModeAlways, false, map[string]string{"NO_COLOR": "1"}, true},
+		{ColorModeNever, false, map[string]string{"FORCE_COLOR": "1"}, false},
+		{"", true, nil, true},
+		{"", false, map[string]string{"FORCE_COLOR": "1"}, true},
+		{ColorModeNever, true, nil, false},
+	}
+
+	for _, c := range cases {
+		restore := setColorEnv(c.env)
+		w := NewConsoleWriterWithOptions(ConsoleWriterOptions{ColorMode: c.mode, Color: c.color, Output: &out})
+		out.Reset()
+		_ = w.Write(&Record{level: ERROR, time: "2006/01/02 15:04:05", file: "console_writer_test.go:1", msg: "color mode"})
+		restore()
+
+		if got := strings.Contains(out.String(), "\033["); got != c.want {
+			t.Errorf("mode(%q) env(%v) color got %v, want %v", c.mode, c.env, got, c.want)
+		}
+	}
+}
+
+func Test_NewConsoleWriterWithTerminalDetect(t *testing.T) {
+	restore := setColorEnv(nil)
+	defer restore()
+
+	f, err := ioutil.TempFile("", "log4go-console")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if resolveColor(ColorModeAuto, f) {
+		t.Error("regular file should not be colored in auto mode")
+	}
+	if resolveColor(ColorModeAuto, &bytes.Buffer{}) {
+		t.Error("buffer should not be colored in auto mode")
+	}
+	if null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+		defer null.Close()
+		if resolveColor(ColorModeAuto, null) {
+			t.Error("null device should not be colored in auto mode")
+		}
+	}
+	if tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0); err == nil {
+		defer tty.Close()
+		if !resolveColor(ColorModeAuto, tty) {
+			t.Error("tty should be colored in auto mode")
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package log4go
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// elasticsearch bulk op types
+const (
+	ESOpTypeIndex  = "index"  // default
+	ESOpTypeCreate = "create" // required by the data streams
+)
+
+const esIndexDefault = "logs-%Y.%M.%D"
+
+// ElasticsearchWriterOptions elasticsearch writer options
+type ElasticsearchWriterOptions struct {
+	Enable bool   `json:"enable" mapstructure:"enable"`
+	Level  string `json:"level" mapstructure:"level"`
+	URL    string `json:"url" mapstructure:"url"` // ex: http://127.0.0.1:9200
+
+	// Index the index pattern by the record time, support %Y %M %D %H %m like the file writer, default logs-%Y.%M.%D
+	Index    string `json:"index" mapstructure:"index"`
+	OpType   string `json:"op_type" mapstructure:"op_type"`   // index or create, default index
+	Pipeline string `json:"pipeline" mapstructure:"pipeline"` // optional, the ingest pipeline
+
+	Username string `json:"username" mapstructure:"username"` // optional, basic auth
+	Password string `json:"password" mapstructure:"password"`
+	APIKey   string `json:"api_key" mapstructure:"api_key"` // optional, the base64 encoded api key
+
+	HTTPBatchOptions `mapstructure:",squash"`
+}
+
+// ElasticsearchWriter write the records by the elasticsearch bulk api
+type ElasticsearchWriter struct {
+	level   int
+	options ElasticsearchWriterOptions
+	batcher *httpBatcher
+
+	indexFmt     string
+	indexActions []func(*time.Time) int
+	bulkURL      string
+	header       http.Header
+}
+
+// NewElasticsearchWriter create new elasticsearch writer
+func NewElasticsearchWriter(options ElasticsearchWriterOptions) *ElasticsearchWriter {
+	defaultLevel := DEBUG
+	if len(options.Level) > 0 {
+		defaultLevel = getLevelDefault(options.Level, defaultLevel, "")
+	}
+	return &ElasticsearchWriter{
+		level:   defaultLevel,
+		options: options,
+	}
+}
+
+// Init check the options and start the batcher
+func (w *ElasticsearchWriter) Init() (err error) {
+	options := &w.options
+	if options.URL == "" {
+		return errors.New("elasticsearch writer requires url")
+	}
+	switch options.OpType {
+	case "":
+		options.OpType = ESOpTypeIndex
+	case ESOpTypeIndex, ESOpTypeCreate:
+	default:
+		return fmt.Errorf("elasticsearch writer invalid op_type (%s)", options.OpType)
+	}
+	if options.Index == "" {
+		options.Index = esIndexDefault
+	}
+	if w.indexFmt, w.indexActions, err = parsePathPattern(options.Index); err != nil {
+		return fmt.Errorf("elasticsearch writer invalid index (%s)", options.Index)
+	}
+
+	w.bulkURL = strings.TrimRight(options.URL, "/") + "/_bulk"
+	if options.Pipeline != "" {
+		w.bulkURL += "?pipeline=" + url.QueryEscape(options.Pipeline)
+	}
+	w.header = make(http.Header)
+	if options.APIKey != "" {
+		w.header.Set("Authorization", "ApiKey "+options.APIKey)
+	} else if options.Username != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(options.Username + ":" + options.Password))
+		w.header.Set("Authorization", "Basic "+auth)
+	}
+
+	if w.batcher, err = newHTTPBatcher("elasticsearch writer", http.MethodPost, options.HTTPBatchOptions); err != nil {
+		return err
+	}
+	w.batcher.build = w.buildBulk
+	w.batcher.check = esCheckBulk
+	w.batcher.start()
+	return nil
+}
+
+// index the index name of the record time
+func (w *ElasticsearchWriter) index(t time.Time) string {
+	if len(w.indexActions) == 0 {
+		return w.indexFmt
+	}
+	variables := make([]interface{}, len(w.indexActions))
+	for i, act := range w.indexActions {
+		variables[i] = act(&t)
+	}
+	return fmt.Sprintf(w.indexFmt, variables...)
+}
+
+// Write encode the record to the bulk action and document lines, add them to the batch
+func (w *ElasticsearchWriter) Write(r *Record) error {
+	if r.level > w.level {
+		return nil
+	}
+	if w.batcher == nil {
+		return errors.New("elasticsearch writer not running")
+	}
+
+	action, err := json.Marshal(map[string]interface{}{
+		w.options.OpType: map[string]string{"_index": w.index(recordTime(r))},
+	})
+	if err != nil {
+		return err
+	}
+	doc, err := json.Marshal(recordJSONBody(r, "@timestamp"))
+	if err != nil {
+		return err
+	}
+
+	item := make([]byte, 0, len(action)+len(doc)+2)
+	item = append(append(item, action...), '\n')
+	item = append(append(item, doc...), '\n')
+	return w.batcher.add(item)
+}
+
+func (w *ElasticsearchWriter) buildBulk(items [][]byte) (*httpPayload, error) {
+	return &httpPayload{
+		url:         w.bulkURL,
+		body:        bytes.Join(items, nil),
+		contentType: "application/x-ndjson",
+		header:      w.header,
+	}, nil
+}
+
+// esBulkResponse the bulk api response, the item is keyed by the op type
+type esBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// esCheckBulk the items rejected by 429 or 5xx are retried, the other failed items are discarded
+func esCheckBulk(items [][]byte, body []byte) ([][]byte, int, error) {
+	var resp esBulkResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, len(items), fmt.Errorf("invalid bulk response: %v", err)
+	}
+	if !resp.Errors {
+		return nil, 0, nil
+	}
+	if len(resp.Items) != len(items) {
+		return nil, len(items), fmt.Errorf("bulk response has %d items, want %d", len(resp.Items), len(items))
+	}
+
+	var retry [][]byte
+	var failed int
+	var first string
+	for i, item := range resp.Items {
+		for _, result := range item {
+			if result.Status < 300 {
+				continue
+			}
+			if first == "" && result.Error != nil {
+				first = fmt.Sprintf("%d %s: %s", result.Status, result.Error.Type, result.Error.Reason)
+			}
+			if result.Status == http.StatusTooManyRequests || result.Status >= 500 {
+				retry = append(retry, items[i])
+			} else {
+				failed++
+			}
+		}
+	}
+	if len(retry) == 0 && failed == 0 {
+		return nil, 0, nil
+	}
+	return retry, failed, fmt.Errorf("bulk %d items rejected, %d to retry, first error: %s", len(retry)+failed, len(retry), first)
+}
+
+// Dropped return the number of records dropped by the full queue
+func (w *ElasticsearchWriter) Dropped() int64 {
+	if w.batcher == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&w.batcher.dropped)
+}
+
+// Failed return the number of records failed to index after retries
+func (w *ElasticsearchWriter) Failed() int64 {
+	if w.batcher == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&w.batcher.failed)
+}
+
+// Close send the buffered records within the close timeout
+func (w *ElasticsearchWriter) Close() error {
+	if w.batcher == nil {
+		return nil
+	}
+	return w.batcher.close()
+}
@@ -0,0 +1,178 @@
+package log4go
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// esTestBulk the received bulk request
+type esTestBulk struct {
+	query   string
+	auth    string
+	actions []map[string]map[string]string
+	docs    []map[string]interface{}
+}
+
+// newESTestServer decode the bulk requests, respond decide the response body of the nth request
+func newESTestServer(t *testing.T, respond func(n int, bulk *esTestBulk) string) (*httptest.Server, func() []*esTestBulk) {
+	var lock sync.Mutex
+	var bulks []*esTestBulk
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		bulk := &esTestBulk{query: r.URL.RawQuery, auth: r.Header.Get("Authorization")}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			var action map[string]map[string]string
+			if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+				t.Error(err)
+			}
+			scanner.Scan()
+			var doc map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+				t.Error(err)
+			}
+			bulk.actions = append(bulk.actions, action)
+			bulk.docs = append(bulk.docs, doc)
+		}
+
+		lock.Lock()
+		bulks = append(bulks, bulk)
+		n := len(bulks)
+		lock.Unlock()
+		_, _ = w.Write([]byte(respond(n, bulk)))
+	}))
+	return server, func() []*esTestBulk {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]*esTestBulk(nil), bulks...)
+	}
+}
+
+func Test_ElasticsearchWriterBulk(t *testing.T) {
+	server, bulks := newESTestServer(t, func(n int, bulk *esTestBulk) string {
+		return `{"took": 1, "errors": false, "items": []}`
+	})
+	defer server.Close()
+
+	w := NewElasticsearchWriter(ElasticsearchWriterOptions{
+		URL:              server.URL + "/",
+		Pipeline:         "logs pipeline",
+		Username:         "log4go",
+		Password:         "secret",
+		HTTPBatchOptions: HTTPBatchOptions{BatchSize: 2, FlushInterval: time.Hour},
+	})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	for day := 1; day <= 2; day++ {
+		r := &Record{level: ERROR, msg: fmt.Sprintf("es %d", day), now: time.Date(2021, 6, day, 8, 0, 0, 0, time.Local)}
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := bulks()
+	if len(got) != 1 || len(got[0].docs) != 2 {
+		t.Fatalf("bulks got %d", len(got))
+	}
+	bulk := got[0]
+	if bulk.query != "pipeline=logs+pipeline" || bulk.auth != "Basic bG9nNGdvOnNlY3JldA==" {
+		t.Errorf("unexpected query %s, auth %s", bulk.query, bulk.auth)
+	}
+	for i, index := range []string{"logs-2021.06.01", "logs-2021.06.02"} {
+		if bulk.actions[i]["index"]["_index"] != index {
+			t.Errorf("action %d got %v, want index %s", i, bulk.actions[i], index)
+		}
+		doc := bulk.docs[i]
+		if doc["message"] != fmt.Sprintf("es %d", i+1) || doc["level"] != LevelFlagError || doc["@timestamp"] == nil {
+			t.Errorf("doc %d got %v", i, doc)
+		}
+	}
+}
+
+func Test_ElasticsearchWriterRetryFailedItems(t *testing.T) {
+	server, bulks := newESTestServer(t, func(n int, bulk *esTestBulk) string {
+		if n > 1 {
+			return `{"errors": false, "items": [{"create": {"status": 201}}]}`
+		}
+		return `{"errors": true, "items": [
+  {"create": {"status": 201}},
+  {"create": {"status": 429, "error": {"type": "es_rejected_execution_exception", "reason": "queue full"}}},
+  {"create": {"status": 400, "error": {"type": "mapper_parsing_exception", "reason": "failed to parse"}}}
+]}`
+	})
+	defer server.Close()
+
+	w := NewElasticsearchWriter(ElasticsearchWriterOptions{
+		URL:              server.URL,
+		Index:            "logs-log4go",
+		OpType:           ESOpTypeCreate,
+		APIKey:           "a2V5",
+		HTTPBatchOptions: HTTPBatchOptions{BatchSize: 3, RetryBackoff: 10 * time.Millisecond},
+	})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := w.Write(&Record{level: ERROR, msg: fmt.Sprintf("es %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := bulks()
+	if len(got) != 2 {
+		t.Fatalf("bulks got %d, want 2", len(got))
+	}
+	// only the rejected item is retried
+	if len(got[1].docs) != 1 || got[1].docs[0]["message"] != "es 1" {
+		t.Errorf("retry bulk got %v", got[1].docs)
+	}
+	if got[0].auth != "ApiKey a2V5" || got[0].actions[0]["create"]["_index"] != "logs-log4go" {
+		t.Errorf("unexpected auth %s, action %v", got[0].auth, got[0].actions[0])
+	}
+	if w.Failed() != 1 {
+		t.Errorf("failed got %d, want 1", w.Failed())
+	}
+}
+
+func Test_ElasticsearchWriterOptions(t *testing.T) {
+	for _, options := range []ElasticsearchWriterOptions{
+		{},
+		{URL: "http://127.0.0.1:9200", OpType: "update"},
+		{URL: "http://127.0.0.1:9200", Index: "logs-%Q"},
+	} {
+		if err := NewElasticsearchWriter(options).Init(); err == nil {
+			t.Errorf("options %+v should be invalid", options)
+		}
+	}
+
+	w := NewElasticsearchWriter(ElasticsearchWriterOptions{URL: "http://127.0.0.1:9200", Index: "logs-%Y%M%D-%H"})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if got := w.index(time.Date(2021, 6, 1, 8, 0, 0, 0, time.Local)); got != "logs-20210601-08" {
+		t.Errorf("index got %s", got)
+	}
+
+	if _, _, err := esCheckBulk([][]byte{nil}, []byte(`{"errors": true, "items": []}`)); err == nil {
+		t.Error("bulk response with mismatched items should fail")
+	}
+}
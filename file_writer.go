@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/user"
 	"path"
 	"path/filepath"
 	"strconv"
@@ -17,6 +18,11 @@ import (
 
 var pathVariableTable map[byte]func(*time.Time) int
 
+const (
+	defaultFilePerm = "0644"
+	defaultDirPerm  = "0755"
+)
+
 // FileWriter file writer for log record deal
 type FileWriter struct {
 	// write log order by order and atomic incr
@@ -25,8 +31,13 @@ type FileWriter struct {
 	lock         sync.RWMutex
 	initFileOnce sync.Once // init once
 
-	rotatePerm os.FileMode // real used
-	perm       string      // input
+	filePerm string      // input, octal string like "0644"
+	dirPerm  string      // input, octal string like "0755"
+	fileMode os.FileMode // real used for log files
+	dirMode  os.FileMode // real used for log dirs
+	owner    string      // input, user name or uid, chown files created by Rotate
+	group    string      // input, group name or gid, chown files created by Rotate
+	uid, gid int         // real used, -1 means not change
 	// input filename
 	filename string
 	// The opened file
@@ -90,6 +101,11 @@ type FileWriterOptions struct {
 	MaxDays    int `json:"max_days" mapstructure:"max_days"`
 	MaxHours   int `json:"max_hours" mapstructure:"max_hours"`
 	MaxMinutes int `json:"max_minutes" mapstructure:"max_minutes"`
+
+	FilePerm string `json:"file_perm" mapstructure:"file_perm"` // log file perm, default 0644
+	DirPerm  string `json:"dir_perm" mapstructure:"dir_perm"`   // log dir perm, default 0755
+	Owner    string `json:"owner" mapstructure:"owner"`         // optional, user name or uid of created log files
+	Group    string `json:"group" mapstructure:"group"`         // optional, group name or gid of created log files
 }
 
 // NewFileWriter create new file writer
@@ -113,6 +129,10 @@ func NewFileWriterWithOptions(options FileWriterOptions) *FileWriter {
 		maxHours:   options.MaxHours,
 		minutely:   options.Minutely,
 		maxMinutes: options.MaxMinutes,
+		filePerm:   options.FilePerm,
+		dirPerm:    options.DirPerm,
+		owner:      options.Owner,
+		group:      options.Group,
 	}
 	if err := fileWriter.SetPathPattern(options.Filename); err != nil {
 		log.Printf("[log4go] file writer init err: %v", err.Error())
@@ -135,7 +155,6 @@ func (w *FileWriter) Write(r *Record) error {
 // Init file writer init
 func (w *FileWriter) Init() error {
 	filename := w.filename
-	defaultPerm := "0755"
 	if len(filename) != 0 {
 		w.suffix = filepath.Ext(filename)
 		w.filenameOnly = strings.TrimSuffix(filename, w.suffix)
@@ -144,15 +163,26 @@ func (w *FileWriter) Init() error {
 			w.suffix = ".log"
 		}
 	}
-	if w.perm == "" {
-		w.perm = defaultPerm
+	if w.filePerm == "" {
+		w.filePerm = defaultFilePerm
+	}
+	if w.dirPerm == "" {
+		w.dirPerm = defaultDirPerm
 	}
 
-	perm, err := strconv.ParseInt(w.perm, 8, 64)
-	if err != nil {
+	var err error
+	if w.fileMode, err = parsePerm("file_perm", w.filePerm); err != nil {
+		return err
+	}
+	if w.dirMode, err = parsePerm("dir_perm", w.dirPerm); err != nil {
+		return err
+	}
+	if w.uid, err = lookupUID(w.owner); err != nil {
+		return err
+	}
+	if w.gid, err = lookupGID(w.group); err != nil {
 		return err
 	}
-	w.rotatePerm = os.FileMode(perm)
 
 	if w.rotate {
 		if w.daily && w.maxDays <= 0 {
@@ -177,8 +207,36 @@ func (w *FileWriter) Flush() error {
 	return nil
 }
 
+// Close flush and close the log file
+func (w *FileWriter) Close() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	w.fileBufWriter = nil
+	return err
+}
+
 // SetPathPattern for file writer
 func (w *FileWriter) SetPathPattern(pattern string) error {
+	pathFmt, actions, err := parsePathPattern(pattern)
+	if err != nil {
+		return err
+	}
+	w.pathFmt = pathFmt
+	if len(actions) > 0 {
+		w.actions = actions
+		w.variables = make([]interface{}, len(actions))
+	}
+	return nil
+}
+
+// parsePathPattern convert the pattern with %Y %M %D %H %m to the fmt format and the actions of the variables
+func parsePathPattern(pattern string) (string, []func(*time.Time) int, error) {
 	n := 0
 	for _, c := range pattern {
 		if c == '%' {
@@ -187,12 +245,10 @@ func (w *FileWriter) SetPathPattern(pattern string) error {
 	}
 
 	if n == 0 {
-		w.pathFmt = pattern
-		return nil
+		return pattern, nil, nil
 	}
 
-	w.actions = make([]func(*time.Time) int, 0, n)
-	w.variables = make([]interface{}, n, n)
+	actions := make([]func(*time.Time) int, 0, n)
 	tmp := []byte(pattern)
 
 	variable := 0
@@ -200,9 +256,9 @@ func (w *FileWriter) SetPathPattern(pattern string) error {
 		if variable == 1 {
 			act, ok := pathVariableTable[c]
 			if !ok {
-				return errors.New("invalid rotate pattern (" + pattern + ")")
+				return "", nil, errors.New("invalid rotate pattern (" + pattern + ")")
 			}
-			w.actions = append(w.actions, act)
+			actions = append(actions, act)
 			variable = 0
 			continue
 		}
@@ -211,9 +267,7 @@ func (w *FileWriter) SetPathPattern(pattern string) error {
 		}
 	}
 
-	w.pathFmt = convertPatternToFmt(tmp)
-
-	return nil
+	return convertPatternToFmt(tmp), actions, nil
 }
 
 func (w *FileWriter) initFile() {
@@ -291,18 +345,28 @@ func (w *FileWriter) Rotate() error {
 
 	filePath := fmt.Sprintf(w.pathFmt, w.variables...)
 
-	if err := os.MkdirAll(path.Dir(filePath), w.rotatePerm); err != nil {
+	if err := os.MkdirAll(path.Dir(filePath), w.dirMode); err != nil {
 		if !os.IsExist(err) {
 			return err
 		}
 	}
 
-	if file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, w.rotatePerm); err == nil {
+	_, statErr := os.Stat(filePath)
+	created := os.IsNotExist(statErr)
+
+	if file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, w.fileMode); err == nil {
 		w.file = file
 	} else {
 		return err
 	}
 
+	// only chown the files created by us, keep the exist files untouched
+	if created && (w.owner != "" || w.group != "") {
+		if err := w.file.Chown(w.uid, w.gid); err != nil {
+			return err
+		}
+	}
+
 	if w.fileBufWriter = bufio.NewWriterSize(w.file, 8192); w.fileBufWriter == nil {
 		return errors.New("fileWriter new fileBufWriter failed")
 	}
@@ -311,6 +375,45 @@ func (w *FileWriter) Rotate() error {
 	return nil
 }
 
+// parsePerm parse the octal perm string, like "0644"
+func parsePerm(name, perm string) (os.FileMode, error) {
+	v, err := strconv.ParseUint(perm, 8, 32)
+	if err != nil || v > 0777 {
+		return 0, fmt.Errorf("fileWriter invalid %s (%s), should be octal like 0644", name, perm)
+	}
+	return os.FileMode(v), nil
+}
+
+// lookupUID return the uid of user name or uid, -1 if owner is empty
+func lookupUID(owner string) (int, error) {
+	if owner == "" {
+		return -1, nil
+	}
+	if uid, err := strconv.Atoi(owner); err == nil {
+		return uid, nil
+	}
+	u, err := user.Lookup(owner)
+	if err != nil {
+		return -1, fmt.Errorf("fileWriter invalid owner (%s): %v", owner, err)
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// lookupGID return the gid of group name or gid, -1 if group is empty
+func lookupGID(group string) (int, error) {
+	if group == "" {
+		return -1, nil
+	}
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return -1, fmt.Errorf("fileWriter invalid group (%s): %v", group, err)
+	}
+	return strconv.Atoi(g.Gid)
+}
+
 func getYear(now *time.Time) int {
 	return now.Year()
 }
@@ -2,7 +2,10 @@ package log4go
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -50,28 +53,122 @@ func Test_NewFileWriterWithoutSuffixFilename(t *testing.T) {
 	records := make(chan *Record, uint(128))
 	loggerDefaultTest := newLoggerWithRecords(records)
 	loggerDefaultTest.SetLevel(DEBUG)
+	defer loggerDefaultTest.Close()
 
 	filename := "./test/xwi88-log4go%Y%M%D%H%m-withoutSuffixFilename"
 	w, err := generateNewFileWriterWithOptions(LevelFlagDebug, filename)
 	if err != nil {
 		t.Error(err)
 	}
-	w.perm = "0999"
 	var name = "filename without suffix"
-	defer func() {
-		if err := recover(); err != nil {
-			w.perm = "0755"
-			loggerDefaultTest = newLoggerWithRecords(records)
-			generateRegisterFileWriter(loggerDefaultTest, w, fullPath, funcName, layout)
-			curFilename := fmt.Sprintf("%s%s", w.filenameOnly, w.suffix)
-			defer deleteGenerateLogFile(curFilename)
-			defer loggerDefaultTest.Close()
-			loggerDefaultTest.Debug("log4go by %s", name)
-			loggerDefaultTest.Info("log4go by %s", name)
-			loggerDefaultTest.Alert("%#v", loggerDefaultTest)
-		}
-	}()
 	generateRegisterFileWriter(loggerDefaultTest, w, fullPath, funcName, layout)
+	curFilename := fmt.Sprintf("%s%s", w.filenameOnly, w.suffix)
+	defer deleteGenerateLogFile(curFilename)
+	loggerDefaultTest.Debug("log4go by %s", name)
+	loggerDefaultTest.Info("log4go by %s", name)
+	loggerDefaultTest.Alert("%#v", loggerDefaultTest)
+}
+
+func Test_NewFileWriterWithErrorPerm(t *testing.T) {
+	records := make(chan *Record, uint(128))
+	loggerDefaultTest := newLoggerWithRecords(records)
+	defer loggerDefaultTest.Close()
+
+	for _, perm := range [][2]string{{"0999", ""}, {"", "abc"}, {"01777", ""}} {
+		w := NewFileWriterWithOptions(FileWriterOptions{
+			Level:    LevelFlagDebug,
+			Filename: "./test/xwi88-log4go-error-perm.log",
+			FilePerm: perm[0],
+			DirPerm:  perm[1],
+		})
+		if err := loggerDefaultTest.Register(w); err == nil {
+			t.Errorf("file_perm(%s) dir_perm(%s) should be invalid", perm[0], perm[1])
+		}
+	}
+	if len(loggerDefaultTest.writers) != 0 {
+		t.Errorf("writers with invalid perm should not be registered, got %d", len(loggerDefaultTest.writers))
+	}
+}
+
+func Test_NewFileWriterWithPerm(t *testing.T) {
+	records := make(chan *Record, uint(128))
+	loggerDefaultTest := newLoggerWithRecords(records)
+	defer loggerDefaultTest.Close()
+
+	dir := "./test/perm-dir"
+	defer os.RemoveAll(dir)
+	w := NewFileWriterWithOptions(FileWriterOptions{
+		Level:    LevelFlagDebug,
+		Filename: dir + "/xwi88-log4go%Y-perm.log",
+		FilePerm: "0600",
+		DirPerm:  "0700",
+		Owner:    strconv.Itoa(os.Getuid()),
+		Group:    strconv.Itoa(os.Getgid()),
+	})
+	if err := loggerDefaultTest.Register(w); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(fmt.Sprintf("%s%s", w.filenameOnly, w.suffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("file perm got %v, want %v", fi.Mode().Perm(), os.FileMode(0600))
+	}
+	di, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if di.Mode().Perm() != 0700 {
+		t.Errorf("dir perm got %v, want %v", di.Mode().Perm(), os.FileMode(0700))
+	}
+}
+
+func Test_NewFileWriterWithClose(t *testing.T) {
+	records := make(chan *Record, uint(128))
+	loggerDefaultTest := newLoggerWithRecords(records)
+
+	dir := "./test/close-dir"
+	defer os.RemoveAll(dir)
+	w := NewFileWriterWithOptions(FileWriterOptions{
+		Level:    LevelFlagDebug,
+		Filename: dir + "/xwi88-log4go%Y-close.log",
+	})
+	if err := loggerDefaultTest.Register(w); err != nil {
+		t.Fatal(err)
+	}
+	loggerDefaultTest.Info("closed by logger")
+	loggerDefaultTest.Close()
+
+	if w.file != nil || w.fileBufWriter != nil {
+		t.Error("file should be closed by the logger")
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("log files got %v, err: %v", files, err)
+	}
+	data, err := ioutil.ReadFile(dir + "/" + files[0].Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "closed by logger") {
+		t.Errorf("log file should be flushed before closed, got %q", data)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("close twice got err: %v", err)
+	}
+}
+
+func Test_NewFileWriterWithErrorOwner(t *testing.T) {
+	w := NewFileWriterWithOptions(FileWriterOptions{
+		Level:    LevelFlagDebug,
+		Filename: "./test/xwi88-log4go-error-owner.log",
+		Owner:    "log4go-no-such-user",
+	})
+	if err := w.Init(); err == nil {
+		t.Error("owner log4go-no-such-user should be invalid")
+	}
 }
 
 func Test_NewFileWriterWithErrorPattern(t *testing.T) {
@@ -0,0 +1,431 @@
+package log4go
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// fluent forward networks
+const (
+	FluentNetworkTCP  = "tcp" // default
+	FluentNetworkUnix = "unix"
+)
+
+// fluent tag sources, the record tag is tag.xxx
+const (
+	FluentTagByCategory = "category" // the record field category, the lowercase level if not set, default
+	FluentTagByLevel    = "level"    // the lowercase record level
+	FluentTagByNone     = "none"     // the tag only
+)
+
+const (
+	fluentAddressDefault = "127.0.0.1:24224"
+	fluentTagDefault     = "log4go"
+	fluentTimeoutDefault = 5 * time.Second
+)
+
+// FluentWriterOptions fluent writer options
+type FluentWriterOptions struct {
+	Enable  bool       `json:"enable" mapstructure:"enable"`
+	Level   string     `json:"level" mapstructure:"level"`
+	Network string     `json:"network" mapstructure:"network"` // tcp or unix, default tcp
+	Address string     `json:"address" mapstructure:"address"` // host:port or the socket path, default 127.0.0.1:24224
+	TLS     TLSOptions `json:"tls" mapstructure:"tls"`         // used with tcp if enabled
+
+	Tag   string `json:"tag" mapstructure:"tag"`       // the tag prefix, default log4go
+	TagBy string `json:"tag_by" mapstructure:"tag_by"` // category, level or none, default category
+
+	RequireAck  bool   `json:"require_ack" mapstructure:"require_ack"` // send the chunk id and wait the ack
+	Compression string `json:"compression" mapstructure:"compression"` // none or gzip, default none
+
+	// shared key authentication by the handshake, optional
+	SharedKey string `json:"shared_key" mapstructure:"shared_key"`
+	Hostname  string `json:"hostname" mapstructure:"hostname"` // the self hostname, default os.Hostname
+	Username  string `json:"username" mapstructure:"username"` // optional, the user authentication
+	Password  string `json:"password" mapstructure:"password"`
+
+	BatchSize     int           `json:"batch_size" mapstructure:"batch_size"`         // records to trigger a send, default 100
+	FlushInterval time.Duration `json:"flush_interval" mapstructure:"flush_interval"` // max delay of a record, default 1s
+	BufferSize    int           `json:"buffer_size" mapstructure:"buffer_size"`       // queued batches, the oldest dropped when full, default 16
+
+	Timeout         time.Duration `json:"timeout" mapstructure:"timeout"`                     // dial, write and ack timeout, default 5s
+	RetryMax        int           `json:"retry_max" mapstructure:"retry_max"`                 // default 3, -1 means no retry
+	RetryBackoff    time.Duration `json:"retry_backoff" mapstructure:"retry_backoff"`         // first retry delay, doubled on retries, default 500ms
+	RetryBackoffMax time.Duration `json:"retry_backoff_max" mapstructure:"retry_backoff_max"` // default 30s
+	CloseTimeout    time.Duration `json:"close_timeout" mapstructure:"close_timeout"`         // the deadline to send the queued batches when closed, default 5s
+}
+
+// FluentWriter send the records by the fluentd forward protocol in PackedForward mode
+type FluentWriter struct {
+	level    int
+	options  FluentWriterOptions
+	tls      *tls.Config
+	hostname string
+
+	batcher *batcher
+
+	// used by the sender only
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewFluentWriter create new fluent writer
+func NewFluentWriter(options FluentWriterOptions) *FluentWriter {
+	defaultLevel := DEBUG
+	if len(options.Level) > 0 {
+		defaultLevel = getLevelDefault(options.Level, defaultLevel, "")
+	}
+	return &FluentWriter{
+		level:   defaultLevel,
+		options: options,
+	}
+}
+
+// Init check the options and start the sender, the connection is dialed by the sender
+func (w *FluentWriter) Init() (err error) {
+	options := &w.options
+	switch options.Network {
+	case "":
+		options.Network = FluentNetworkTCP
+	case FluentNetworkTCP, FluentNetworkUnix:
+	default:
+		return fmt.Errorf("fluent writer invalid network (%s)", options.Network)
+	}
+	if options.Address == "" {
+		if options.Network == FluentNetworkUnix {
+			return errors.New("fluent writer network unix requires address")
+		}
+		options.Address = fluentAddressDefault
+	}
+	if options.TLS.Enable && options.Network == FluentNetworkTCP {
+		if w.tls, err = newTLSConfig(options.TLS); err != nil {
+			return fmt.Errorf("fluent writer %v", err)
+		}
+	}
+	if options.Tag == "" {
+		options.Tag = fluentTagDefault
+	}
+	switch options.TagBy {
+	case "":
+		options.TagBy = FluentTagByCategory
+	case FluentTagByCategory, FluentTagByLevel, FluentTagByNone:
+	default:
+		return fmt.Errorf("fluent writer invalid tag_by (%s)", options.TagBy)
+	}
+	switch options.Compression {
+	case "", HTTPCompressionNone, HTTPCompressionGzip:
+	default:
+		return fmt.Errorf("fluent writer invalid compression (%s)", options.Compression)
+	}
+	w.hostname = options.Hostname
+	if w.hostname == "" {
+		w.hostname, _ = os.Hostname()
+	}
+
+	w.batcher = newBatcher("fluent writer", batchOptions{
+		size:            options.BatchSize,
+		flushInterval:   options.FlushInterval,
+		bufferSize:      options.BufferSize,
+		retryMax:        options.RetryMax,
+		retryBackoff:    options.RetryBackoff,
+		retryBackoffMax: options.RetryBackoffMax,
+		closeTimeout:    options.CloseTimeout,
+	}, w.send)
+	w.batcher.quit = w.disconnect
+	w.batcher.start()
+	return nil
+}
+
+// tag the tag of the record by the tag_by option
+func (w *FluentWriter) tag(r *Record) string {
+	level := strings.ToLower(LevelFlags[r.level])
+	switch w.options.TagBy {
+	case FluentTagByNone:
+		return w.options.Tag
+	case FluentTagByCategory:
+		if category, ok := r.fields["category"]; ok {
+			return w.options.Tag + "." + fmt.Sprint(category)
+		}
+	}
+	return w.options.Tag + "." + level
+}
+
+// Write encode the record to the entry and add it to the batch, send the batch if full
+func (w *FluentWriter) Write(r *Record) error {
+	if r.level > w.level {
+		return nil
+	}
+	if w.batcher == nil {
+		return errors.New("fluent writer not running")
+	}
+	data := appendMsgpackArrayHeader(nil, 2)
+	data = appendMsgpackEventTime(data, recordTime(r))
+	data = appendMsgpackMap(data, recordJSONBody(r, "time"))
+	return w.batcher.add(fluentItem(w.tag(r), data))
+}
+
+// fluentItem the batch item: the uvarint length of the tag, the tag and the msgpack encoded [time, record]
+func fluentItem(tag string, entry []byte) []byte {
+	item := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(tag)+len(entry))
+	item = item[:binary.PutUvarint(item, uint64(len(tag)))]
+	return append(append(item, tag...), entry...)
+}
+
+func parseFluentItem(item []byte) (tag string, entry []byte) {
+	n, size := binary.Uvarint(item)
+	item = item[size:]
+	return string(item[:n]), item[n:]
+}
+
+// fluentMessage the PackedForward message of one tag
+type fluentMessage struct {
+	items [][]byte // the batch items of the entries
+	chunk string   // the chunk id to ack, empty if not required
+	data  []byte
+}
+
+// messages group the entries by the tag in the first seen order and encode the PackedForward messages:
+// [tag, entries, {"size": n, "chunk": id, "compressed": "gzip"}]
+func (w *FluentWriter) messages(items [][]byte) ([]*fluentMessage, error) {
+	var tags []string
+	packed := make(map[string]*bytes.Buffer)
+	grouped := make(map[string][][]byte)
+	for _, item := range items {
+		tag, entry := parseFluentItem(item)
+		buf, ok := packed[tag]
+		if !ok {
+			buf = new(bytes.Buffer)
+			packed[tag] = buf
+			tags = append(tags, tag)
+		}
+		buf.Write(entry)
+		grouped[tag] = append(grouped[tag], item)
+	}
+
+	messages := make([]*fluentMessage, 0, len(tags))
+	for _, tag := range tags {
+		option := map[string]interface{}{"size": len(grouped[tag])}
+		events := packed[tag].Bytes()
+		if w.options.Compression == HTTPCompressionGzip {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			if _, err := zw.Write(events); err != nil {
+				return nil, err
+			}
+			if err := zw.Close(); err != nil {
+				return nil, err
+			}
+			events = buf.Bytes()
+			option["compressed"] = HTTPCompressionGzip
+		}
+		message := &fluentMessage{items: grouped[tag]}
+		if w.options.RequireAck {
+			id := make([]byte, 16)
+			if _, err := rand.Read(id); err != nil {
+				return nil, err
+			}
+			message.chunk = base64.StdEncoding.EncodeToString(id)
+			option["chunk"] = message.chunk
+		}
+
+		data := appendMsgpackArrayHeader(nil, 3)
+		data = appendMsgpackString(data, tag)
+		data = appendMsgpackBin(data, events)
+		message.data = appendMsgpackMap(data, option)
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// send the messages of the batch once, the items of the messages not acked are retried
+func (w *FluentWriter) send(ctx context.Context, items [][]byte) ([][]byte, int, time.Duration, error) {
+	messages, err := w.messages(items)
+	if err != nil {
+		return nil, len(items), 0, err
+	}
+	for i, message := range messages {
+		if err := w.sendMessage(message); err != nil {
+			w.disconnect()
+			var retry [][]byte
+			for _, message := range messages[i:] {
+				retry = append(retry, message.items...)
+			}
+			return retry, 0, 0, err
+		}
+	}
+	return nil, 0, 0, nil
+}
+
+// sendMessage write the message and wait the ack if required, connect if disconnected
+func (w *FluentWriter) sendMessage(message *fluentMessage) error {
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return err
+		}
+	}
+	if err := w.conn.SetDeadline(time.Now().Add(w.timeout())); err != nil {
+		return err
+	}
+	if _, err := w.conn.Write(message.data); err != nil {
+		return err
+	}
+	if message.chunk == "" {
+		return nil
+	}
+	resp, err := readMsgpack(w.reader)
+	if err != nil {
+		return fmt.Errorf("read ack err: %v", err)
+	}
+	if m, ok := resp.(map[string]interface{}); !ok || m["ack"] != message.chunk {
+		return fmt.Errorf("invalid ack %v, want %s", resp, message.chunk)
+	}
+	return nil
+}
+
+// connect dial the fluent server and do the handshake if the shared key is set
+func (w *FluentWriter) connect() (err error) {
+	dialer := &net.Dialer{Timeout: w.timeout()}
+	if w.tls != nil {
+		w.conn, err = tls.DialWithDialer(dialer, "tcp", w.options.Address, w.tls)
+	} else {
+		w.conn, err = dialer.Dial(w.options.Network, w.options.Address)
+	}
+	if err != nil {
+		w.conn = nil
+		return err
+	}
+	w.reader = bufio.NewReader(w.conn)
+	if w.options.SharedKey == "" {
+		return nil
+	}
+	if err = w.handshake(); err != nil {
+		w.disconnect()
+		return fmt.Errorf("handshake err: %v", err)
+	}
+	return nil
+}
+
+func fluentDigest(parts ...[]byte) string {
+	h := sha512.New()
+	for _, part := range parts {
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fluentBytes the bin or str value
+func fluentBytes(v interface{}) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return nil
+}
+
+// handshake HELO, PING and PONG of the forward protocol
+func (w *FluentWriter) handshake() error {
+	if err := w.conn.SetDeadline(time.Now().Add(w.timeout())); err != nil {
+		return err
+	}
+	resp, err := readMsgpack(w.reader)
+	if err != nil {
+		return err
+	}
+	helo, ok := resp.([]interface{})
+	if !ok || len(helo) < 2 || helo[0] != "HELO" {
+		return fmt.Errorf("invalid HELO %v", resp)
+	}
+	heloOptions, _ := helo[1].(map[string]interface{})
+	nonce, auth := fluentBytes(heloOptions["nonce"]), fluentBytes(heloOptions["auth"])
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	hostname, sharedKey := []byte(w.hostname), []byte(w.options.SharedKey)
+	var passwordDigest string
+	if len(auth) > 0 {
+		passwordDigest = fluentDigest(auth, []byte(w.options.Username), []byte(w.options.Password))
+	}
+	ping := appendMsgpackArrayHeader(nil, 6)
+	ping = appendMsgpackString(ping, "PING")
+	ping = appendMsgpackString(ping, w.hostname)
+	ping = appendMsgpackBin(ping, salt)
+	ping = appendMsgpackString(ping, fluentDigest(salt, hostname, nonce, sharedKey))
+	ping = appendMsgpackString(ping, w.options.Username)
+	ping = appendMsgpackString(ping, passwordDigest)
+	if _, err := w.conn.Write(ping); err != nil {
+		return err
+	}
+
+	if resp, err = readMsgpack(w.reader); err != nil {
+		return err
+	}
+	pong, ok := resp.([]interface{})
+	if !ok || len(pong) < 5 || pong[0] != "PONG" {
+		return fmt.Errorf("invalid PONG %v", resp)
+	}
+	if pong[1] != true {
+		return fmt.Errorf("authentication failed: %v", pong[2])
+	}
+	serverHostname := fluentBytes(pong[3])
+	if digest := fluentBytes(pong[4]); string(digest) != fluentDigest(salt, serverHostname, nonce, sharedKey) {
+		return errors.New("invalid server shared key digest")
+	}
+	return nil
+}
+
+func (w *FluentWriter) disconnect() {
+	if w.conn != nil {
+		_ = w.conn.Close()
+		w.conn, w.reader = nil, nil
+	}
+}
+
+func (w *FluentWriter) timeout() time.Duration {
+	if w.options.Timeout > 0 {
+		return w.options.Timeout
+	}
+	return fluentTimeoutDefault
+}
+
+// Dropped return the number of records dropped by the full queue
+func (w *FluentWriter) Dropped() int64 {
+	if w.batcher == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&w.batcher.dropped)
+}
+
+// Failed return the number of records failed to send after retries
+func (w *FluentWriter) Failed() int64 {
+	if w.batcher == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&w.batcher.failed)
+}
+
+// Close send the buffered records within the close timeout, return the error if some records undelivered
+func (w *FluentWriter) Close() error {
+	if w.batcher == nil {
+		return nil
+	}
+	return w.batcher.close()
+}
@@ -0,0 +1,265 @@
+package log4go
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fluentTestEvent the received event of the tag
+type fluentTestEvent struct {
+	tag    string
+	time   time.Time
+	record map[string]interface{}
+}
+
+// fluentTestServer the forward input, the handshake is required if the shared key is set
+type fluentTestServer struct {
+	t         *testing.T
+	ln        net.Listener
+	sharedKey string
+	password  string
+
+	lock    sync.Mutex
+	events  []fluentTestEvent
+	options []map[string]interface{}
+}
+
+func newFluentTestServer(t *testing.T, sharedKey, password string) *fluentTestServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fluentTestServer{t: t, ln: ln, sharedKey: sharedKey, password: password}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fluentTestServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	if s.sharedKey != "" && !s.handshake(conn, r) {
+		return
+	}
+	for {
+		v, err := readMsgpack(r)
+		if err != nil {
+			return
+		}
+		msg := v.([]interface{})
+		tag, events, option := msg[0].(string), msg[1].([]byte), msg[2].(map[string]interface{})
+		if option["compressed"] == "gzip" {
+			zr, err := gzip.NewReader(bytes.NewReader(events))
+			if err != nil {
+				s.t.Error(err)
+				return
+			}
+			events, _ = ioutil.ReadAll(zr)
+		}
+
+		er := bufio.NewReader(bytes.NewReader(events))
+		s.lock.Lock()
+		for {
+			event, err := readMsgpack(er)
+			if err != nil {
+				break
+			}
+			entry := event.([]interface{})
+			ext := entry[0].([]byte)
+			ts := time.Unix(int64(binary.BigEndian.Uint32(ext[1:5])), int64(binary.BigEndian.Uint32(ext[5:9])))
+			s.events = append(s.events, fluentTestEvent{tag: tag, time: ts, record: entry[1].(map[string]interface{})})
+		}
+		s.options = append(s.options, option)
+		s.lock.Unlock()
+
+		if chunk, ok := option["chunk"].(string); ok {
+			ack := appendMsgpackMapHeader(nil, 1)
+			ack = appendMsgpackString(ack, "ack")
+			_, _ = conn.Write(appendMsgpackString(ack, chunk))
+		}
+	}
+}
+
+func (s *fluentTestServer) handshake(conn net.Conn, r *bufio.Reader) bool {
+	nonce, auth := []byte("nonce"), []byte("auth salt")
+	helo := appendMsgpackArrayHeader(nil, 2)
+	helo = appendMsgpackString(helo, "HELO")
+	helo = appendMsgpackMap(helo, map[string]interface{}{"nonce": nonce, "auth": auth, "keepalive": true})
+	if _, err := conn.Write(helo); err != nil {
+		return false
+	}
+
+	v, err := readMsgpack(r)
+	if err != nil {
+		return false
+	}
+	ping := v.([]interface{})
+	hostname, salt := []byte(ping[1].(string)), ping[2].([]byte)
+	ok := ping[0] == "PING" &&
+		ping[3] == fluentDigest(salt, hostname, nonce, []byte(s.sharedKey)) &&
+		ping[5] == fluentDigest(auth, []byte(ping[4].(string)), []byte(s.password))
+
+	pong := appendMsgpackArrayHeader(nil, 5)
+	pong = appendMsgpackString(pong, "PONG")
+	pong = appendMsgpackBool(pong, ok)
+	pong = appendMsgpackString(pong, "shared key or password mismatch")
+	pong = appendMsgpackString(pong, "fluent-bit")
+	pong = appendMsgpackString(pong, fluentDigest(salt, []byte("fluent-bit"), nonce, []byte(s.sharedKey)))
+	_, _ = conn.Write(pong)
+	return ok
+}
+
+func (s *fluentTestServer) received() ([]fluentTestEvent, []map[string]interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]fluentTestEvent(nil), s.events...), append([]map[string]interface{}(nil), s.options...)
+}
+
+func Test_FluentWriterForward(t *testing.T) {
+	server := newFluentTestServer(t, "", "")
+	defer server.ln.Close()
+
+	w := NewFluentWriter(FluentWriterOptions{
+		Address:       server.ln.Addr().String(),
+		RequireAck:    true,
+		Compression:   HTTPCompressionGzip,
+		BatchSize:     4,
+		FlushInterval: time.Hour,
+	})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 6, 1, 8, 0, 0, 123, time.UTC)
+	records := []*Record{
+		{level: ERROR, msg: "e1", now: now, fields: Fields{"user": "xwi88"}},
+		{level: INFO, msg: "i1", now: now, fields: Fields{"category": "order"}},
+		{level: ERROR, msg: "e2", now: now},
+		{level: DEBUG, msg: "d1", now: now},
+	}
+	for _, r := range records {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	events, options := server.received()
+	if len(options) != 3 {
+		t.Fatalf("messages got %d, want 3", len(options))
+	}
+	for i, size := range []int64{2, 1, 1} {
+		if options[i]["size"] != size || options[i]["compressed"] != "gzip" || options[i]["chunk"] == nil {
+			t.Errorf("message %d option got %v", i, options[i])
+		}
+	}
+	wants := []struct {
+		tag string
+		msg string
+	}{{"log4go.error", "e1"}, {"log4go.error", "e2"}, {"log4go.order", "i1"}, {"log4go.debug", "d1"}}
+	if len(events) != len(wants) {
+		t.Fatalf("events got %d", len(events))
+	}
+	for i, want := range wants {
+		event := events[i]
+		if event.tag != want.tag || event.record["message"] != want.msg || !event.time.Equal(now) {
+			t.Errorf("event %d got %+v, want %s %s", i, event, want.tag, want.msg)
+		}
+	}
+	if events[0].record["user"] != "xwi88" || events[0].record["level"] != LevelFlagError {
+		t.Errorf("event record got %v", events[0].record)
+	}
+}
+
+func Test_FluentWriterHandshake(t *testing.T) {
+	server := newFluentTestServer(t, "secret", "pass")
+	defer server.ln.Close()
+
+	options := FluentWriterOptions{
+		Address:    server.ln.Addr().String(),
+		TagBy:      FluentTagByNone,
+		SharedKey:  "secret",
+		Hostname:   "node-1",
+		Username:   "log4go",
+		Password:   "pass",
+		RequireAck: true, // the events are received when closed
+		BatchSize:  1,
+		RetryMax:   -1,
+	}
+	w := NewFluentWriter(options)
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(&Record{level: ERROR, msg: "auth"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := server.received(); len(events) != 1 || events[0].tag != "log4go" {
+		t.Fatalf("events got %+v", events)
+	}
+
+	options.Password = "wrong"
+	w = NewFluentWriter(options)
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(&Record{level: ERROR, msg: "auth"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if w.Failed() != 1 {
+		t.Errorf("failed got %d, want 1", w.Failed())
+	}
+}
+
+func Test_FluentWriterOptions(t *testing.T) {
+	for _, options := range []FluentWriterOptions{
+		{Network: "udp"},
+		{Network: FluentNetworkUnix},
+		{TagBy: "host"},
+		{Compression: "zlib"},
+	} {
+		if err := NewFluentWriter(options).Init(); err == nil {
+			t.Errorf("options %+v should be invalid", options)
+		}
+	}
+
+	w := NewFluentWriter(FluentWriterOptions{Tag: "app", TagBy: FluentTagByLevel})
+	if err := w.Write(&Record{level: ERROR}); err == nil {
+		t.Error("write before init should fail")
+	}
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if tag := w.tag(&Record{level: WARNING, fields: Fields{"category": "order"}}); tag != "app.warning" {
+		t.Errorf("tag got %s", tag)
+	}
+}
+
+func Test_fluentItem(t *testing.T) {
+	entry := appendMsgpackString(appendMsgpackArrayHeader(nil, 2), "line\n")
+	tag, got := parseFluentItem(fluentItem("app.order\nx", entry))
+	if tag != "app.order\nx" || string(got) != string(entry) {
+		t.Errorf("item got %q %q", tag, got)
+	}
+}
@@ -0,0 +1,301 @@
+package log4go
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gelf transports
+const (
+	GELFNetworkUDP = "udp" // chunked datagrams, default
+	GELFNetworkTCP = "tcp" // null byte framing, not compressed
+)
+
+// gelf compressions of udp
+const (
+	GELFCompressionGzip = "gzip" // default
+	GELFCompressionZlib = "zlib"
+	GELFCompressionNone = "none"
+)
+
+const (
+	gelfVersion          = "1.1"
+	gelfChunkSizeDefault = 1420 // fit the WAN mtu
+	gelfChunkHeaderSize  = 12   // magic bytes 0x1e 0x0f, message id, sequence number and count
+	gelfChunkMax         = 128
+	gelfReconnectDefault = time.Second
+	gelfNilValue         = "-" // short_message is required and not empty
+)
+
+// GELFWriterOptions gelf writer options
+type GELFWriterOptions struct {
+	Enable  bool       `json:"enable" mapstructure:"enable"`
+	Level   string     `json:"level" mapstructure:"level"`
+	Network string     `json:"network" mapstructure:"network"` // udp or tcp, default udp
+	Address string     `json:"address" mapstructure:"address"` // host:port of the graylog input
+	TLS     TLSOptions `json:"tls" mapstructure:"tls"`         // used with tcp if enabled
+
+	Compression string `json:"compression" mapstructure:"compression"` // gzip, zlib or none with udp, default gzip
+	ChunkSize   int    `json:"chunk_size" mapstructure:"chunk_size"`   // max datagram size with udp, default 1420
+	Host        string `json:"host" mapstructure:"host"`               // default os.Hostname
+
+	Timeout           time.Duration `json:"timeout" mapstructure:"timeout"`                       // dial and write timeout, default 5s
+	ReconnectInterval time.Duration `json:"reconnect_interval" mapstructure:"reconnect_interval"` // min interval to redial, default 1s
+}
+
+// GELFWriter send the records to graylog by GELF 1.1
+type GELFWriter struct {
+	level   int
+	options GELFWriterOptions
+
+	network   string
+	host      string
+	chunkSize int
+
+	lock sync.Mutex
+	conn netConn
+	rand *rand.Rand // the chunked message ids
+}
+
+// NewGELFWriter create new gelf writer
+func NewGELFWriter(options GELFWriterOptions) *GELFWriter {
+	defaultLevel := DEBUG
+	if len(options.Level) > 0 {
+		defaultLevel = getLevelDefault(options.Level, defaultLevel, "")
+	}
+	return &GELFWriter{
+		level:   defaultLevel,
+		options: options,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Init check the options and connect the graylog input, the writer reconnects if unreachable
+func (w *GELFWriter) Init() (err error) {
+	options := &w.options
+	var tlsConfig *tls.Config
+
+	w.network = strings.ToLower(options.Network)
+	switch w.network {
+	case "", GELFNetworkUDP:
+		w.network = GELFNetworkUDP
+		switch options.Compression {
+		case "":
+			options.Compression = GELFCompressionGzip
+		case GELFCompressionGzip, GELFCompressionZlib, GELFCompressionNone:
+		default:
+			return fmt.Errorf("gelf writer invalid compression (%s)", options.Compression)
+		}
+	case GELFNetworkTCP:
+		if options.Compression != "" && options.Compression != GELFCompressionNone {
+			return fmt.Errorf("gelf writer invalid compression (%s), tcp is not compressed", options.Compression)
+		}
+		if options.TLS.Enable {
+			if tlsConfig, err = newTLSConfig(options.TLS); err != nil {
+				return fmt.Errorf("gelf writer %v", err)
+			}
+		}
+	default:
+		return fmt.Errorf("gelf writer invalid network (%s)", options.Network)
+	}
+	if options.Address == "" {
+		return errors.New("gelf writer requires address")
+	}
+
+	w.chunkSize = options.ChunkSize
+	if w.chunkSize <= 0 {
+		w.chunkSize = gelfChunkSizeDefault
+	} else if w.chunkSize <= gelfChunkHeaderSize {
+		return fmt.Errorf("gelf writer invalid chunk_size (%d)", options.ChunkSize)
+	}
+	w.host = options.Host
+	if w.host == "" {
+		w.host, _ = os.Hostname()
+	}
+	interval := options.ReconnectInterval
+	if interval <= 0 {
+		interval = gelfReconnectDefault
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.conn = netConn{
+		network:      w.network,
+		address:      options.Address,
+		tls:          tlsConfig,
+		dialTimeout:  options.Timeout,
+		writeTimeout: options.Timeout,
+		interval:     interval,
+	}
+	if err := w.conn.connect(); err != nil {
+		log.Printf("[log4go] gelf writer connect err: %v, will reconnect", err.Error())
+	}
+	return nil
+}
+
+// gelfFieldName the additional field name matches ^[\w\.\-]*$ with the _ prefix, _id is reserved
+func gelfFieldName(k string) string {
+	b := make([]byte, 0, len(k)+1)
+	b = append(b, '_')
+	for i := 0; i < len(k); i++ {
+		c := k[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-') {
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	if name := string(b); name != "_id" {
+		return name
+	}
+	return "__id"
+}
+
+// gelfFieldValue the additional field value is a string or a number
+func gelfFieldValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string, json.Number,
+		int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	case error:
+		return v.Error()
+	}
+	return fmt.Sprint(v)
+}
+
+// encode the GELF message, the first line of the message is the short_message
+// and the whole message is the full_message if multiline
+func (w *GELFWriter) encode(r *Record) ([]byte, error) {
+	msg := make(map[string]interface{}, 8+len(r.fields))
+	for k, v := range r.fields {
+		if k != "" {
+			msg[gelfFieldName(k)] = gelfFieldValue(v)
+		}
+	}
+	if r.fileName != "" {
+		msg["_file"] = r.fileName
+		msg["_line"] = r.line
+	}
+
+	short := strings.TrimSpace(r.msg)
+	if i := strings.IndexByte(short, '\n'); i >= 0 {
+		short = strings.TrimSpace(short[:i])
+		msg["full_message"] = r.msg
+	}
+	if short == "" {
+		short = gelfNilValue
+	}
+	msg["version"] = gelfVersion
+	msg["host"] = w.host
+	msg["short_message"] = short
+	msg["timestamp"] = float64(recordTime(r).UnixNano()/int64(time.Microsecond)) / 1e6
+	msg["level"] = r.level // the log4go levels are the syslog severities
+	return json.Marshal(msg)
+}
+
+// Write send the record, the udp message is compressed and chunked if larger than the chunk size
+func (w *GELFWriter) Write(r *Record) error {
+	if r.level > w.level {
+		return nil
+	}
+	if w.network == "" {
+		return errors.New("gelf writer not running")
+	}
+	msg, err := w.encode(r)
+	if err != nil {
+		return err
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.network == GELFNetworkTCP {
+		return w.send(append(msg, 0))
+	}
+	if msg, err = w.compress(msg); err != nil {
+		return err
+	}
+	if len(msg) <= w.chunkSize {
+		return w.send(msg)
+	}
+	chunks, err := w.chunks(msg)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if err := w.send(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *GELFWriter) compress(msg []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var zw io.WriteCloser
+	switch w.options.Compression {
+	case GELFCompressionGzip:
+		zw = gzip.NewWriter(&buf)
+	case GELFCompressionZlib:
+		zw = zlib.NewWriter(&buf)
+	default:
+		return msg, nil
+	}
+	if _, err := zw.Write(msg); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// chunks split the message to the chunked datagrams with the same random message id, must hold the lock
+func (w *GELFWriter) chunks(msg []byte) ([][]byte, error) {
+	size := w.chunkSize - gelfChunkHeaderSize
+	count := (len(msg) + size - 1) / size
+	if count > gelfChunkMax {
+		return nil, fmt.Errorf("gelf writer message %d bytes exceeds %d chunks", len(msg), gelfChunkMax)
+	}
+	id := w.rand.Uint64()
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		data := msg[i*size:]
+		if len(data) > size {
+			data = data[:size]
+		}
+		chunk := make([]byte, gelfChunkHeaderSize, gelfChunkHeaderSize+len(data))
+		chunk[0], chunk[1] = 0x1e, 0x0f
+		binary.BigEndian.PutUint64(chunk[2:10], id)
+		chunk[10], chunk[11] = byte(i), byte(count)
+		chunks = append(chunks, append(chunk, data...))
+	}
+	return chunks, nil
+}
+
+// send write the data, reconnect and retry once if failed, the data is discarded if still failed
+func (w *GELFWriter) send(data []byte) error {
+	if err := w.conn.send(data); err != nil {
+		return fmt.Errorf("gelf writer send %d bytes err: %v", len(data), err)
+	}
+	return nil
+}
+
+// Close close the connection
+func (w *GELFWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.conn.close()
+	return nil
+}
@@ -0,0 +1,231 @@
+package log4go
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestGELFRecord(msg string) *Record {
+	return &Record{
+		level:    WARNING,
+		msg:      msg,
+		now:      time.Date(2021, 6, 1, 8, 0, 0, 123456000, time.UTC),
+		fileName: "/app/main.go",
+		line:     42,
+		fields:   Fields{"user": "xwi88", "id": 7, "err": errors.New("timeout"), "user name": "x", "ok": true},
+	}
+}
+
+// checkGELFMessage check the gelf message of newTestGELFRecord
+func checkGELFMessage(t *testing.T, data []byte, short string) map[string]interface{} {
+	var msg map[string]interface{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("invalid gelf message %s, err: %v", data, err)
+	}
+	wants := map[string]interface{}{
+		"version":       "1.1",
+		"host":          "node-1",
+		"short_message": short,
+		"timestamp":     1622534400.123456,
+		"level":         float64(4),
+		"_file":         "/app/main.go",
+		"_line":         float64(42),
+		"_user":         "xwi88",
+		"__id":          float64(7),
+		"_err":          "timeout",
+		"_user_name":    "x",
+		"_ok":           "true",
+	}
+	for k, want := range wants {
+		if msg[k] != want {
+			t.Errorf("gelf %s got %v, want %v", k, msg[k], want)
+		}
+	}
+	return msg
+}
+
+func listenGELFUDP(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func readDatagram(t *testing.T, conn *net.UDPConn) []byte {
+	buf := make([]byte, 65536)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+func decompressGELF(t *testing.T, compression string, data []byte) []byte {
+	var zr io.Reader
+	var err error
+	switch compression {
+	case "", GELFCompressionGzip:
+		zr, err = gzip.NewReader(bytes.NewReader(data))
+	case GELFCompressionZlib:
+		zr, err = zlib.NewReader(bytes.NewReader(data))
+	default:
+		return data
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func Test_GELFWriterUDP(t *testing.T) {
+	server := listenGELFUDP(t)
+	defer server.Close()
+
+	for _, compression := range []string{"", GELFCompressionZlib, GELFCompressionNone} {
+		w := NewGELFWriter(GELFWriterOptions{Address: server.LocalAddr().String(), Compression: compression, Host: "node-1"})
+		if err := w.Init(); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Write(newTestGELFRecord("gelf\nstack")); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Write(&Record{level: DEBUG}); err != nil {
+			t.Fatal(err)
+		}
+		_ = w.Close()
+
+		msg := checkGELFMessage(t, decompressGELF(t, compression, readDatagram(t, server)), "gelf")
+		if msg["full_message"] != "gelf\nstack" {
+			t.Errorf("compression %s full_message got %v", compression, msg["full_message"])
+		}
+
+		// the empty short_message is replaced
+		var debug map[string]interface{}
+		if err := json.Unmarshal(decompressGELF(t, compression, readDatagram(t, server)), &debug); err != nil || debug["short_message"] != gelfNilValue {
+			t.Errorf("debug message got %v", debug)
+		}
+	}
+}
+
+func Test_GELFWriterChunks(t *testing.T) {
+	server := listenGELFUDP(t)
+	defer server.Close()
+
+	w := NewGELFWriter(GELFWriterOptions{
+		Address:     server.LocalAddr().String(),
+		Compression: GELFCompressionNone,
+		ChunkSize:   64,
+		Host:        "node-1",
+	})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	short := strings.Repeat("chunk ", 20)
+	if err := w.Write(newTestGELFRecord(short)); err != nil {
+		t.Fatal(err)
+	}
+
+	var id []byte
+	var data []byte
+	for seq, count := 0, 1; seq < count; seq++ {
+		chunk := readDatagram(t, server)
+		if len(chunk) > 64 || chunk[0] != 0x1e || chunk[1] != 0x0f {
+			t.Fatalf("invalid chunk %v", chunk)
+		}
+		if id == nil {
+			id, count = chunk[2:10], int(chunk[11])
+		}
+		if !bytes.Equal(chunk[2:10], id) || int(chunk[10]) != seq || int(chunk[11]) != count {
+			t.Fatalf("chunk %d header got %v", seq, chunk[:12])
+		}
+		data = append(data, chunk[12:]...)
+	}
+	checkGELFMessage(t, data, strings.TrimSpace(short))
+
+	// too many chunks
+	if err := w.Write(newTestGELFRecord(strings.Repeat("x", 128*52+1))); err == nil {
+		t.Error("message exceeds the max chunks should fail")
+	}
+}
+
+func Test_GELFWriterTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		var msgs []string
+		for len(msgs) < 2 {
+			msg, err := r.ReadString(0)
+			if err != nil {
+				break
+			}
+			msgs = append(msgs, strings.TrimSuffix(msg, "\x00"))
+		}
+		received <- msgs
+	}()
+
+	w := NewGELFWriter(GELFWriterOptions{Network: GELFNetworkTCP, Address: ln.Addr().String(), Host: "node-1"})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for _, msg := range []string{"tcp 1", "tcp 2"} {
+		if err := w.Write(newTestGELFRecord(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case msgs := <-received:
+		if len(msgs) != 2 {
+			t.Fatalf("tcp messages got %v", msgs)
+		}
+		checkGELFMessage(t, []byte(msgs[0]), "tcp 1")
+		checkGELFMessage(t, []byte(msgs[1]), "tcp 2")
+	case <-time.After(5 * time.Second):
+		t.Fatal("tcp messages timeout")
+	}
+}
+
+func Test_GELFWriterOptions(t *testing.T) {
+	for _, options := range []GELFWriterOptions{
+		{},
+		{Network: "unix", Address: "/dev/log"},
+		{Address: "127.0.0.1:12201", Compression: "snappy"},
+		{Address: "127.0.0.1:12201", ChunkSize: 12},
+		{Network: GELFNetworkTCP, Address: "127.0.0.1:12201", Compression: GELFCompressionGzip},
+	} {
+		if err := NewGELFWriter(options).Init(); err == nil {
+			t.Errorf("options %+v should be invalid", options)
+		}
+	}
+	if err := NewGELFWriter(GELFWriterOptions{}).Write(&Record{level: ERROR}); err == nil {
+		t.Error("write before init should fail")
+	}
+}
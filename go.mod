@@ -2,4 +2,10 @@ module github.com/xwi88/log4go
 
 go 1.16
 
-require github.com/Shopify/sarama v1.30.0
+require (
+	github.com/Shopify/sarama v1.30.0
+	github.com/golang/snappy v0.0.4
+	github.com/xdg-go/scram v1.0.2
+	golang.org/x/net v0.0.0-20210917221730-978cfadd31cf
+	golang.org/x/term v0.0.0-20210422114643-f5beecf764ed
+)
@@ -0,0 +1,210 @@
+package log4go
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	httpBatchBytesDefault = 1 << 20
+	httpTimeoutDefault    = 10 * time.Second
+)
+
+// http compressions
+const (
+	HTTPCompressionNone = "none" // default
+	HTTPCompressionGzip = "gzip"
+)
+
+// HTTPBatchOptions the batch, retry and transport options of the http writers
+type HTTPBatchOptions struct {
+	BatchSize     int           `json:"batch_size" mapstructure:"batch_size"`         // records to trigger a send, default 100
+	BatchBytes    int           `json:"batch_bytes" mapstructure:"batch_bytes"`       // encoded bytes to trigger a send, default 1MB
+	FlushInterval time.Duration `json:"flush_interval" mapstructure:"flush_interval"` // max delay of a record, default 1s
+	BufferSize    int           `json:"buffer_size" mapstructure:"buffer_size"`       // queued batches, the oldest dropped when full, default 16
+
+	Compression string            `json:"compression" mapstructure:"compression"`   // none or gzip, default none
+	Headers     map[string]string `json:"headers" mapstructure:"headers"`           // custom request headers
+	BearerToken string            `json:"bearer_token" mapstructure:"bearer_token"` // optional, the Authorization header
+	TLS         TLSOptions        `json:"tls" mapstructure:"tls"`
+	Timeout     time.Duration     `json:"timeout" mapstructure:"timeout"` // request timeout, default 10s
+
+	// retry on the network errors, 5xx and 429, the Retry-After header is honoured
+	RetryMax        int           `json:"retry_max" mapstructure:"retry_max"`                 // default 3, -1 means no retry
+	RetryBackoff    time.Duration `json:"retry_backoff" mapstructure:"retry_backoff"`         // first retry delay, doubled on retries, default 500ms
+	RetryBackoffMax time.Duration `json:"retry_backoff_max" mapstructure:"retry_backoff_max"` // default 30s
+
+	CloseTimeout time.Duration `json:"close_timeout" mapstructure:"close_timeout"` // the deadline to send the queued batches when closed, default 5s
+}
+
+// httpPayload the request of one batch built by the writer
+type httpPayload struct {
+	url         string
+	body        []byte
+	contentType string
+	header      http.Header // optional, extra headers of the writer
+}
+
+// httpBatcher batch the encoded records and send them by the http requests in order
+type httpBatcher struct {
+	*batcher
+	options HTTPBatchOptions
+	method  string
+	client  *http.Client
+
+	// build the request payload of the batch
+	build func(items [][]byte) (*httpPayload, error)
+	// check the response body of the 2xx status, return the items to retry and the number of failed items,
+	// optional, ex: the partial failures of the bulk api
+	check func(items [][]byte, body []byte) (retry [][]byte, failed int, err error)
+	// status check the 2xx response before reading the items result, return the error if the request failed
+	// and whether to retry all the items, optional, ex: the grpc status in the trailers
+	status func(resp *http.Response) (retry bool, err error)
+}
+
+// newHTTPBatcher check the options and create the batcher, start it by start
+func newHTTPBatcher(name, method string, options HTTPBatchOptions) (*httpBatcher, error) {
+	switch options.Compression {
+	case "", HTTPCompressionNone, HTTPCompressionGzip:
+	default:
+		return nil, fmt.Errorf("%s invalid compression (%s)", name, options.Compression)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if options.TLS.Enable {
+		cfg, err := newTLSConfig(options.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("%s %v", name, err)
+		}
+		transport.TLSClientConfig = cfg
+	}
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = httpTimeoutDefault
+	}
+
+	batchBytes := options.BatchBytes
+	if batchBytes <= 0 {
+		batchBytes = httpBatchBytesDefault
+	}
+	b := &httpBatcher{
+		options: options,
+		method:  method,
+		client:  &http.Client{Transport: transport, Timeout: timeout},
+	}
+	b.batcher = newBatcher(name, batchOptions{
+		size:            options.BatchSize,
+		bytes:           batchBytes,
+		flushInterval:   options.FlushInterval,
+		bufferSize:      options.BufferSize,
+		retryMax:        options.RetryMax,
+		retryBackoff:    options.RetryBackoff,
+		retryBackoffMax: options.RetryBackoffMax,
+		closeTimeout:    options.CloseTimeout,
+	}, b.do)
+	return b, nil
+}
+
+// do send the items once, return the items to retry, the number of failed items and the Retry-After delay
+func (b *httpBatcher) do(ctx context.Context, items [][]byte) ([][]byte, int, time.Duration, error) {
+	payload, err := b.build(items)
+	if err != nil {
+		return nil, len(items), 0, err
+	}
+	body := payload.body
+	if b.options.Compression == HTTPCompressionGzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return nil, len(items), 0, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, len(items), 0, err
+		}
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, b.method, payload.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, len(items), 0, err
+	}
+	for k, vs := range payload.header {
+		req.Header[k] = vs
+	}
+	if payload.contentType != "" {
+		req.Header.Set("Content-Type", payload.contentType)
+	}
+	if b.options.Compression == HTTPCompressionGzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range b.options.Headers {
+		req.Header.Set(k, v)
+	}
+	if b.options.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+b.options.BearerToken)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, len(items), 0, err
+		}
+		return items, 0, 0, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 16<<20))
+
+	switch code := resp.StatusCode; {
+	case code >= 200 && code < 300:
+		if b.status != nil {
+			if retry, err := b.status(resp); err != nil {
+				if retry {
+					return items, 0, 0, err
+				}
+				return nil, len(items), 0, err
+			}
+		}
+		if b.check != nil {
+			retry, failed, err := b.check(items, respBody)
+			return retry, failed, 0, err
+		}
+		return nil, 0, 0, nil
+	case code == http.StatusTooManyRequests || code >= 500:
+		return items, 0, httpRetryAfter(resp.Header.Get("Retry-After")), httpStatusError(resp, respBody)
+	default:
+		return nil, len(items), 0, httpStatusError(resp, respBody)
+	}
+}
+
+func httpStatusError(resp *http.Response, body []byte) error {
+	if len(body) > 256 {
+		body = body[:256]
+	}
+	return fmt.Errorf("http status %s: %s", resp.Status, bytes.TrimSpace(body))
+}
+
+// httpRetryAfter parse the Retry-After header in seconds or http date, 0 if not set or invalid
+func httpRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,25 @@
+package log4go
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_HTTPRetryAfter(t *testing.T) {
+	cases := map[string]time.Duration{
+		"":        0,
+		"2":       2 * time.Second,
+		"-1":      0,
+		"invalid": 0,
+		time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat): 0,
+	}
+	for v, want := range cases {
+		if got := httpRetryAfter(v); got != want {
+			t.Errorf("retry after(%s) got %v, want %v", v, got, want)
+		}
+	}
+	if got := httpRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)); got < 59*time.Minute {
+		t.Errorf("retry after http date got %v", got)
+	}
+}
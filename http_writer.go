@@ -0,0 +1,126 @@
+package log4go
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// http writer body formats
+const (
+	HTTPFormatNDJSON = "ndjson" // one json object per line, default
+	HTTPFormatJSON   = "json"   // json array
+)
+
+// HTTPWriterOptions http writer options
+type HTTPWriterOptions struct {
+	Enable bool   `json:"enable" mapstructure:"enable"`
+	Level  string `json:"level" mapstructure:"level"`
+	URL    string `json:"url" mapstructure:"url"`
+	Method string `json:"method" mapstructure:"method"` // default POST
+	Format string `json:"format" mapstructure:"format"` // ndjson or json, default ndjson
+
+	HTTPBatchOptions `mapstructure:",squash"`
+}
+
+// HTTPWriter post the batched json records to the log ingestion endpoint
+type HTTPWriter struct {
+	level   int
+	options HTTPWriterOptions
+	batcher *httpBatcher
+}
+
+// NewHTTPWriter create new http writer
+func NewHTTPWriter(options HTTPWriterOptions) *HTTPWriter {
+	defaultLevel := DEBUG
+	if len(options.Level) > 0 {
+		defaultLevel = getLevelDefault(options.Level, defaultLevel, "")
+	}
+	return &HTTPWriter{
+		level:   defaultLevel,
+		options: options,
+	}
+}
+
+// Init check the options and start the batcher
+func (w *HTTPWriter) Init() (err error) {
+	if w.options.URL == "" {
+		return errors.New("http writer requires url")
+	}
+	method := strings.ToUpper(w.options.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+	var build func(items [][]byte) (*httpPayload, error)
+	switch w.options.Format {
+	case "", HTTPFormatNDJSON:
+		build = w.buildNDJSON
+	case HTTPFormatJSON:
+		build = w.buildJSON
+	default:
+		return fmt.Errorf("http writer invalid format (%s)", w.options.Format)
+	}
+
+	if w.batcher, err = newHTTPBatcher("http writer", method, w.options.HTTPBatchOptions); err != nil {
+		return err
+	}
+	w.batcher.build = build
+	w.batcher.start()
+	return nil
+}
+
+// Write encode the record to json and add it to the batch
+func (w *HTTPWriter) Write(r *Record) error {
+	if r.level > w.level {
+		return nil
+	}
+	if w.batcher == nil {
+		return errors.New("http writer not running")
+	}
+	data, err := encodeRecordJSON(r)
+	if err != nil {
+		return err
+	}
+	return w.batcher.add(bytes.TrimSuffix(data, []byte{'\n'}))
+}
+
+func (w *HTTPWriter) buildNDJSON(items [][]byte) (*httpPayload, error) {
+	var b bytes.Buffer
+	for _, item := range items {
+		b.Write(item)
+		b.WriteByte('\n')
+	}
+	return &httpPayload{url: w.options.URL, body: b.Bytes(), contentType: "application/x-ndjson"}, nil
+}
+
+func (w *HTTPWriter) buildJSON(items [][]byte) (*httpPayload, error) {
+	body := append([]byte{'['}, bytes.Join(items, []byte{','})...)
+	return &httpPayload{url: w.options.URL, body: append(body, ']'), contentType: "application/json"}, nil
+}
+
+// Dropped return the number of records dropped by the full queue
+func (w *HTTPWriter) Dropped() int64 {
+	if w.batcher == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&w.batcher.dropped)
+}
+
+// Failed return the number of records failed to send after retries
+func (w *HTTPWriter) Failed() int64 {
+	if w.batcher == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&w.batcher.failed)
+}
+
+// Close send the buffered records within the close timeout
+func (w *HTTPWriter) Close() error {
+	if w.batcher == nil {
+		return nil
+	}
+	return w.batcher.close()
+}
@@ -0,0 +1,250 @@
+package log4go
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// httpTestRequest the received request
+type httpTestRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// newHTTPTestServer record the requests, the gzip body is decompressed, status decide the response of the nth request
+func newHTTPTestServer(t *testing.T, status func(n int, w http.ResponseWriter) int) (*httptest.Server, func() []httpTestRequest) {
+	var lock sync.Mutex
+	var requests []httpTestRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			body = zr
+		}
+		data, _ := ioutil.ReadAll(body)
+
+		lock.Lock()
+		requests = append(requests, httpTestRequest{header: r.Header, body: data})
+		n := len(requests)
+		lock.Unlock()
+		code := http.StatusOK
+		if status != nil {
+			code = status(n, w)
+		}
+		w.WriteHeader(code)
+	}))
+	return server, func() []httpTestRequest {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]httpTestRequest(nil), requests...)
+	}
+}
+
+func Test_HTTPWriterBatch(t *testing.T) {
+	server, requests := newHTTPTestServer(t, nil)
+	defer server.Close()
+
+	w := NewHTTPWriter(HTTPWriterOptions{
+		URL:   server.URL,
+		Level: "INFO",
+		HTTPBatchOptions: HTTPBatchOptions{
+			BatchSize:     3,
+			FlushInterval: time.Hour,
+			Compression:   HTTPCompressionGzip,
+			Headers:       map[string]string{"X-Tenant": "log4go"},
+			BearerToken:   "secret",
+		},
+	})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 7; i++ {
+		if err := w.Write(&Record{level: INFO, msg: fmt.Sprintf("http %d", i), fields: Fields{"i": i}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Write(&Record{level: DEBUG, msg: "filtered"}); err != nil {
+		t.Fatal(err)
+	}
+	// the last batch is sent when closed
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := requests()
+	if len(got) != 3 {
+		t.Fatalf("requests got %d, want 3", len(got))
+	}
+	i := 0
+	for n, req := range got {
+		if req.header.Get("Content-Type") != "application/x-ndjson" || req.header.Get("X-Tenant") != "log4go" ||
+			req.header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("unexpected request header %v", req.header)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(req.body))
+		lines := 0
+		for scanner.Scan() {
+			var body map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body["message"] != fmt.Sprintf("http %d", i) || body["level"] != LevelFlagInfo {
+				t.Errorf("record %d got %s", i, scanner.Bytes())
+			}
+			i++
+			lines++
+		}
+		if want := []int{3, 3, 1}[n]; lines != want {
+			t.Errorf("batch %d size got %d, want %d", n, lines, want)
+		}
+	}
+	if err := w.Write(&Record{level: INFO, msg: "closed"}); err == nil {
+		t.Error("write should fail after closed")
+	}
+}
+
+func Test_HTTPWriterFlushInterval(t *testing.T) {
+	server, requests := newHTTPTestServer(t, nil)
+	defer server.Close()
+
+	w := NewHTTPWriter(HTTPWriterOptions{
+		URL:              server.URL,
+		Method:           "put",
+		Format:           HTTPFormatJSON,
+		HTTPBatchOptions: HTTPBatchOptions{FlushInterval: 20 * time.Millisecond},
+	})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for i := 0; i < 2; i++ {
+		if err := w.Write(&Record{level: ERROR, msg: "http json"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(requests()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	got := requests()
+	if len(got) != 1 {
+		t.Fatalf("requests got %d, want 1", len(got))
+	}
+	var records []map[string]interface{}
+	if err := json.Unmarshal(got[0].body, &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1]["message"] != "http json" || got[0].header.Get("Content-Type") != "application/json" {
+		t.Errorf("json batch got %s", got[0].body)
+	}
+}
+
+func Test_HTTPWriterRetry(t *testing.T) {
+	server, requests := newHTTPTestServer(t, func(n int, w http.ResponseWriter) int {
+		switch n {
+		case 1:
+			return http.StatusServiceUnavailable
+		case 2:
+			w.Header().Set("Retry-After", "1")
+			return http.StatusTooManyRequests
+		case 3:
+			return http.StatusOK
+		}
+		return http.StatusBadRequest
+	})
+	defer server.Close()
+
+	w := NewHTTPWriter(HTTPWriterOptions{
+		URL:              server.URL,
+		HTTPBatchOptions: HTTPBatchOptions{BatchSize: 1, RetryBackoff: 10 * time.Millisecond},
+	})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := w.Write(&Record{level: ERROR, msg: "http retry"}); err != nil {
+		t.Fatal(err)
+	}
+	// 400 is not retried
+	if err := w.Write(&Record{level: ERROR, msg: "http bad request"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retry should wait the Retry-After, elapsed %v", elapsed)
+	}
+	if got := requests(); len(got) != 4 || !bytes.Contains(got[3].body, []byte("http bad request")) {
+		t.Errorf("requests got %d", len(got))
+	}
+	if w.Failed() != 1 || w.Dropped() != 0 {
+		t.Errorf("failed got %d, dropped got %d", w.Failed(), w.Dropped())
+	}
+}
+
+func Test_HTTPWriterCloseTimeout(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	defer close(block)
+
+	w := NewHTTPWriter(HTTPWriterOptions{
+		URL:              server.URL,
+		HTTPBatchOptions: HTTPBatchOptions{BatchSize: 1, CloseTimeout: 50 * time.Millisecond},
+	})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := w.Write(&Record{level: ERROR, msg: "http close"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now()
+	if err := w.Close(); err == nil || !strings.Contains(err.Error(), "undelivered") {
+		t.Errorf("close got err: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("close should return by the timeout, elapsed %v", elapsed)
+	}
+}
+
+func Test_HTTPWriterOptions(t *testing.T) {
+	for _, options := range []HTTPWriterOptions{
+		{},
+		{URL: "http://127.0.0.1", Format: "xml"},
+		{URL: "http://127.0.0.1", HTTPBatchOptions: HTTPBatchOptions{Compression: "br"}},
+		{URL: "http://127.0.0.1", HTTPBatchOptions: HTTPBatchOptions{TLS: TLSOptions{Enable: true, CertFile: "cert.pem"}}},
+	} {
+		if err := NewHTTPWriter(options).Init(); err == nil {
+			t.Errorf("options %+v should be invalid", options)
+		}
+	}
+
+	var options HTTPWriterOptions
+	if err := json.Unmarshal([]byte(`{"url": "http://127.0.0.1", "batch_size": 10, "headers": {"X-Tenant": "log4go"}}`), &options); err != nil {
+		t.Fatal(err)
+	}
+	if options.BatchSize != 10 || options.Headers["X-Tenant"] != "log4go" {
+		t.Errorf("unexpected options %+v", options)
+	}
+}
@@ -0,0 +1,36 @@
+package log4go
+
+const journaldSocketDefault = "/run/systemd/journal/socket"
+
+// JournaldWriterOptions journald writer options, the writer is only supported on linux
+type JournaldWriterOptions struct {
+	Enable     bool   `json:"enable" mapstructure:"enable"`
+	Level      string `json:"level" mapstructure:"level"`
+	SocketPath string `json:"socket_path" mapstructure:"socket_path"` // default /run/systemd/journal/socket
+	Identifier string `json:"identifier" mapstructure:"identifier"`   // the SYSLOG_IDENTIFIER, default the program name
+}
+
+// journaldFieldName the field name is uppercase ascii letters, digits and underscores, at most 64 chars,
+// not starting with underscore or digit which are reserved by journald, empty if nothing left
+func journaldFieldName(k string) string {
+	b := make([]byte, 0, len(k))
+	for i := 0; i < len(k) && len(b) < 64; i++ {
+		c := k[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+			c -= 'a' - 'A'
+		case c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' || c == '_':
+			if len(b) == 0 {
+				continue
+			}
+		default:
+			if len(b) == 0 {
+				continue
+			}
+			c = '_'
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
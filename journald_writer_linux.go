@@ -0,0 +1,238 @@
+//go:build linux
+// +build linux
+
+package log4go
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	journaldMemfdFlags = 0x1 | 0x2  // MFD_CLOEXEC | MFD_ALLOW_SEALING
+	journaldAddSeals   = 1033       // F_ADD_SEALS
+	journaldSeals      = 0xf        // F_SEAL_SEAL | F_SEAL_SHRINK | F_SEAL_GROW | F_SEAL_WRITE
+	journaldShmDir     = "/dev/shm" // the fallback of memfd
+)
+
+// journaldMemfdCreate the memfd_create syscall numbers, not defined by the syscall package
+var journaldMemfdCreate = map[string]uintptr{
+	"386":     356,
+	"amd64":   319,
+	"arm":     385,
+	"arm64":   279,
+	"ppc64":   360,
+	"ppc64le": 360,
+	"riscv64": 279,
+	"s390x":   350,
+}
+
+// journaldReserved the fields set by the writer, the record fields with the same name are prefixed with FIELD_
+var journaldReserved = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"SYSLOG_IDENTIFIER": true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"CODE_FUNC":         true,
+}
+
+// JournaldWriter write the records to systemd-journald by the native protocol
+type JournaldWriter struct {
+	level      int
+	options    JournaldWriterOptions
+	identifier string
+
+	lock sync.Mutex
+	conn *net.UnixConn
+}
+
+// NewJournaldWriter create new journald writer
+func NewJournaldWriter(options JournaldWriterOptions) *JournaldWriter {
+	defaultLevel := DEBUG
+	if len(options.Level) > 0 {
+		defaultLevel = getLevelDefault(options.Level, defaultLevel, "")
+	}
+	return &JournaldWriter{
+		level:   defaultLevel,
+		options: options,
+	}
+}
+
+// Init connect the journal socket
+func (w *JournaldWriter) Init() error {
+	if w.options.SocketPath == "" {
+		w.options.SocketPath = journaldSocketDefault
+	}
+	w.identifier = w.options.Identifier
+	if w.identifier == "" {
+		w.identifier = filepath.Base(os.Args[0])
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if err := w.connect(); err != nil {
+		return fmt.Errorf("journald writer connect err: %v", err)
+	}
+	return nil
+}
+
+func (w *JournaldWriter) connect() (err error) {
+	w.conn, err = net.DialUnix("unixgram", nil, &net.UnixAddr{Name: w.options.SocketPath, Net: "unixgram"})
+	return err
+}
+
+// appendJournaldField KEY=value, or KEY\n, the little endian 64 bits size and the value if multiline
+func appendJournaldField(b []byte, key, value string) []byte {
+	b = append(b, key...)
+	if strings.IndexByte(value, '\n') < 0 {
+		b = append(b, '=')
+		b = append(b, value...)
+		return append(b, '\n')
+	}
+	b = append(b, '\n')
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	b = append(b, size[:]...)
+	b = append(b, value...)
+	return append(b, '\n')
+}
+
+// format the journal entry of the record
+func (w *JournaldWriter) format(r *Record) []byte {
+	b := appendJournaldField(nil, "MESSAGE", r.msg)
+	b = appendJournaldField(b, "PRIORITY", strconv.Itoa(r.level)) // the log4go levels are the syslog priorities
+	b = appendJournaldField(b, "SYSLOG_IDENTIFIER", w.identifier)
+	if r.fileName != "" {
+		b = appendJournaldField(b, "CODE_FILE", r.fileName)
+		b = appendJournaldField(b, "CODE_LINE", strconv.Itoa(r.line))
+	}
+	if funcName := r.function(); funcName != "" {
+		b = appendJournaldField(b, "CODE_FUNC", funcName)
+	}
+	for _, k := range r.fields.sortedKeys() {
+		name := journaldFieldName(k)
+		if name == "" {
+			continue
+		}
+		if journaldReserved[name] {
+			name = "FIELD_" + name
+		}
+		var value string
+		switch v := r.fields[k].(type) {
+		case string:
+			value = v
+		case error:
+			value = v.Error()
+		default:
+			value = fmt.Sprint(v)
+		}
+		b = appendJournaldField(b, name, value)
+	}
+	return b
+}
+
+// Write send the record, the large entry is passed by the memfd
+func (w *JournaldWriter) Write(r *Record) error {
+	if r.level > w.level {
+		return nil
+	}
+	data := w.format(r)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	var err error
+	for i := 0; i < 2; i++ {
+		if w.conn == nil {
+			if err = w.connect(); err != nil {
+				break
+			}
+		}
+		if _, err = w.conn.Write(data); err == nil {
+			return nil
+		}
+		if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+			err = w.sendFile(data)
+			break
+		}
+		// journald restarted, redial the socket
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	if err != nil {
+		return fmt.Errorf("journald writer send %d bytes err: %v", len(data), err)
+	}
+	return nil
+}
+
+// sendFile write the entry to the sealed memfd, or the unlinked file in /dev/shm, and pass the fd
+func (w *JournaldWriter) sendFile(data []byte) error {
+	f, sealable, err := journaldTempFile()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if sealable {
+		if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), journaldAddSeals, journaldSeals); errno != 0 {
+			return fmt.Errorf("seal memfd err: %v", errno)
+		}
+	}
+	// WriteMsgUnix refuses the connected datagram socket, send by the raw fd
+	rc, err := w.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(f.Fd()))
+	if werr := rc.Write(func(fd uintptr) bool {
+		err = syscall.Sendmsg(int(fd), nil, rights, nil, 0)
+		return err != syscall.EAGAIN
+	}); werr != nil {
+		return werr
+	}
+	return err
+}
+
+// journaldTempFile create the memfd, or the unlinked file in /dev/shm if memfd is unsupported
+func journaldTempFile() (f *os.File, sealable bool, err error) {
+	if trap, ok := journaldMemfdCreate[runtime.GOARCH]; ok {
+		name, err := syscall.BytePtrFromString("log4go-journal")
+		if err != nil {
+			return nil, false, err
+		}
+		fd, _, errno := syscall.Syscall(trap, uintptr(unsafe.Pointer(name)), journaldMemfdFlags, 0)
+		if errno == 0 {
+			return os.NewFile(fd, "memfd:log4go-journal"), true, nil
+		}
+	}
+	if f, err = ioutil.TempFile(journaldShmDir, "log4go-journal-"); err != nil {
+		return nil, false, err
+	}
+	_ = os.Remove(f.Name())
+	return f, false, nil
+}
+
+// Close close the socket
+func (w *JournaldWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
@@ -0,0 +1,258 @@
+package log4go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// parseJournaldEntry decode the native protocol fields
+func parseJournaldEntry(t *testing.T, b []byte) map[string]string {
+	fields := make(map[string]string)
+	for len(b) > 0 {
+		i := bytes.IndexAny(b, "=\n")
+		if i < 0 {
+			t.Fatalf("invalid entry %q", b)
+		}
+		key := string(b[:i])
+		if b[i] == '=' {
+			end := bytes.IndexByte(b[i:], '\n')
+			fields[key] = string(b[i+1 : i+end])
+			b = b[i+end+1:]
+			continue
+		}
+		b = b[i+1:]
+		size := int(binary.LittleEndian.Uint64(b[:8]))
+		fields[key] = string(b[8 : 8+size])
+		if b[8+size] != '\n' {
+			t.Fatalf("field %s not terminated", key)
+		}
+		b = b[9+size:]
+	}
+	return fields
+}
+
+// newJournaldTestSocket listen the fake journal socket
+func newJournaldTestSocket(t *testing.T) (string, *net.UnixConn) {
+	dir, err := ioutil.TempDir("", "log4go-journald")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+		_ = os.RemoveAll(dir)
+	})
+	return path, conn
+}
+
+// readJournaldEntry read the datagram, or the file passed by the fd
+func readJournaldEntry(t *testing.T, conn *net.UnixConn) (map[string]string, *os.File) {
+	buf := make([]byte, 1<<16)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oobn == 0 {
+		return parseJournaldEntry(t, buf[:n]), nil
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		t.Fatal(err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("fds got %v, err %v", fds, err)
+	}
+	f := os.NewFile(uintptr(fds[0]), "journal")
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, fi.Size())
+	if _, err := f.ReadAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+	return parseJournaldEntry(t, data), f
+}
+
+func Test_appendJournaldField(t *testing.T) {
+	b := appendJournaldField(nil, "MESSAGE", "one line")
+	b = appendJournaldField(b, "EMPTY", "")
+	b = appendJournaldField(b, "STACK", "a\nb\n")
+	want := []byte("MESSAGE=one line\nEMPTY=\nSTACK\n\x04\x00\x00\x00\x00\x00\x00\x00a\nb\n\n")
+	if !bytes.Equal(b, want) {
+		t.Errorf("fields got %q, want %q", b, want)
+	}
+}
+
+func Test_JournaldWriterFormat(t *testing.T) {
+	w := &JournaldWriter{identifier: "order"}
+	r := &Record{
+		level: CRITICAL, msg: "db down", fileName: "/app/main.go", line: 7, funcName: "main.run",
+		fields: Fields{"priority": 1, "code_file": "x.go", "syslog-identifier": "other", "err": errors.New("timeout\nretry")},
+	}
+	want := "MESSAGE=db down\nPRIORITY=2\nSYSLOG_IDENTIFIER=order\nCODE_FILE=/app/main.go\nCODE_LINE=7\nCODE_FUNC=main.run\n" +
+		"FIELD_CODE_FILE=x.go\nERR\n\x0d\x00\x00\x00\x00\x00\x00\x00timeout\nretry\nFIELD_PRIORITY=1\nFIELD_SYSLOG_IDENTIFIER=other\n"
+	if got := string(w.format(r)); got != want {
+		t.Errorf("format got %q, want %q", got, want)
+	}
+
+	// the source is omitted without the caller
+	if got := string(w.format(&Record{level: DEBUG, msg: "m"})); got != "MESSAGE=m\nPRIORITY=7\nSYSLOG_IDENTIFIER=order\n" {
+		t.Errorf("format got %q", got)
+	}
+}
+
+func Test_JournaldWriter(t *testing.T) {
+	path, conn := newJournaldTestSocket(t)
+	w := NewJournaldWriter(JournaldWriterOptions{SocketPath: path, Identifier: "order", Level: "info"})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err := w.Write(&Record{level: DEBUG, msg: "ignored"}); err != nil {
+		t.Fatal(err)
+	}
+	r := &Record{
+		level: WARNING, msg: "first line\nsecond line", fileName: "/app/main.go", line: 42, funcName: "main.main",
+		fields: Fields{"user-id": 7, "message": "dup", "_hidden": "x", "--": "skipped"},
+	}
+	if err := w.Write(r); err != nil {
+		t.Fatal(err)
+	}
+	fields, _ := readJournaldEntry(t, conn)
+	want := map[string]string{
+		"MESSAGE":           "first line\nsecond line",
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "order",
+		"CODE_FILE":         "/app/main.go",
+		"CODE_LINE":         "42",
+		"CODE_FUNC":         "main.main",
+		"USER_ID":           "7",
+		"FIELD_MESSAGE":     "dup",
+		"HIDDEN":            "x",
+	}
+	if len(fields) != len(want) {
+		t.Errorf("fields got %v", fields)
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("field %s got %q, want %q", k, fields[k], v)
+		}
+	}
+}
+
+func Test_JournaldWriterLarge(t *testing.T) {
+	path, conn := newJournaldTestSocket(t)
+	w := NewJournaldWriter(JournaldWriterOptions{SocketPath: path})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// larger than the socket send buffer
+	msg := strings.Repeat("x", 1<<20)
+	if err := w.Write(&Record{level: ERROR, msg: msg}); err != nil {
+		t.Fatal(err)
+	}
+	fields, f := readJournaldEntry(t, conn)
+	if f == nil {
+		t.Fatal("large entry should be passed by fd")
+	}
+	defer f.Close()
+	if fields["MESSAGE"] != msg || fields["PRIORITY"] != "3" || fields["SYSLOG_IDENTIFIER"] != filepath.Base(os.Args[0]) {
+		t.Errorf("fields got %d bytes message, priority %s, identifier %s",
+			len(fields["MESSAGE"]), fields["PRIORITY"], fields["SYSLOG_IDENTIFIER"])
+	}
+	// the memfd is sealed against writing
+	if _, err := f.WriteAt([]byte("y"), 0); err == nil {
+		t.Error("the passed file should be sealed")
+	}
+}
+
+func Test_JournaldWriterShmFallback(t *testing.T) {
+	if fi, err := os.Stat(journaldShmDir); err != nil || !fi.IsDir() {
+		t.Skipf("%s not available", journaldShmDir)
+	}
+	// memfd_create unknown on the arch
+	trap, ok := journaldMemfdCreate[runtime.GOARCH]
+	delete(journaldMemfdCreate, runtime.GOARCH)
+	defer func() {
+		if ok {
+			journaldMemfdCreate[runtime.GOARCH] = trap
+		}
+	}()
+
+	path, conn := newJournaldTestSocket(t)
+	w := NewJournaldWriter(JournaldWriterOptions{SocketPath: path})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	msg := strings.Repeat("y", 1<<20)
+	if err := w.Write(&Record{level: NOTICE, msg: msg}); err != nil {
+		t.Fatal(err)
+	}
+	fields, f := readJournaldEntry(t, conn)
+	if f == nil {
+		t.Fatal("large entry should be passed by fd")
+	}
+	defer f.Close()
+	if fields["MESSAGE"] != msg || fields["PRIORITY"] != "5" {
+		t.Errorf("fields got %d bytes message, priority %s", len(fields["MESSAGE"]), fields["PRIORITY"])
+	}
+	// the file in /dev/shm is unlinked after created
+	link, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(link, filepath.Join(journaldShmDir, "log4go-journal-")) || !strings.HasSuffix(link, "(deleted)") {
+		t.Errorf("the passed file got %s", link)
+	}
+}
+
+func Test_JournaldWriterReconnect(t *testing.T) {
+	path, conn := newJournaldTestSocket(t)
+	w := NewJournaldWriter(JournaldWriterOptions{SocketPath: path})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// journald restarted with the new socket at the same path
+	_ = conn.Close()
+	_ = os.Remove(path)
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := w.Write(&Record{level: INFO, msg: "again"}); err != nil {
+		t.Fatal(err)
+	}
+	if fields, _ := readJournaldEntry(t, conn); fields["MESSAGE"] != "again" {
+		t.Errorf("fields got %v", fields)
+	}
+
+	if err := NewJournaldWriter(JournaldWriterOptions{SocketPath: path + ".missing"}).Init(); err == nil {
+		t.Error("init without the socket should fail")
+	}
+}
@@ -0,0 +1,44 @@
+//go:build !linux
+// +build !linux
+
+package log4go
+
+import "errors"
+
+var errJournaldUnsupported = errors.New("journald writer is only supported on linux")
+
+// JournaldWriter write the records to systemd-journald, unsupported on this platform
+type JournaldWriter struct {
+	level   int
+	options JournaldWriterOptions
+}
+
+// NewJournaldWriter create new journald writer
+func NewJournaldWriter(options JournaldWriterOptions) *JournaldWriter {
+	defaultLevel := DEBUG
+	if len(options.Level) > 0 {
+		defaultLevel = getLevelDefault(options.Level, defaultLevel, "")
+	}
+	return &JournaldWriter{
+		level:   defaultLevel,
+		options: options,
+	}
+}
+
+// Init return the unsupported error
+func (w *JournaldWriter) Init() error {
+	return errJournaldUnsupported
+}
+
+// Write return the unsupported error
+func (w *JournaldWriter) Write(r *Record) error {
+	if r.level > w.level {
+		return nil
+	}
+	return errJournaldUnsupported
+}
+
+// Close nothing to close
+func (w *JournaldWriter) Close() error {
+	return nil
+}
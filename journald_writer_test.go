@@ -0,0 +1,21 @@
+package log4go
+
+import "testing"
+
+func Test_journaldFieldName(t *testing.T) {
+	for k, want := range map[string]string{
+		"user":        "USER",
+		"request-id":  "REQUEST_ID",
+		"http.status": "HTTP_STATUS",
+		"_source":     "SOURCE",
+		"9lives":      "LIVES",
+		"__1a_b":      "A_B",
+		"-._":         "",
+		"用户id":        "ID",
+		"a_very_long_field_name_that_is_longer_than_the_journald_limit_of_64": "A_VERY_LONG_FIELD_NAME_THAT_IS_LONGER_THAN_THE_JOURNALD_LIMIT_OF",
+	} {
+		if got := journaldFieldName(k); got != want {
+			t.Errorf("field %q got %q, want %q", k, got, want)
+		}
+	}
+}
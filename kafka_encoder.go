@@ -0,0 +1,220 @@
+package log4go
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// kafka message value encodings
+const (
+	KafKaEncodingJSON     = "json"     // json by the envelope, default
+	KafKaEncodingProtobuf = "protobuf" // schemas/log_record.proto
+	KafKaEncodingAvro     = "avro"     // schemas/log_record.avsc with confluent wire format
+)
+
+// kafkaAvroMagic confluent wire format: magic byte(0) + schema id(4, big endian) + avro binary
+const kafkaAvroMagic = byte(0)
+
+// KafKaEntry the log entry to encode, the header keys have been removed from the Body and Fields
+type KafKaEntry struct {
+	Time time.Time
+
+	// the source values of the body keys, not changed by the envelope
+	ESIndex  string
+	Level    string
+	File     string
+	Message  string
+	ServerIP string
+	Host     string
+
+	Body   map[string]interface{} // es_index, level, file, message, server_ip, host, timestamp, now, extra_fields and the extra fields
+	Fields map[string]interface{} // the record fields
+}
+
+// KafKaValueEncoder encode the log entry to the kafka message value
+type KafKaValueEncoder interface {
+	Encode(entry *KafKaEntry) ([]byte, error)
+}
+
+// initEncoder set the value encoder by the encoding, the custom value encoder first
+func (k *KafKaWriter) initEncoder() error {
+	if k.options.ValueEncoder != nil {
+		k.encoder = k.options.ValueEncoder
+		return nil
+	}
+	switch k.options.Encoding {
+	case "", KafKaEncodingJSON:
+		k.encoder = &kafkaJSONEncoder{k: k}
+	case KafKaEncodingProtobuf:
+		k.encoder = kafkaProtobufEncoder{}
+	case KafKaEncodingAvro:
+		if k.options.AvroSchemaID <= 0 {
+			return fmt.Errorf("kafka writer encoding avro requires avro_schema_id")
+		}
+		k.encoder = &kafkaAvroEncoder{schemaID: k.options.AvroSchemaID}
+	default:
+		return fmt.Errorf("kafka writer invalid encoding (%s)", k.options.Encoding)
+	}
+	return nil
+}
+
+// kafkaLogRecord the fixed schema of the binary encodings
+type kafkaLogRecord struct {
+	esIndex   string
+	level     string
+	file      string
+	message   string
+	serverIP  string
+	host      string
+	timestamp int64 // epoch millis
+	fields    map[string]string
+}
+
+// newKafkaLogRecord the schema columns are the entry source values, the extra body keys and the record fields
+// are put into the fields
+func newKafkaLogRecord(entry *KafKaEntry) *kafkaLogRecord {
+	r := &kafkaLogRecord{
+		esIndex:  entry.ESIndex,
+		level:    entry.Level,
+		file:     entry.File,
+		message:  entry.Message,
+		serverIP: entry.ServerIP,
+		host:     entry.Host,
+		fields:   make(map[string]string, len(entry.Body)+len(entry.Fields)),
+	}
+	if !entry.Time.IsZero() {
+		r.timestamp = entry.Time.UnixNano() / int64(time.Millisecond)
+	}
+	for key, v := range entry.Body {
+		switch key {
+		case "es_index", "level", "file", "message", "server_ip", "host", "timestamp", "now", "extra_fields":
+		default:
+			r.fields[key] = kafkaStringValue(v)
+		}
+	}
+	for key, v := range entry.Fields {
+		if _, ok := r.fields[key]; !ok {
+			r.fields[key] = kafkaStringValue(v)
+		}
+	}
+	return r
+}
+
+func (r *kafkaLogRecord) sortedFields() []string {
+	keys := make([]string, 0, len(r.fields))
+	for key := range r.fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// kafkaStringValue the not string values are encoded as json
+func kafkaStringValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// kafkaProtobufEncoder encode the entry to schemas/log_record.proto LogRecord
+type kafkaProtobufEncoder struct{}
+
+// protobuf wire types
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+	protoWireFixed32 = 5
+)
+
+func appendProtoVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendProtoString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = appendProtoVarint(b, uint64(field<<3|protoWireBytes))
+	b = appendProtoVarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// Encode the proto3 default values are omitted
+func (kafkaProtobufEncoder) Encode(entry *KafKaEntry) ([]byte, error) {
+	r := newKafkaLogRecord(entry)
+	b := make([]byte, 0, 128)
+	b = appendProtoString(b, 1, r.esIndex)
+	b = appendProtoString(b, 2, r.level)
+	b = appendProtoString(b, 3, r.file)
+	b = appendProtoString(b, 4, r.message)
+	b = appendProtoString(b, 5, r.serverIP)
+	b = appendProtoString(b, 6, r.host)
+	if r.timestamp != 0 {
+		b = appendProtoVarint(b, uint64(7<<3|protoWireVarint))
+		b = appendProtoVarint(b, uint64(r.timestamp))
+	}
+	for _, key := range r.sortedFields() {
+		// map entry message: key = 1, value = 2
+		var e []byte
+		e = appendProtoString(e, 1, key)
+		e = appendProtoString(e, 2, r.fields[key])
+		b = appendProtoVarint(b, uint64(8<<3|protoWireBytes))
+		b = appendProtoVarint(b, uint64(len(e)))
+		b = append(b, e...)
+	}
+	return b, nil
+}
+
+// kafkaAvroEncoder encode the entry to schemas/log_record.avsc LogRecord with the confluent wire format
+type kafkaAvroEncoder struct {
+	schemaID int32
+}
+
+func appendAvroLong(b []byte, v int64) []byte {
+	return appendProtoVarint(b, uint64((v<<1)^(v>>63)))
+}
+
+func appendAvroString(b []byte, s string) []byte {
+	b = appendAvroLong(b, int64(len(s)))
+	return append(b, s...)
+}
+
+// Encode the fields map is written in one block
+func (e *kafkaAvroEncoder) Encode(entry *KafKaEntry) ([]byte, error) {
+	r := newKafkaLogRecord(entry)
+	b := make([]byte, 5, 128)
+	b[0] = kafkaAvroMagic
+	binary.BigEndian.PutUint32(b[1:5], uint32(e.schemaID))
+
+	b = appendAvroString(b, r.esIndex)
+	b = appendAvroString(b, r.level)
+	b = appendAvroString(b, r.file)
+	b = appendAvroString(b, r.message)
+	b = appendAvroString(b, r.serverIP)
+	b = appendAvroString(b, r.host)
+	b = appendAvroLong(b, r.timestamp)
+	if len(r.fields) > 0 {
+		b = appendAvroLong(b, int64(len(r.fields)))
+		for _, key := range r.sortedFields() {
+			b = appendAvroString(b, key)
+			b = appendAvroString(b, r.fields[key])
+		}
+	}
+	return appendAvroLong(b, 0), nil
+}
@@ -0,0 +1,300 @@
+package log4go
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// the encoded fields order of the schemas
+var kafkaLogRecordSchemaFields = []string{"es_index", "level", "file", "message", "server_ip", "host", "timestamp", "fields"}
+
+func newTestKafkaEntry() (*KafKaWriter, *Record, *kafkaLogRecord) {
+	w := NewKafKaWriter(KafKaWriterOptions{MSG: KafKaMSGFields{
+		ESIndex:     "log4go",
+		ServerIP:    "127.0.0.1",
+		Host:        "node-1",
+		ExtraFields: map[string]interface{}{"app": "log4go", "version": 2},
+	}})
+	now := time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+	r := &Record{
+		level:  WARNING,
+		file:   "kafka.go:12",
+		msg:    "encoder",
+		now:    now,
+		fields: Fields{"user": "xwi88", "ids": []int{1, 2}, "err": errors.New("timeout"), "app": "ignored"},
+	}
+	want := &kafkaLogRecord{
+		esIndex:   "log4go",
+		level:     "WARNING",
+		file:      "kafka.go:12",
+		message:   "encoder",
+		serverIP:  "127.0.0.1",
+		host:      "node-1",
+		timestamp: now.UnixNano() / int64(time.Millisecond),
+		fields:    map[string]string{"app": "log4go", "version": "2", "user": "xwi88", "ids": "[1,2]", "err": "timeout"},
+	}
+	return w, r, want
+}
+
+func readProtoVarint(t *testing.T, b []byte) (uint64, []byte) {
+	v, n := binary.Uvarint(b)
+	if n <= 0 {
+		t.Fatalf("invalid varint %v", b)
+	}
+	return v, b[n:]
+}
+
+func readProtoBytes(t *testing.T, b []byte) ([]byte, []byte) {
+	n, b := readProtoVarint(t, b)
+	if uint64(len(b)) < n {
+		t.Fatalf("invalid bytes length %d", n)
+	}
+	return b[:n], b[n:]
+}
+
+// decodeProtoLogRecord decode schemas/log_record.proto LogRecord
+func decodeProtoLogRecord(t *testing.T, b []byte) *kafkaLogRecord {
+	r := &kafkaLogRecord{fields: map[string]string{}}
+	for len(b) > 0 {
+		var tag uint64
+		tag, b = readProtoVarint(t, b)
+		if tag == 7<<3|protoWireVarint {
+			var v uint64
+			v, b = readProtoVarint(t, b)
+			r.timestamp = int64(v)
+			continue
+		}
+		if tag&7 != protoWireBytes {
+			t.Fatalf("unexpected tag %d", tag)
+		}
+		var v []byte
+		v, b = readProtoBytes(t, b)
+		switch tag >> 3 {
+		case 1:
+			r.esIndex = string(v)
+		case 2:
+			r.level = string(v)
+		case 3:
+			r.file = string(v)
+		case 4:
+			r.message = string(v)
+		case 5:
+			r.serverIP = string(v)
+		case 6:
+			r.host = string(v)
+		case 8:
+			var key, value []byte
+			for len(v) > 0 {
+				var entryTag uint64
+				var s []byte
+				entryTag, v = readProtoVarint(t, v)
+				s, v = readProtoBytes(t, v)
+				if entryTag>>3 == 1 {
+					key = s
+				} else {
+					value = s
+				}
+			}
+			r.fields[string(key)] = string(value)
+		default:
+			t.Fatalf("unexpected field %d", tag>>3)
+		}
+	}
+	return r
+}
+
+func readAvroLong(t *testing.T, b []byte) (int64, []byte) {
+	v, n := binary.Varint(b)
+	if n <= 0 {
+		t.Fatalf("invalid avro long %v", b)
+	}
+	return v, b[n:]
+}
+
+func readAvroString(t *testing.T, b []byte) (string, []byte) {
+	n, b := readAvroLong(t, b)
+	if int64(len(b)) < n {
+		t.Fatalf("invalid avro string length %d", n)
+	}
+	return string(b[:n]), b[n:]
+}
+
+// decodeAvroLogRecord decode schemas/log_record.avsc LogRecord with the confluent wire format
+func decodeAvroLogRecord(t *testing.T, b []byte) (int32, *kafkaLogRecord) {
+	if len(b) < 5 || b[0] != kafkaAvroMagic {
+		t.Fatalf("invalid confluent wire format %v", b)
+	}
+	schemaID := int32(binary.BigEndian.Uint32(b[1:5]))
+	b = b[5:]
+
+	r := &kafkaLogRecord{fields: map[string]string{}}
+	for _, s := range []*string{&r.esIndex, &r.level, &r.file, &r.message, &r.serverIP, &r.host} {
+		*s, b = readAvroString(t, b)
+	}
+	r.timestamp, b = readAvroLong(t, b)
+	for {
+		var count int64
+		count, b = readAvroLong(t, b)
+		if count == 0 {
+			break
+		}
+		for i := int64(0); i < count; i++ {
+			var key, value string
+			key, b = readAvroString(t, b)
+			value, b = readAvroString(t, b)
+			r.fields[key] = value
+		}
+	}
+	if len(b) != 0 {
+		t.Fatalf("avro record has %d trailing bytes", len(b))
+	}
+	return schemaID, r
+}
+
+func Test_KafKaProtobufEncoder(t *testing.T) {
+	w, r, want := newTestKafkaEntry()
+	w.options.Encoding = KafKaEncodingProtobuf
+	if _, err := w.newConfig(); err != nil {
+		t.Fatal(err)
+	}
+	value, _, err := w.encodeRecord(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decodeProtoLogRecord(t, value); !reflect.DeepEqual(got, want) {
+		t.Errorf("protobuf round trip got %+v, want %+v", got, want)
+	}
+
+	// the empty strings are omitted as proto3 default
+	value, _ = kafkaProtobufEncoder{}.Encode(&KafKaEntry{Level: "INFO", Body: map[string]interface{}{"level": "INFO"}})
+	if !reflect.DeepEqual(value, []byte{2<<3 | protoWireBytes, 4, 'I', 'N', 'F', 'O'}) {
+		t.Errorf("protobuf minimal got %v", value)
+	}
+}
+
+func Test_KafKaProtobufEncoderEnvelope(t *testing.T) {
+	w, r, want := newTestKafkaEntry()
+	w.options.Encoding = KafKaEncodingProtobuf
+	w.options.Envelope = KafKaEnvelopeOptions{
+		Rename:    map[string]string{"message": "msg", "level": "severity", "es_index": "index"},
+		Omit:      []string{"server_ip"},
+		FieldsKey: "fields",
+		Headers:   []string{"level", "user"},
+	}
+	if _, err := w.newConfig(); err != nil {
+		t.Fatal(err)
+	}
+	value, headers, err := w.encodeRecord(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the renamed, omitted and header keys keep the schema columns, the header fields are removed
+	delete(want.fields, "user")
+	if got := decodeProtoLogRecord(t, value); !reflect.DeepEqual(got, want) {
+		t.Errorf("protobuf envelope got %+v, want %+v", got, want)
+	}
+	if len(headers) != 2 || string(headers[0].Key) != "severity" || string(headers[1].Value) != "xwi88" {
+		t.Errorf("protobuf headers got %v", headers)
+	}
+}
+
+func Test_KafKaAvroEncoder(t *testing.T) {
+	w, r, want := newTestKafkaEntry()
+	w.options.Encoding = KafKaEncodingAvro
+	w.options.AvroSchemaID = 42
+	w.options.Envelope.Headers = []string{"host"}
+	if _, err := w.newConfig(); err != nil {
+		t.Fatal(err)
+	}
+	value, headers, err := w.encodeRecord(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the header key keeps the schema column
+	schemaID, got := decodeAvroLogRecord(t, value)
+	if schemaID != 42 || !reflect.DeepEqual(got, want) {
+		t.Errorf("avro round trip got %d %+v, want %+v", schemaID, got, want)
+	}
+	if len(headers) != 1 || string(headers[0].Value) != "node-1" {
+		t.Errorf("avro headers got %v", headers)
+	}
+
+	value, _ = (&kafkaAvroEncoder{schemaID: 1}).Encode(&KafKaEntry{Body: map[string]interface{}{}})
+	if _, got := decodeAvroLogRecord(t, value); len(got.fields) != 0 || got.timestamp != 0 {
+		t.Errorf("avro empty record got %+v", got)
+	}
+}
+
+func Test_KafKaEncoderSchemas(t *testing.T) {
+	data, err := ioutil.ReadFile("schemas/log_record.avsc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var avsc struct {
+		Name   string `json:"name"`
+		Fields []struct {
+			Name string `json:"name"`
+		} `json:"fields"`
+	}
+	if err := json.Unmarshal(data, &avsc); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range avsc.Fields {
+		names = append(names, f.Name)
+	}
+	if avsc.Name != "LogRecord" || !reflect.DeepEqual(names, kafkaLogRecordSchemaFields) {
+		t.Errorf("avro schema %s fields got %v, want %v", avsc.Name, names, kafkaLogRecordSchemaFields)
+	}
+
+	data, err = ioutil.ReadFile("schemas/log_record.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = names[:0]
+	for i, m := range regexp.MustCompile(`(\w+) = (\d+);`).FindAllStringSubmatch(string(data), -1) {
+		if m[2] != string(rune('1'+i)) {
+			t.Errorf("proto field %s number got %s, want %d", m[1], m[2], i+1)
+		}
+		names = append(names, m[1])
+	}
+	if !reflect.DeepEqual(names, kafkaLogRecordSchemaFields) {
+		t.Errorf("proto fields got %v, want %v", names, kafkaLogRecordSchemaFields)
+	}
+}
+
+// upperEncoder custom value encoder
+type upperEncoder struct{}
+
+func (upperEncoder) Encode(entry *KafKaEntry) ([]byte, error) {
+	return []byte(entry.Body["level"].(string)), nil
+}
+
+func Test_KafKaValueEncoder(t *testing.T) {
+	w := NewKafKaWriter(KafKaWriterOptions{Encoding: "xml", ValueEncoder: upperEncoder{}})
+	if _, err := w.newConfig(); err != nil {
+		t.Fatal(err)
+	}
+	w.messages = make(chan *sarama.ProducerMessage, 1)
+	_ = w.Write(&Record{level: ERROR, msg: "custom"})
+	if value, _ := (<-w.messages).Value.Encode(); string(value) != "ERROR" {
+		t.Errorf("custom encoder value got %s", value)
+	}
+
+	for _, options := range []KafKaWriterOptions{
+		{Encoding: "xml"},
+		{Encoding: KafKaEncodingAvro},
+	} {
+		if _, err := NewKafKaWriter(options).newConfig(); err == nil {
+			t.Errorf("encoding %s should be invalid", options.Encoding)
+		}
+	}
+}
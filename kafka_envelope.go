@@ -0,0 +1,195 @@
+package log4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// kafka envelope timestamp formats, others are used as the time layout
+const (
+	KafKaTimestampRFC3339     = "rfc3339"
+	KafKaTimestampRFC3339Nano = "rfc3339nano"
+	KafKaTimestampUnix        = "unix"    // epoch seconds, number
+	KafKaTimestampUnixMilli   = "unix_ms" // epoch millis, number
+)
+
+// KafKaEnvelopeOptions kafka json message body schema, the keys are es_index, level, file, message, server_ip, host,
+// timestamp, now, extra_fields, the flatten extra fields and the record fields, the binary encodings keep the schema
+// columns and only the headers work for them
+type KafKaEnvelopeOptions struct {
+	Rename          map[string]string `json:"rename" mapstructure:"rename"`                     // rename the keys, ex: {"message": "msg"}
+	Omit            []string          `json:"omit" mapstructure:"omit"`                         // omit the keys, ex: ["es_index", "now"]
+	FieldsKey       string            `json:"fields_key" mapstructure:"fields_key"`             // nest the record fields under the key, default flatten
+	TimestampFormat string            `json:"timestamp_format" mapstructure:"timestamp_format"` // rfc3339, rfc3339nano, unix, unix_ms or time layout
+	Headers         []string          `json:"headers" mapstructure:"headers"`                   // move the keys to the record headers, ex: ["level", "host", "trace_id"]
+}
+
+// initEnvelope validate the envelope, the headers require kafka 0.11
+func (k *KafKaWriter) initEnvelope(cfg *sarama.Config) error {
+	if len(k.options.Envelope.Headers) > 0 && !cfg.Version.IsAtLeast(sarama.V0_11_0_0) {
+		return fmt.Errorf("kafka writer envelope headers require version >= 0.11.0.0, got %s", cfg.Version)
+	}
+	for key, name := range k.options.Envelope.Rename {
+		if name == "" {
+			return fmt.Errorf("kafka writer envelope rename %s to empty key", key)
+		}
+	}
+	return nil
+}
+
+func (k *KafKaWriter) formatTimestamp(t time.Time) interface{} {
+	switch format := k.options.Envelope.TimestampFormat; format {
+	case "":
+		return t.Format(timestampLayout)
+	case KafKaTimestampRFC3339:
+		return t.Format(time.RFC3339)
+	case KafKaTimestampRFC3339Nano:
+		return t.Format(time.RFC3339Nano)
+	case KafKaTimestampUnix:
+		return t.Unix()
+	case KafKaTimestampUnixMilli:
+		return t.UnixNano() / int64(time.Millisecond)
+	default:
+		return t.Format(format)
+	}
+}
+
+func (k *KafKaWriter) renameKey(key string) string {
+	if name, ok := k.options.Envelope.Rename[key]; ok {
+		return name
+	}
+	return key
+}
+
+// kafkaFieldValue the errors are encoded as the message
+func kafkaFieldValue(v interface{}) interface{} {
+	if err, ok := v.(error); ok {
+		return err.Error()
+	}
+	return v
+}
+
+func kafkaHeaderValue(v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []byte(v)
+	case []byte:
+		return v
+	}
+	return []byte(fmt.Sprint(v))
+}
+
+// newKafkaEntry build the entry of the record
+func (k *KafKaWriter) newKafkaEntry(r *Record) *KafKaEntry {
+	data := &k.options.MSG
+	now := r.now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	body := make(map[string]interface{}, 9+len(data.ExtraFields))
+	body["es_index"] = data.ESIndex
+	body["level"] = LevelFlags[r.level]
+	body["file"] = r.file
+	body["message"] = r.msg
+	body["server_ip"] = data.ServerIP
+	body["timestamp"] = k.formatTimestamp(now)
+	body["now"] = now.Unix()
+	body["host"] = data.Host
+	body["extra_fields"] = data.ExtraFields
+
+	// not exist new fields will be added
+	for key, v := range data.ExtraFields {
+		if _, ok := body[key]; !ok {
+			body[key] = v
+		}
+	}
+	fields := make(map[string]interface{}, len(r.fields))
+	for key, v := range r.fields {
+		fields[key] = kafkaFieldValue(v)
+	}
+	return &KafKaEntry{
+		Time:     now,
+		ESIndex:  data.ESIndex,
+		Level:    LevelFlags[r.level],
+		File:     r.file,
+		Message:  r.msg,
+		ServerIP: data.ServerIP,
+		Host:     data.Host,
+		Body:     body,
+		Fields:   fields,
+	}
+}
+
+// encodeRecord encode the record by the value encoder in one pass, return the value and the headers
+func (k *KafKaWriter) encodeRecord(r *Record) ([]byte, []sarama.RecordHeader, error) {
+	entry := k.newKafkaEntry(r)
+
+	var headers []sarama.RecordHeader
+	for _, key := range k.options.Envelope.Headers {
+		src := entry.Body
+		v, ok := src[key]
+		if !ok {
+			src = entry.Fields
+			if v, ok = src[key]; !ok {
+				continue
+			}
+		}
+		delete(src, key)
+		headers = append(headers, sarama.RecordHeader{Key: []byte(k.renameKey(key)), Value: kafkaHeaderValue(v)})
+	}
+
+	value, err := k.encoder.Encode(entry)
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, headers, nil
+}
+
+// kafkaJSONEncoder encode the entry to json by the envelope
+type kafkaJSONEncoder struct {
+	k *KafKaWriter
+}
+
+// Encode the record fields are flatten without overwriting the body keys, or nested under the fields key
+func (e *kafkaJSONEncoder) Encode(entry *KafKaEntry) ([]byte, error) {
+	env := &e.k.options.Envelope
+	body := entry.Body
+	if env.FieldsKey == "" {
+		for key, v := range entry.Fields {
+			if _, ok := body[key]; !ok {
+				body[key] = v
+			}
+		}
+	}
+
+	for _, key := range env.Omit {
+		delete(body, key)
+	}
+	if len(env.Rename) > 0 {
+		// the renamed keys win the collisions over the others, then the first in the sorted order wins
+		keys := Fields(body).sortedKeys()
+		renamed := make(map[string]interface{}, len(body)+1)
+		for _, rename := range []bool{true, false} {
+			for _, key := range keys {
+				if _, ok := env.Rename[key]; ok != rename {
+					continue
+				}
+				name := e.k.renameKey(key)
+				if _, ok := renamed[name]; !ok {
+					renamed[name] = body[key]
+				}
+			}
+		}
+		body = renamed
+	}
+	if env.FieldsKey != "" && len(entry.Fields) > 0 {
+		body[env.FieldsKey] = entry.Fields
+	}
+	return json.Marshal(body)
+}
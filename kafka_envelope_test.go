@@ -0,0 +1,167 @@
+package log4go
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func decodeKafkaEnvelope(t *testing.T, w *KafKaWriter, r *Record) (map[string]interface{}, []sarama.RecordHeader) {
+	if _, err := w.newConfig(); err != nil {
+		t.Fatal(err)
+	}
+	value, headers, err := w.encodeRecord(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(value, &body); err != nil {
+		t.Fatal(err)
+	}
+	return body, headers
+}
+
+func Test_KafKaEnvelopeDefault(t *testing.T) {
+	w := NewKafKaWriter(KafKaWriterOptions{MSG: KafKaMSGFields{
+		ESIndex:     "log4go",
+		ServerIP:    "127.0.0.1",
+		ExtraFields: map[string]interface{}{"app": "log4go", "level": "overridden"},
+	}})
+	now := time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+	body, headers := decodeKafkaEnvelope(t, w, &Record{
+		level:  ERROR,
+		file:   "kafka.go:12",
+		msg:    "envelope",
+		now:    now,
+		fields: Fields{"user": "xwi88", "err": errors.New("timeout"), "app": "ignored"},
+	})
+
+	// the baseline keys are kept, the extra fields are also flatten
+	want := map[string]interface{}{
+		"es_index":     "log4go",
+		"level":        "ERROR",
+		"file":         "kafka.go:12",
+		"message":      "envelope",
+		"server_ip":    "127.0.0.1",
+		"timestamp":    now.Format(timestampLayout),
+		"now":          float64(now.Unix()),
+		"host":         "",
+		"extra_fields": map[string]interface{}{"app": "log4go", "level": "overridden"},
+		"app":          "log4go",
+		"user":         "xwi88",
+		"err":          "timeout",
+	}
+	if len(body) != len(want) {
+		t.Errorf("body got %v, want %v", body, want)
+	}
+	for key, v := range want {
+		if !reflect.DeepEqual(body[key], v) {
+			t.Errorf("body %s got %v, want %v", key, body[key], v)
+		}
+	}
+	if len(headers) != 0 {
+		t.Errorf("headers should be empty, got %v", headers)
+	}
+}
+
+func Test_KafKaEnvelopeSchema(t *testing.T) {
+	var options KafKaWriterOptions
+	config := `{
+  "msg": {"server_ip": "127.0.0.1", "host": "node-1"},
+  "envelope": {
+    "rename": {"message": "msg", "timestamp": "@timestamp", "host": "x-host"},
+    "omit": ["es_index", "now", "file", "extra_fields"],
+    "fields_key": "fields",
+    "timestamp_format": "unix_ms",
+    "headers": ["level", "host", "trace_id", "span_id"]
+  }
+}`
+	if err := json.Unmarshal([]byte(config), &options); err != nil {
+		t.Fatal(err)
+	}
+	w := NewKafKaWriter(options)
+	now := time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+	body, headers := decodeKafkaEnvelope(t, w, &Record{
+		level:  INFO,
+		msg:    "schema",
+		now:    now,
+		fields: Fields{"trace_id": "abc", "user": "xwi88"},
+	})
+
+	if len(body) != 4 || body["msg"] != "schema" || body["server_ip"] != "127.0.0.1" ||
+		body["@timestamp"] != float64(now.UnixNano()/int64(time.Millisecond)) {
+		t.Errorf("unexpected body: %v", body)
+	}
+	fields, ok := body["fields"].(map[string]interface{})
+	if !ok || len(fields) != 1 || fields["user"] != "xwi88" {
+		t.Errorf("nested fields got %v", body["fields"])
+	}
+
+	want := []string{"level", "INFO", "x-host", "node-1", "trace_id", "abc"}
+	if len(headers) != len(want)/2 {
+		t.Fatalf("headers got %v", headers)
+	}
+	for i, h := range headers {
+		if string(h.Key) != want[i*2] || string(h.Value) != want[i*2+1] {
+			t.Errorf("header %d got %s=%s, want %s=%s", i, h.Key, h.Value, want[i*2], want[i*2+1])
+		}
+	}
+
+	w.messages = make(chan *sarama.ProducerMessage, 1)
+	_ = w.Write(&Record{level: INFO, msg: "headers"})
+	if msg := <-w.messages; len(msg.Headers) != 2 {
+		t.Errorf("message headers got %v", msg.Headers)
+	}
+}
+
+func Test_KafKaEnvelopeRenameCollision(t *testing.T) {
+	w := NewKafKaWriter(KafKaWriterOptions{Envelope: KafKaEnvelopeOptions{
+		Rename: map[string]string{"message": "msg", "file": "source", "level": "source"},
+		Omit:   []string{"es_index", "server_ip", "host", "extra_fields", "timestamp", "now"},
+	}})
+	// the renamed keys win over the record fields, the sorted first wins between the renamed keys
+	for i := 0; i < 20; i++ {
+		body, _ := decodeKafkaEnvelope(t, w, &Record{
+			level:  INFO,
+			file:   "kafka.go:12",
+			msg:    "collision",
+			fields: Fields{"msg": "field", "source": "field", "user": "xwi88"},
+		})
+		want := map[string]interface{}{"msg": "collision", "source": "kafka.go:12", "user": "xwi88"}
+		if !reflect.DeepEqual(body, want) {
+			t.Fatalf("body got %v, want %v", body, want)
+		}
+	}
+}
+
+func Test_KafKaEnvelopeTimestamp(t *testing.T) {
+	now := time.Date(2021, 6, 1, 8, 0, 0, 123456789, time.UTC)
+	cases := map[string]interface{}{
+		KafKaTimestampRFC3339:     "2021-06-01T08:00:00Z",
+		KafKaTimestampRFC3339Nano: "2021-06-01T08:00:00.123456789Z",
+		KafKaTimestampUnix:        now.Unix(),
+		KafKaTimestampUnixMilli:   int64(1622534400123),
+		"2006/01/02":              "2021/06/01",
+	}
+	for format, want := range cases {
+		w := NewKafKaWriter(KafKaWriterOptions{Envelope: KafKaEnvelopeOptions{TimestampFormat: format}})
+		if got := w.formatTimestamp(now); got != want {
+			t.Errorf("timestamp format %s got %v, want %v", format, got, want)
+		}
+	}
+}
+
+func Test_KafKaEnvelopeInvalid(t *testing.T) {
+	for _, options := range []KafKaWriterOptions{
+		{SpecifyVersion: true, VersionStr: "0.10.0.1", Envelope: KafKaEnvelopeOptions{Headers: []string{"level"}}},
+		{Envelope: KafKaEnvelopeOptions{Rename: map[string]string{"level": ""}}},
+	} {
+		if _, err := NewKafKaWriter(options).newConfig(); err == nil {
+			t.Errorf("envelope %+v should be invalid", options.Envelope)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package log4go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"log"
+	"text/template"
+
+	"github.com/Shopify/sarama"
+)
+
+// kafka message key modes
+const (
+	KafKaKeyModeStatic   = "static"   // use the options key, default
+	KafKaKeyModeField    = "field"    // use the value of the record field named by key_field
+	KafKaKeyModeCaller   = "caller"   // use the record caller, file:line_number
+	KafKaKeyModeLevel    = "level"    // use the record level
+	KafKaKeyModeTemplate = "template" // use the text/template key_template executed with the record
+)
+
+// kafka partitioners
+const (
+	KafKaPartitionerRoundRobin = "round_robin" // walks through the partitions one at a time, default
+	KafKaPartitionerHash       = "hash"        // FNV-1a hash of the key, random if the key is empty
+	KafKaPartitionerMurmur2    = "murmur2"     // murmur2 hash of the key, compatible with the java client
+	KafKaPartitionerRandom     = "random"      // random partition
+	KafKaPartitionerManual     = "manual"      // the partition option
+)
+
+// kafkaTemplateData the record data for kafka templates
+type kafkaTemplateData struct {
+	Level    string
+	Category string
+	Caller   string
+	Message  string
+	Fields   Fields
+}
+
+func newKafkaTemplateData(r *Record) *kafkaTemplateData {
+	data := &kafkaTemplateData{
+		Level:   LevelFlags[r.level],
+		Caller:  r.file,
+		Message: r.msg,
+		Fields:  r.fields,
+	}
+	if v, ok := r.fields["category"]; ok {
+		data.Category = fmt.Sprint(v)
+	}
+	return data
+}
+
+// Field return the field value as string, empty if not exist
+func (d *kafkaTemplateData) Field(name string) string {
+	v, ok := d.Fields[name]
+	if !ok || v == nil {
+		return ""
+	}
+	if err, ok := v.(error); ok {
+		return err.Error()
+	}
+	return fmt.Sprint(v)
+}
+
+// newKafkaTemplate parse the template, use {{.Field "name"}} for the record fields
+func newKafkaTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Parse(text)
+}
+
+func executeKafkaTemplate(t *template.Template, data *kafkaTemplateData) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// initKey validate the key mode and parse the key template
+func (k *KafKaWriter) initKey() error {
+	switch k.options.KeyMode {
+	case "", KafKaKeyModeStatic, KafKaKeyModeCaller, KafKaKeyModeLevel:
+	case KafKaKeyModeField:
+		if k.options.KeyField == "" {
+			return fmt.Errorf("kafka writer key_mode field requires key_field")
+		}
+	case KafKaKeyModeTemplate:
+		t, err := newKafkaTemplate("key", k.options.KeyTemplate)
+		if err != nil {
+			return fmt.Errorf("kafka writer invalid key_template: %v", err)
+		}
+		k.keyTemplate = t
+	default:
+		return fmt.Errorf("kafka writer invalid key_mode (%s)", k.options.KeyMode)
+	}
+	return nil
+}
+
+// messageKey return the message key of the record, empty means nil key
+func (k *KafKaWriter) messageKey(r *Record) string {
+	switch k.options.KeyMode {
+	case KafKaKeyModeField:
+		if key := (&kafkaTemplateData{Fields: r.fields}).Field(k.options.KeyField); key != "" {
+			return key
+		}
+	case KafKaKeyModeCaller:
+		return r.file
+	case KafKaKeyModeLevel:
+		return LevelFlags[r.level]
+	case KafKaKeyModeTemplate:
+		key, err := executeKafkaTemplate(k.keyTemplate, newKafkaTemplateData(r))
+		if err == nil {
+			return key
+		}
+		if k.options.Debug {
+			log.Printf("[log4go] kafka writer execute key_template err: %v", err.Error())
+		}
+	}
+	return k.options.Key
+}
+
+// newKafkaPartitioner return the partitioner constructor by name
+func newKafkaPartitioner(name string) (sarama.PartitionerConstructor, error) {
+	switch name {
+	case "", KafKaPartitionerRoundRobin:
+		return sarama.NewRoundRobinPartitioner, nil
+	case KafKaPartitionerHash:
+		return sarama.NewHashPartitioner, nil
+	case KafKaPartitionerMurmur2:
+		return sarama.NewCustomPartitioner(sarama.WithAbsFirst(), sarama.WithCustomHashFunction(newKafkaMurmur2)), nil
+	case KafKaPartitionerRandom:
+		return sarama.NewRandomPartitioner, nil
+	case KafKaPartitionerManual:
+		return sarama.NewManualPartitioner, nil
+	}
+	return nil, fmt.Errorf("kafka writer invalid partitioner (%s)", name)
+}
+
+// kafkaMurmur2 hash.Hash32 of the murmur2 used by the java client default partitioner
+type kafkaMurmur2 struct {
+	data []byte
+}
+
+func newKafkaMurmur2() hash.Hash32 {
+	return &kafkaMurmur2{}
+}
+
+func (h *kafkaMurmur2) Write(p []byte) (int, error) {
+	h.data = append(h.data, p...)
+	return len(p), nil
+}
+
+func (h *kafkaMurmur2) Sum(b []byte) []byte {
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], h.Sum32())
+	return append(b, sum[:]...)
+}
+
+func (h *kafkaMurmur2) Reset() {
+	h.data = h.data[:0]
+}
+
+func (h *kafkaMurmur2) Size() int {
+	return 4
+}
+
+func (h *kafkaMurmur2) BlockSize() int {
+	return 4
+}
+
+// Sum32 ref org.apache.kafka.common.utils.Utils.murmur2
+func (h *kafkaMurmur2) Sum32() uint32 {
+	const (
+		seed = uint32(0x9747b28c)
+		m    = uint32(0x5bd1e995)
+		r    = 24
+	)
+	data := h.data
+	length := len(data)
+	sum := seed ^ uint32(length)
+
+	n := length / 4
+	for i := 0; i < n; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		sum *= m
+		sum ^= k
+	}
+
+	tail := data[n*4:]
+	switch len(tail) {
+	case 3:
+		sum ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		sum ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		sum ^= uint32(tail[0])
+		sum *= m
+	}
+
+	sum ^= sum >> 13
+	sum *= m
+	sum ^= sum >> 15
+	return sum
+}
@@ -0,0 +1,130 @@
+package log4go
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+func Test_KafKaMurmur2(t *testing.T) {
+	// ref org.apache.kafka.common.utils.UtilsTest.testMurmur2
+	cases := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+	h := newKafkaMurmur2()
+	for key, want := range cases {
+		h.Reset()
+		_, _ = h.Write([]byte(key))
+		if got := int32(h.Sum32()); got != want {
+			t.Errorf("murmur2(%s) got %d, want %d", key, got, want)
+		}
+	}
+}
+
+func Test_KafKaPartitioner(t *testing.T) {
+	constructor, err := newKafkaPartitioner(KafKaPartitionerMurmur2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := constructor("log4go-test")
+	// toPositive(murmur2("foobar")) % 10 == (-790332482 & 0x7fffffff) % 10
+	got, err := p.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("foobar")}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int32((-790332482 & 0x7fffffff) % 10); got != want {
+		t.Errorf("murmur2 partition got %d, want %d", got, want)
+	}
+	if !p.RequiresConsistency() {
+		t.Error("murmur2 partitioner should require consistency")
+	}
+
+	constructor, _ = newKafkaPartitioner(KafKaPartitionerManual)
+	if got, _ := constructor("").Partition(&sarama.ProducerMessage{Partition: 3}, 10); got != 3 {
+		t.Errorf("manual partition got %d, want 3", got)
+	}
+
+	for _, name := range []string{"", KafKaPartitionerRoundRobin, KafKaPartitionerHash, KafKaPartitionerRandom} {
+		if _, err := newKafkaPartitioner(name); err != nil {
+			t.Errorf("partitioner %s should be valid: %v", name, err)
+		}
+	}
+	if _, err := newKafkaPartitioner("sticky"); err == nil {
+		t.Error("partitioner sticky should be invalid")
+	}
+	options := KafKaWriterOptions{Partitioner: KafKaPartitionerManual, Partition: -1}
+	if _, err := NewKafKaWriter(options).newConfig(); err == nil {
+		t.Error("manual partitioner with negative partition should be invalid")
+	}
+}
+
+func Test_KafKaWriterMessageKey(t *testing.T) {
+	r := &Record{
+		level: ERROR,
+		file:  "kafka.go:12",
+		msg:   "key message",
+		fields: Fields{
+			"request_id": "req-1",
+			"category":   "order",
+			"err":        errors.New("timeout"),
+		},
+	}
+	cases := []struct {
+		options KafKaWriterOptions
+		want    string
+	}{
+		{KafKaWriterOptions{Key: "static"}, "static"},
+		{KafKaWriterOptions{Key: "static", KeyMode: KafKaKeyModeField, KeyField: "request_id"}, "req-1"},
+		{KafKaWriterOptions{Key: "static", KeyMode: KafKaKeyModeField, KeyField: "user_id"}, "static"},
+		{KafKaWriterOptions{KeyMode: KafKaKeyModeField, KeyField: "err"}, "timeout"},
+		{KafKaWriterOptions{KeyMode: KafKaKeyModeCaller}, "kafka.go:12"},
+		{KafKaWriterOptions{KeyMode: KafKaKeyModeLevel}, "ERROR"},
+		{KafKaWriterOptions{KeyMode: KafKaKeyModeTemplate, KeyTemplate: `{{.Category}}/{{.Field "request_id"}}`}, "order/req-1"},
+		{KafKaWriterOptions{KeyMode: KafKaKeyModeTemplate, KeyTemplate: `{{.Field "user_id"}}`}, ""},
+	}
+	for _, c := range cases {
+		w := NewKafKaWriter(c.options)
+		if _, err := w.newConfig(); err != nil {
+			t.Fatal(err)
+		}
+		if got := w.messageKey(r); got != c.want {
+			t.Errorf("options %+v key got %q, want %q", c.options, got, c.want)
+		}
+	}
+
+	for _, options := range []KafKaWriterOptions{
+		{KeyMode: "random"},
+		{KeyMode: KafKaKeyModeField},
+		{KeyMode: KafKaKeyModeTemplate, KeyTemplate: "{{.Level"},
+	} {
+		if _, err := NewKafKaWriter(options).newConfig(); err == nil {
+			t.Errorf("options %+v should be invalid", options)
+		}
+	}
+}
+
+func Test_KafKaWriterWriteKey(t *testing.T) {
+	w := NewKafKaWriter(KafKaWriterOptions{
+		KeyMode:     KafKaKeyModeField,
+		KeyField:    "request_id",
+		Partitioner: KafKaPartitionerManual,
+		Partition:   2,
+	})
+	w.messages = make(chan *sarama.ProducerMessage, 2)
+
+	_ = w.Write(&Record{level: ERROR, msg: "with key", fields: Fields{"request_id": "req-1"}})
+	_ = w.Write(&Record{level: ERROR, msg: "without key"})
+	msg := <-w.messages
+	if key, _ := msg.Key.Encode(); string(key) != "req-1" || msg.Partition != 2 {
+		t.Errorf("message key got %s, partition got %d", key, msg.Partition)
+	}
+	if msg = <-w.messages; msg.Key != nil {
+		t.Errorf("empty key should be nil, got %v", msg.Key)
+	}
+}
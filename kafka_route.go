@@ -0,0 +1,119 @@
+package log4go
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+)
+
+// KafKaRouteOptions kafka topic routing rule, the conditions are all required to match,
+// the first matched rule decides the topic, fallback to the producer topic if none matched
+type KafKaRouteOptions struct {
+	MinLevel string `json:"min_level" mapstructure:"min_level"` // match the records at least as severe as it, ex: error matches ERROR to EMERGENCY
+	MaxLevel string `json:"max_level" mapstructure:"max_level"` // match the records at most as severe as it, ex: warn matches DEBUG to WARNING
+	Category string `json:"category" mapstructure:"category"`   // match the record field category
+	Field    string `json:"field" mapstructure:"field"`         // match the records with the field
+	Value    string `json:"value" mapstructure:"value"`         // match the field value if not empty
+	Topic    string `json:"topic" mapstructure:"topic"`         // required, text/template, ex: logs-{{.Field "service"}}
+}
+
+// kafkaRoute compiled routing rule
+type kafkaRoute struct {
+	minLevel int // the max level value matched
+	maxLevel int // the min level value matched
+	category string
+	field    string
+	value    string
+	topic    *template.Template
+}
+
+// parseKafkaRouteLevel return the level of the flag, WARN == WARNING
+func parseKafkaRouteLevel(flag string, defaultLevel int) (int, error) {
+	if flag == "" {
+		return defaultLevel, nil
+	}
+	flag = strings.ToUpper(strings.TrimSpace(flag))
+	if flag == LevelFlagWarn {
+		flag = LevelFlagWarning
+	}
+	for i, f := range LevelFlags {
+		if flag == f {
+			return i, nil
+		}
+	}
+	return defaultLevel, fmt.Errorf("kafka writer invalid route level (%s)", flag)
+}
+
+// initRoutes validate and compile the routing rules
+func (k *KafKaWriter) initRoutes() error {
+	routes := make([]*kafkaRoute, 0, len(k.options.Routes))
+	for i, options := range k.options.Routes {
+		if options.Topic == "" {
+			return fmt.Errorf("kafka writer route %d topic is empty", i)
+		}
+		if options.Value != "" && options.Field == "" {
+			return fmt.Errorf("kafka writer route %d value requires field", i)
+		}
+		route := &kafkaRoute{category: options.Category, field: options.Field, value: options.Value}
+
+		var err error
+		if route.minLevel, err = parseKafkaRouteLevel(options.MinLevel, DEBUG); err != nil {
+			return err
+		}
+		if route.maxLevel, err = parseKafkaRouteLevel(options.MaxLevel, EMERGENCY); err != nil {
+			return err
+		}
+		if route.maxLevel > route.minLevel {
+			return fmt.Errorf("kafka writer route %d max_level (%s) is less severe than min_level (%s)", i, options.MaxLevel, options.MinLevel)
+		}
+		if route.topic, err = newKafkaTemplate(fmt.Sprintf("route-%d", i), options.Topic); err != nil {
+			return fmt.Errorf("kafka writer invalid route %d topic: %v", i, err)
+		}
+		routes = append(routes, route)
+	}
+	k.routes = routes
+	return nil
+}
+
+func (route *kafkaRoute) match(r *Record, data *kafkaTemplateData) bool {
+	if r.level > route.minLevel || r.level < route.maxLevel {
+		return false
+	}
+	if route.category != "" && data.Category != route.category {
+		return false
+	}
+	if route.field != "" {
+		if _, ok := r.fields[route.field]; !ok {
+			return false
+		}
+		if route.value != "" && data.Field(route.field) != route.value {
+			return false
+		}
+	}
+	return true
+}
+
+// routeTopic return the topic of the first matched rule, skip the rules rendered empty topic
+func (k *KafKaWriter) routeTopic(r *Record) string {
+	if len(k.routes) == 0 {
+		return k.options.ProducerTopic
+	}
+	data := newKafkaTemplateData(r)
+	for _, route := range k.routes {
+		if !route.match(r, data) {
+			continue
+		}
+		topic, err := executeKafkaTemplate(route.topic, data)
+		if err != nil {
+			if k.options.Debug {
+				log.Printf("[log4go] kafka writer execute route topic err: %v", err.Error())
+			}
+			continue
+		}
+		if topic = strings.TrimSpace(topic); topic != "" {
+			return topic
+		}
+	}
+	return k.options.ProducerTopic
+}
@@ -0,0 +1,69 @@
+package log4go
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+func Test_KafKaWriterRoutes(t *testing.T) {
+	var options KafKaWriterOptions
+	config := `{
+  "producer_topic": "logs-bulk",
+  "routes": [
+    {"min_level": "error", "topic": "logs-alerts"},
+    {"category": "audit", "max_level": "warn", "topic": "logs-audit"},
+    {"field": "service", "value": "payment", "topic": "logs-payment-{{.Level}}"},
+    {"field": "service", "topic": "logs-{{.Field \"service\"}}"},
+    {"field": "tenant", "topic": "{{.Field \"tenant\"}}"}
+  ]
+}`
+	if err := json.Unmarshal([]byte(config), &options); err != nil {
+		t.Fatal(err)
+	}
+	w := NewKafKaWriter(options)
+	if _, err := w.newConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		record *Record
+		want   string
+	}{
+		{&Record{level: CRITICAL, fields: Fields{"service": "order"}}, "logs-alerts"},
+		{&Record{level: ERROR}, "logs-alerts"},
+		{&Record{level: INFO, fields: Fields{"category": "audit"}}, "logs-audit"},
+		{&Record{level: INFO, fields: Fields{"service": "payment"}}, "logs-payment-INFO"},
+		{&Record{level: DEBUG, fields: Fields{"service": "order"}}, "logs-order"},
+		{&Record{level: INFO, fields: Fields{"tenant": ""}}, "logs-bulk"},
+		{&Record{level: INFO}, "logs-bulk"},
+	}
+	for _, c := range cases {
+		if got := w.routeTopic(c.record); got != c.want {
+			t.Errorf("record(%s, %v) topic got %s, want %s", LevelFlags[c.record.level], c.record.fields, got, c.want)
+		}
+	}
+
+	w.messages = make(chan *sarama.ProducerMessage, 1)
+	_ = w.Write(&Record{level: ALERT, msg: "routed"})
+	if msg := <-w.messages; msg.Topic != "logs-alerts" {
+		t.Errorf("message topic got %s, want logs-alerts", msg.Topic)
+	}
+}
+
+func Test_KafKaWriterInvalidRoutes(t *testing.T) {
+	for _, route := range []KafKaRouteOptions{
+		{MinLevel: "error"},
+		{MinLevel: "fatal", Topic: "t"},
+		{MaxLevel: "verbose", Topic: "t"},
+		{MinLevel: "error", MaxLevel: "warn", Topic: "t"},
+		{Value: "payment", Topic: "t"},
+		{Topic: "{{.Level"},
+	} {
+		options := KafKaWriterOptions{Routes: []KafKaRouteOptions{route}}
+		if _, err := NewKafKaWriter(options).newConfig(); err == nil {
+			t.Errorf("route %+v should be invalid", route)
+		}
+	}
+}
@@ -0,0 +1,466 @@
+package log4go
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+const (
+	spoolSegmentSizeDefault    = int64(16 << 20) // 16MB
+	spoolMaxSizeDefault        = int64(1 << 30)  // 1GB
+	spoolReplayIntervalDefault = 5 * time.Second
+	spoolReplayBatchDefault    = 500
+	spoolReplayTimeout         = 30 * time.Second
+	spoolSegmentSuffix         = ".spool"
+	spoolEntryHeaderSize       = 8 // payload length and crc32 checksum
+	spoolNilKey                = uint32(0xffffffff)
+)
+
+// KafKaSpoolOptions kafka writer disk spool options, the messages will be written to the spool while kafka is
+// unreachable, and replayed in order when it recovers
+type KafKaSpoolOptions struct {
+	Enable         bool          `json:"enable" mapstructure:"enable"`
+	Dir            string        `json:"dir" mapstructure:"dir"`                         // required, the spool segment files dir
+	SegmentSize    int64         `json:"segment_size" mapstructure:"segment_size"`       // bytes of one segment file, default 16MB
+	MaxSize        int64         `json:"max_size" mapstructure:"max_size"`               // max bytes of the spool, default 1GB, drop the oldest segment if exceeded
+	ReplayInterval time.Duration `json:"replay_interval" mapstructure:"replay_interval"` // interval to reconnect and replay, default 5s
+	ReplayBatch    int           `json:"replay_batch" mapstructure:"replay_batch"`       // messages replayed in one batch, default 500
+}
+
+// KafKaSpoolStats kafka writer disk spool metrics
+type KafKaSpoolStats struct {
+	Segments  int   `json:"segments"`  // segment files
+	Bytes     int64 `json:"bytes"`     // bytes of segment files
+	Pending   int64 `json:"pending"`   // messages waiting for replay
+	Spooled   int64 `json:"spooled"`   // total messages written to the spool
+	Replayed  int64 `json:"replayed"`  // total messages replayed to kafka
+	Dropped   int64 `json:"dropped"`   // total messages dropped by max size
+	Corrupted int64 `json:"corrupted"` // total corrupted segments skipped
+}
+
+// spoolSegment the spool segment file, entry: payload length(4) + crc32(4) + payload
+type spoolSegment struct {
+	seq   uint64
+	path  string
+	size  int64
+	count int64
+}
+
+// spoolPosition the position after the peeked messages in the head segment
+type spoolPosition struct {
+	seq    uint64
+	offset int64
+	count  int64
+}
+
+// kafkaSpool disk-backed spool of kafka messages
+type kafkaSpool struct {
+	lock sync.Mutex
+
+	dir         string
+	segmentSize int64
+	maxSize     int64
+
+	segments   []*spoolSegment // ordered by seq, the last is writable
+	file       *os.File        // the last segment file for write
+	headOffset int64           // read offset of the head segment
+	headCount  int64           // read messages of the head segment
+	nextSeq    uint64
+
+	stats KafKaSpoolStats
+}
+
+// openKafkaSpool open the spool dir and load the exist segments
+func openKafkaSpool(options KafKaSpoolOptions) (*kafkaSpool, error) {
+	if options.Dir == "" {
+		return nil, errors.New("kafka writer spool dir is empty")
+	}
+	if err := os.MkdirAll(options.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &kafkaSpool{
+		dir:         options.Dir,
+		segmentSize: options.SegmentSize,
+		maxSize:     options.MaxSize,
+	}
+	if s.segmentSize <= 0 {
+		s.segmentSize = spoolSegmentSizeDefault
+	}
+	if s.maxSize <= 0 {
+		s.maxSize = spoolMaxSizeDefault
+	}
+
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range files {
+		name := fi.Name()
+		if fi.IsDir() || !strings.HasSuffix(name, spoolSegmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		seg := &spoolSegment{seq: seq, path: filepath.Join(s.dir, name)}
+		if err := s.loadSegment(seg); err != nil {
+			return nil, err
+		}
+		if seg.count == 0 {
+			_ = os.Remove(seg.path)
+			continue
+		}
+		s.segments = append(s.segments, seg)
+	}
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].seq < s.segments[j].seq
+	})
+	for _, seg := range s.segments {
+		s.stats.Pending += seg.count
+		s.stats.Bytes += seg.size
+		s.nextSeq = seg.seq + 1
+	}
+	return s, nil
+}
+
+// loadSegment count the valid entries of segment, the broken tail will be truncated
+func (s *kafkaSpool) loadSegment(seg *spoolSegment) error {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	r := bufio.NewReader(f)
+	for {
+		payload, err := readSpoolEntry(r, fi.Size()-seg.size)
+		if err != nil {
+			break
+		}
+		seg.size += int64(spoolEntryHeaderSize + len(payload))
+		seg.count++
+	}
+	_ = f.Close()
+
+	if fi.Size() != seg.size {
+		s.stats.Corrupted++
+		return os.Truncate(seg.path, seg.size)
+	}
+	return nil
+}
+
+// append write the message to the tail segment
+func (s *kafkaSpool) append(msg *sarama.ProducerMessage) error {
+	payload, err := encodeSpoolMessage(msg)
+	if err != nil {
+		return err
+	}
+	size := int64(spoolEntryHeaderSize + len(payload))
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// drop the oldest segments to keep the max size
+	for s.stats.Bytes+size > s.maxSize {
+		if len(s.segments) <= 1 {
+			s.stats.Dropped++
+			return fmt.Errorf("kafka writer spool is full (max_size %d)", s.maxSize)
+		}
+		s.removeHead(true)
+	}
+
+	n := len(s.segments)
+	if n == 0 || s.file == nil || s.segments[n-1].size+size > s.segmentSize {
+		if err := s.rollSegment(); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[spoolEntryHeaderSize:], payload)
+	if _, err := s.file.Write(buf); err != nil {
+		return err
+	}
+
+	tail := s.segments[len(s.segments)-1]
+	tail.size += size
+	tail.count++
+	s.stats.Bytes += size
+	s.stats.Pending++
+	s.stats.Spooled++
+	return nil
+}
+
+// rollSegment create a new tail segment for write
+func (s *kafkaSpool) rollSegment() error {
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return err
+		}
+		s.file = nil
+	}
+	seg := &spoolSegment{
+		seq:  s.nextSeq,
+		path: filepath.Join(s.dir, fmt.Sprintf("%020d%s", s.nextSeq, spoolSegmentSuffix)),
+	}
+	f, err := os.OpenFile(seg.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.nextSeq++
+	s.file = f
+	s.segments = append(s.segments, seg)
+	return nil
+}
+
+// removeHead remove the head segment, dropped means the pending messages are dropped
+func (s *kafkaSpool) removeHead(dropped bool) {
+	head := s.segments[0]
+	if len(s.segments) == 1 && s.file != nil {
+		_ = s.file.Close()
+		s.file = nil
+	}
+	_ = os.Remove(head.path)
+	s.segments = s.segments[1:]
+
+	pending := head.count - s.headCount
+	s.stats.Pending -= pending
+	if dropped {
+		s.stats.Dropped += pending
+	}
+	s.stats.Bytes -= head.size
+	s.headOffset = 0
+	s.headCount = 0
+}
+
+// peek read at most n messages from the head without consuming them, commit the returned position after delivered
+func (s *kafkaSpool) peek(n int) ([]*sarama.ProducerMessage, spoolPosition, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.segments) == 0 {
+		return nil, spoolPosition{}, nil
+	}
+	head := s.segments[0]
+	pos := spoolPosition{seq: head.seq, offset: s.headOffset, count: s.headCount}
+
+	f, err := os.Open(head.path)
+	if err != nil {
+		return nil, pos, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(s.headOffset, io.SeekStart); err != nil {
+		return nil, pos, err
+	}
+
+	r := bufio.NewReader(io.LimitReader(f, head.size-s.headOffset))
+	msgs := make([]*sarama.ProducerMessage, 0, n)
+	for len(msgs) < n && pos.offset < head.size {
+		payload, err := readSpoolEntry(r, head.size-pos.offset)
+		if err == nil {
+			var msg *sarama.ProducerMessage
+			if msg, err = decodeSpoolMessage(payload); err == nil {
+				msgs = append(msgs, msg)
+				pos.offset += int64(spoolEntryHeaderSize + len(payload))
+				pos.count++
+				continue
+			}
+		}
+		// corrupted, skip the rest of the segment
+		s.stats.Corrupted++
+		pos.offset = head.size
+		pos.count = head.count
+	}
+	return msgs, pos, nil
+}
+
+// commit consume the messages before the position
+func (s *kafkaSpool) commit(pos spoolPosition) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.segments) == 0 || s.segments[0].seq != pos.seq || pos.count < s.headCount {
+		return // the head segment has been dropped
+	}
+	head := s.segments[0]
+	replayed := pos.count - s.headCount
+	s.stats.Pending -= replayed
+	s.stats.Replayed += replayed
+	s.headOffset = pos.offset
+	s.headCount = pos.count
+
+	if s.headOffset >= head.size {
+		s.removeHead(false)
+	}
+}
+
+// len return the pending messages
+func (s *kafkaSpool) len() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.stats.Pending
+}
+
+// Stats return the spool metrics
+func (s *kafkaSpool) Stats() KafKaSpoolStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stats := s.stats
+	stats.Segments = len(s.segments)
+	return stats
+}
+
+// close close the tail segment file, the pending messages will be replayed after reopened
+func (s *kafkaSpool) close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// readSpoolEntry read one entry within the remaining bytes of the segment and verify the checksum,
+// the length larger than the remaining is corrupted and never allocated
+func readSpoolEntry(r io.Reader, remaining int64) ([]byte, error) {
+	var header [spoolEntryHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(header[0:4])
+	if int64(n) > remaining-spoolEntryHeaderSize {
+		return nil, fmt.Errorf("kafka writer spool entry length %d exceeds the segment", n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, errors.New("kafka writer spool entry checksum mismatch")
+	}
+	return payload, nil
+}
+
+// encodeSpoolMessage payload: topic length(2) + topic + partition(4, for the manual partitioner) +
+// key length(4, 0xffffffff for nil) + key +
+// header count(2) + [header key length(2) + header key + header value length(4) + header value] + value
+func encodeSpoolMessage(msg *sarama.ProducerMessage) ([]byte, error) {
+	var key, value []byte
+	var err error
+	if msg.Key != nil {
+		if key, err = msg.Key.Encode(); err != nil {
+			return nil, err
+		}
+	}
+	if msg.Value != nil {
+		if value, err = msg.Value.Encode(); err != nil {
+			return nil, err
+		}
+	}
+	if len(msg.Topic) > 0xffff || len(msg.Headers) > 0xffff {
+		return nil, fmt.Errorf("kafka writer spool topic or headers too long (%d, %d)", len(msg.Topic), len(msg.Headers))
+	}
+
+	buf := make([]byte, 0, 12+len(msg.Topic)+len(key)+len(value))
+	buf = appendSpoolBytes16(buf, []byte(msg.Topic))
+	buf = append(buf, byte(msg.Partition>>24), byte(msg.Partition>>16), byte(msg.Partition>>8), byte(msg.Partition))
+	keyLen := spoolNilKey
+	if msg.Key != nil {
+		keyLen = uint32(len(key))
+	}
+	buf = append(buf, byte(keyLen>>24), byte(keyLen>>16), byte(keyLen>>8), byte(keyLen))
+	buf = append(buf, key...)
+	buf = append(buf, byte(len(msg.Headers)>>8), byte(len(msg.Headers)))
+	for _, h := range msg.Headers {
+		if len(h.Key) > 0xffff {
+			return nil, fmt.Errorf("kafka writer spool header key too long (%d)", len(h.Key))
+		}
+		buf = appendSpoolBytes16(buf, h.Key)
+		n := uint32(len(h.Value))
+		buf = append(buf, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+		buf = append(buf, h.Value...)
+	}
+	buf = append(buf, value...)
+	return buf, nil
+}
+
+func appendSpoolBytes16(buf, b []byte) []byte {
+	buf = append(buf, byte(len(b)>>8), byte(len(b)))
+	return append(buf, b...)
+}
+
+func decodeSpoolMessage(payload []byte) (*sarama.ProducerMessage, error) {
+	invalid := errors.New("kafka writer spool invalid entry")
+	if len(payload) < 2 {
+		return nil, invalid
+	}
+	topicLen := int(binary.BigEndian.Uint16(payload))
+	payload = payload[2:]
+	if len(payload) < topicLen+8 {
+		return nil, invalid
+	}
+	msg := &sarama.ProducerMessage{Topic: string(payload[:topicLen])}
+	payload = payload[topicLen:]
+	msg.Partition = int32(binary.BigEndian.Uint32(payload))
+	payload = payload[4:]
+
+	keyLen := binary.BigEndian.Uint32(payload)
+	payload = payload[4:]
+	if keyLen != spoolNilKey {
+		if uint32(len(payload)) < keyLen {
+			return nil, invalid
+		}
+		msg.Key = sarama.ByteEncoder(payload[:keyLen])
+		payload = payload[keyLen:]
+	}
+
+	if len(payload) < 2 {
+		return nil, invalid
+	}
+	headerCount := int(binary.BigEndian.Uint16(payload))
+	payload = payload[2:]
+	for i := 0; i < headerCount; i++ {
+		if len(payload) < 2 {
+			return nil, invalid
+		}
+		n := int(binary.BigEndian.Uint16(payload))
+		if len(payload) < 2+n+4 {
+			return nil, invalid
+		}
+		h := sarama.RecordHeader{Key: payload[2 : 2+n]}
+		payload = payload[2+n:]
+		vn := binary.BigEndian.Uint32(payload)
+		payload = payload[4:]
+		if uint32(len(payload)) < vn {
+			return nil, invalid
+		}
+		h.Value = payload[:vn]
+		payload = payload[vn:]
+		msg.Headers = append(msg.Headers, h)
+	}
+	msg.Value = sarama.ByteEncoder(payload)
+	return msg, nil
+}
@@ -0,0 +1,341 @@
+package log4go
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+)
+
+func newTestSpool(t *testing.T, options KafKaSpoolOptions) *kafkaSpool {
+	s, err := openKafkaSpool(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func appendTestSpool(t *testing.T, s *kafkaSpool, from, to int) {
+	for i := from; i < to; i++ {
+		msg := &sarama.ProducerMessage{Topic: "log4go-test", Value: sarama.StringEncoder(strconv.Itoa(i))}
+		if i%2 == 0 {
+			msg.Key = sarama.StringEncoder("key")
+		}
+		if err := s.append(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// replayTestSpool peek and commit all messages, return the values
+func replayTestSpool(t *testing.T, s *kafkaSpool, batch int) []string {
+	var values []string
+	for s.len() > 0 {
+		msgs, pos, err := s.peek(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, msg := range msgs {
+			v, _ := msg.Value.Encode()
+			values = append(values, string(v))
+		}
+		s.commit(pos)
+	}
+	return values
+}
+
+func Test_KafKaSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := openKafkaSpool(KafKaSpoolOptions{}); err == nil {
+		t.Error("spool without dir should be invalid")
+	}
+
+	s := newTestSpool(t, KafKaSpoolOptions{Dir: dir, SegmentSize: 256})
+	appendTestSpool(t, s, 0, 20)
+	if stats := s.Stats(); stats.Pending != 20 || stats.Spooled != 20 || stats.Segments < 2 {
+		t.Errorf("unexpected spool stats: %+v", stats)
+	}
+
+	msgs, pos, err := s.peek(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 || msgs[0].Topic != "log4go-test" || msgs[0].Key == nil || msgs[1].Key != nil {
+		t.Fatalf("unexpected peeked messages: %+v", msgs)
+	}
+	if s.len() != 20 {
+		t.Errorf("peek should not consume, pending got %d", s.len())
+	}
+	s.commit(pos)
+	s.commit(pos) // commit twice is ignored
+	if s.len() != 17 {
+		t.Errorf("pending got %d, want 17", s.len())
+	}
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the committed position is kept in memory only, the head segment replays from the start after reopened
+	s = newTestSpool(t, KafKaSpoolOptions{Dir: dir, SegmentSize: 256})
+	appendTestSpool(t, s, 20, 25)
+	values := replayTestSpool(t, s, 4)
+	if len(values) != 25 || values[0] != "0" || values[24] != "24" {
+		t.Errorf("replayed values got %v", values)
+	}
+	for i := 1; i < len(values); i++ {
+		a, _ := strconv.Atoi(values[i-1])
+		b, _ := strconv.Atoi(values[i])
+		if b != a+1 {
+			t.Fatalf("replayed values out of order: %v", values)
+		}
+	}
+	if stats := s.Stats(); stats.Pending != 0 || stats.Segments != 0 || stats.Bytes != 0 || stats.Replayed != 25 {
+		t.Errorf("unexpected spool stats: %+v", stats)
+	}
+	_ = s.close()
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("replayed segments should be removed, got %d files", len(files))
+	}
+}
+
+func Test_KafKaSpoolMessage(t *testing.T) {
+	msg := &sarama.ProducerMessage{
+		Topic:     "log4go-test",
+		Partition: 3,
+		Key:       sarama.StringEncoder("key"),
+		Value:     sarama.StringEncoder("value"),
+		Headers:   []sarama.RecordHeader{{Key: []byte("level"), Value: []byte("INFO")}, {Key: []byte("empty")}},
+	}
+	payload, err := encodeSpoolMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeSpoolMessage(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := got.Key.Encode()
+	value, _ := got.Value.Encode()
+	if got.Topic != "log4go-test" || got.Partition != 3 || string(key) != "key" || string(value) != "value" || len(got.Headers) != 2 ||
+		string(got.Headers[0].Key) != "level" || string(got.Headers[0].Value) != "INFO" || len(got.Headers[1].Value) != 0 {
+		t.Errorf("decoded message got %+v", got)
+	}
+	for i := 0; i < len(payload)-len("value"); i++ {
+		if _, err := decodeSpoolMessage(payload[:i]); err == nil {
+			t.Errorf("truncated payload(%d) should be invalid", i)
+		}
+	}
+}
+
+func Test_KafKaSpoolCorrupted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newTestSpool(t, KafKaSpoolOptions{Dir: dir})
+	appendTestSpool(t, s, 0, 3)
+	_ = s.close()
+
+	// a half written entry is truncated
+	path := filepath.Join(dir, "00000000000000000000.spool")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte{0, 0, 0, 100, 1, 2})
+	_ = f.Close()
+
+	s = newTestSpool(t, KafKaSpoolOptions{Dir: dir})
+	if stats := s.Stats(); stats.Pending != 3 || stats.Corrupted != 1 {
+		t.Errorf("unexpected spool stats: %+v", stats)
+	}
+
+	// a torn length is rejected before allocating the payload
+	torn := []byte{0xff, 0xff, 0xff, 0xf0, 0, 0, 0, 0, 1, 2, 3}
+	if _, err := readSpoolEntry(bytes.NewReader(torn), int64(len(torn))); err == nil {
+		t.Error("the length larger than the segment should be corrupted")
+	}
+	appendTestSpool(t, s, 3, 4)
+	if values := replayTestSpool(t, s, 10); len(values) != 4 {
+		t.Errorf("replayed values got %v", values)
+	}
+	_ = s.close()
+
+	// an entry with broken checksum skips the rest of the segment
+	s = newTestSpool(t, KafKaSpoolOptions{Dir: dir})
+	appendTestSpool(t, s, 0, 3)
+	_ = s.close()
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("spool segments got %d, want 1", len(files))
+	}
+	path = filepath.Join(dir, files[0].Name())
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s = newTestSpool(t, KafKaSpoolOptions{Dir: dir})
+	if values := replayTestSpool(t, s, 10); len(values) != 2 {
+		t.Errorf("replayed values got %v", values)
+	}
+	_ = s.close()
+}
+
+func Test_KafKaSpoolMaxSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newTestSpool(t, KafKaSpoolOptions{Dir: dir, SegmentSize: 100, MaxSize: 300})
+	appendTestSpool(t, s, 0, 30)
+	stats := s.Stats()
+	if stats.Bytes > 300 || stats.Dropped == 0 || stats.Pending+stats.Dropped != 30 {
+		t.Errorf("unexpected spool stats: %+v", stats)
+	}
+	values := replayTestSpool(t, s, 10)
+	if len(values) == 0 || values[len(values)-1] != "29" {
+		t.Errorf("the newest messages should be kept, got %v", values)
+	}
+	_ = s.close()
+
+	s = newTestSpool(t, KafKaSpoolOptions{Dir: dir, SegmentSize: 10, MaxSize: 10})
+	if err := s.append(&sarama.ProducerMessage{Value: sarama.StringEncoder("too large message")}); err == nil {
+		t.Error("message larger than max size should fail")
+	}
+	_ = s.close()
+}
+
+func Test_KafKaWriterSpoolReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// reserve a free port for the broker started later
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	w := NewKafKaWriter(KafKaWriterOptions{
+		Level:           "debug",
+		Brokers:         []string{addr},
+		ProducerTopic:   "log4go-test",
+		ProducerTimeout: time.Second,
+		RetryMax:        -1,
+		SpecifyVersion:  true,
+		VersionStr:      "0.10.0.1",
+		Spool:           KafKaSpoolOptions{Enable: true, Dir: dir, ReplayInterval: 50 * time.Millisecond},
+	})
+	if err := w.Init(); err != nil {
+		t.Fatalf("kafka writer with spool should start without kafka: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := w.Write(&Record{level: ERROR, msg: "kafka spool " + strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitKafKaSpool(t, w.SpoolStats, func() bool { return w.SpoolStats().Spooled == 10 })
+
+	broker := sarama.NewMockBrokerAddr(t, 1, addr)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("log4go-test", 0, broker.BrokerID()),
+		"ProduceRequest":     sarama.NewMockProduceResponse(t).SetVersion(2),
+		"ApiVersionsRequest": sarama.NewMockApiVersionsResponse(t),
+	})
+
+	waitKafKaSpool(t, w.SpoolStats, func() bool { return w.SpoolStats().Pending == 0 && w.isAvailable() })
+	if err := w.Write(&Record{level: ERROR, msg: "kafka spool after recovered"}); err != nil {
+		t.Fatal(err)
+	}
+	w.Stop()
+
+	if stats := w.SpoolStats(); stats.Replayed != 10 || stats.Spooled != 10 {
+		t.Errorf("unexpected spool stats: %+v", stats)
+	}
+	produced := 0
+	for _, rr := range broker.History() {
+		if _, ok := rr.Request.(*sarama.ProduceRequest); ok {
+			produced++
+		}
+	}
+	if produced == 0 {
+		t.Error("spooled messages should be produced to the broker")
+	}
+}
+
+func Test_KafKaWriterSpoolFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var callbacks int32
+	w := startMockKafKaWriter(t, KafKaWriterOptions{
+		ProducerTopic: "log4go-test",
+		Spool:         KafKaSpoolOptions{Enable: true, Dir: dir, ReplayInterval: time.Hour},
+		ErrorCallback: func(err error, msg *sarama.ProducerMessage) {
+			atomic.AddInt32(&callbacks, 1)
+		},
+	}, func(producer *mocks.AsyncProducer) {
+		producer.ExpectInputAndFail(sarama.ErrMessageSizeTooLarge)
+		producer.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+	})
+	// the not retriable is dropped, the retriable is spooled to replay, not failed
+	if err := w.Write(&Record{level: ERROR, msg: "kafka too large"}); err != nil {
+		t.Fatal(err)
+	}
+	waitKafKaSpool(t, w.SpoolStats, func() bool { return w.Stats().Failed == 1 })
+	if err := w.Write(&Record{level: ERROR, msg: "kafka out of brokers"}); err != nil {
+		t.Fatal(err)
+	}
+	waitKafKaSpool(t, w.SpoolStats, func() bool { return w.SpoolStats().Spooled == 1 })
+	w.Stop()
+
+	if stats := w.Stats(); stats.Sent != 0 || stats.Failed != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if n := atomic.LoadInt32(&callbacks); n != 1 {
+		t.Errorf("error callback called %d times, want 1", n)
+	}
+}
+
+func waitKafKaSpool(t *testing.T, stats func() KafKaSpoolStats, cond func() bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("wait kafka writer spool timeout, stats: %+v", stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,133 @@
+package log4go
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// kafkaLatencyBuckets the upper bounds of the delivery latency histogram, the last bucket is +Inf
+var kafkaLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// KafKaErrorCallback called with the message finally dropped by errors, not the spooled, should not block
+type KafKaErrorCallback func(err error, msg *sarama.ProducerMessage)
+
+// KafKaStats kafka writer delivery metrics
+type KafKaStats struct {
+	Sent    int64             `json:"sent"`    // messages delivered, include the replayed
+	Failed  int64             `json:"failed"`  // messages dropped by errors, exclude the spooled
+	Retried int64             `json:"retried"` // retries by the producer
+	Queued  int64             `json:"queued"`  // messages in the queue or in flight
+	Dropped int64             `json:"dropped"` // messages dropped by the overflow policy
+	Bytes   int64             `json:"bytes"`   // value bytes delivered
+	Latency KafKaLatencyStats `json:"latency"` // from written to acked
+	Spool   KafKaSpoolStats   `json:"spool"`
+}
+
+// KafKaLatencyStats delivery latency histogram
+type KafKaLatencyStats struct {
+	Count   int64                `json:"count"`
+	Sum     time.Duration        `json:"sum"`
+	Max     time.Duration        `json:"max"`
+	Buckets []KafKaLatencyBucket `json:"buckets"`
+}
+
+// KafKaLatencyBucket the messages delivered within the upper bound, not cumulative, zero Le means +Inf
+type KafKaLatencyBucket struct {
+	Le    time.Duration `json:"le"`
+	Count int64         `json:"count"`
+}
+
+// kafkaMessageMeta the metadata of written messages
+type kafkaMessageMeta struct {
+	written time.Time
+}
+
+// kafkaStats delivery counters, updated atomically
+type kafkaStats struct {
+	sent    int64
+	failed  int64
+	retried int64
+	bytes   int64
+
+	latencyCount int64
+	latencySum   int64
+	latencyMax   int64
+	latency      [13]int64 // len(kafkaLatencyBuckets) + 1
+}
+
+func (s *kafkaStats) delivered(msg *sarama.ProducerMessage) {
+	atomic.AddInt64(&s.sent, 1)
+	if msg.Value != nil {
+		atomic.AddInt64(&s.bytes, int64(msg.Value.Length()))
+	}
+	if meta, ok := msg.Metadata.(*kafkaMessageMeta); ok {
+		s.observe(time.Since(meta.written))
+	}
+}
+
+func (s *kafkaStats) observe(d time.Duration) {
+	i := 0
+	for i < len(kafkaLatencyBuckets) && d > kafkaLatencyBuckets[i] {
+		i++
+	}
+	atomic.AddInt64(&s.latency[i], 1)
+	atomic.AddInt64(&s.latencyCount, 1)
+	atomic.AddInt64(&s.latencySum, int64(d))
+	for {
+		max := atomic.LoadInt64(&s.latencyMax)
+		if int64(d) <= max || atomic.CompareAndSwapInt64(&s.latencyMax, max, int64(d)) {
+			return
+		}
+	}
+}
+
+// retryBackoff count the retries, used as the sarama retry backoff func
+func (s *kafkaStats) retryBackoff(backoff time.Duration) func(retries, maxRetries int) time.Duration {
+	return func(retries, maxRetries int) time.Duration {
+		atomic.AddInt64(&s.retried, 1)
+		return backoff
+	}
+}
+
+// Stats return the delivery metrics
+func (k *KafKaWriter) Stats() KafKaStats {
+	s := &k.stats
+	stats := KafKaStats{
+		Sent:    atomic.LoadInt64(&s.sent),
+		Failed:  atomic.LoadInt64(&s.failed),
+		Retried: atomic.LoadInt64(&s.retried),
+		Queued:  atomic.LoadInt64(&k.pending),
+		Dropped: k.Dropped(),
+		Bytes:   atomic.LoadInt64(&s.bytes),
+		Latency: KafKaLatencyStats{
+			Count:   atomic.LoadInt64(&s.latencyCount),
+			Sum:     time.Duration(atomic.LoadInt64(&s.latencySum)),
+			Max:     time.Duration(atomic.LoadInt64(&s.latencyMax)),
+			Buckets: make([]KafKaLatencyBucket, len(s.latency)),
+		},
+		Spool: k.SpoolStats(),
+	}
+	for i := range s.latency {
+		bucket := &stats.Latency.Buckets[i]
+		if i < len(kafkaLatencyBuckets) {
+			bucket.Le = kafkaLatencyBuckets[i]
+		}
+		bucket.Count = atomic.LoadInt64(&s.latency[i])
+	}
+	return stats
+}
@@ -0,0 +1,87 @@
+package log4go
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+)
+
+func Test_KafKaWriterStats(t *testing.T) {
+	var lock sync.Mutex
+	var failed []string
+	w := NewKafKaWriter(KafKaWriterOptions{
+		ProducerTopic: "log4go-test",
+		ErrorCallback: func(err error, msg *sarama.ProducerMessage) {
+			lock.Lock()
+			defer lock.Unlock()
+			failed = append(failed, err.Error()+":"+msg.Topic)
+		},
+	})
+	cfg, err := w.newConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	producer := mocks.NewAsyncProducer(t, cfg)
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+
+	w.producer = producer
+	w.messages = make(chan *sarama.ProducerMessage, 3)
+	w.run = 1
+	go w.daemonProducer()
+	go w.daemonResults()
+
+	for i := 0; i < 3; i++ {
+		if err := w.Write(&Record{level: ERROR, msg: "kafka stats"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := w.Stats()
+	if stats.Sent != 2 || stats.Failed != 1 || stats.Queued != 0 || stats.Bytes == 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if stats.Latency.Count != 2 || stats.Latency.Sum <= 0 || stats.Latency.Max <= 0 ||
+		len(stats.Latency.Buckets) != len(kafkaLatencyBuckets)+1 {
+		t.Errorf("unexpected latency stats: %+v", stats.Latency)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(failed) != 1 || failed[0] != sarama.ErrOutOfBrokers.Error()+":log4go-test" {
+		t.Errorf("error callback got %v", failed)
+	}
+}
+
+func Test_KafKaLatencyHistogram(t *testing.T) {
+	var s kafkaStats
+	for _, d := range []time.Duration{0, time.Millisecond, 2 * time.Millisecond, time.Second, time.Minute} {
+		s.observe(d)
+	}
+	w := &KafKaWriter{}
+	w.stats.latency = s.latency
+	w.stats.latencyCount = s.latencyCount
+	w.stats.latencyMax = s.latencyMax
+	latency := w.Stats().Latency
+
+	want := map[time.Duration]int64{time.Millisecond: 2, 5 * time.Millisecond: 1, time.Second: 1, 0: 1}
+	for _, bucket := range latency.Buckets {
+		if bucket.Count != want[bucket.Le] {
+			t.Errorf("bucket(le=%v) got %d, want %d", bucket.Le, bucket.Count, want[bucket.Le])
+		}
+	}
+	if latency.Count != 5 || latency.Max != time.Minute {
+		t.Errorf("unexpected latency stats: %+v", latency)
+	}
+
+	backoff := s.retryBackoff(time.Second)
+	if backoff(1, 3) != time.Second || backoff(2, 3) != time.Second || s.retried != 2 {
+		t.Errorf("retried got %d, want 2", s.retried)
+	}
+}
@@ -1,11 +1,31 @@
 package log4go
 
 import (
-	"encoding/json"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/Shopify/sarama"
+	"github.com/xdg-go/scram"
+)
+
+// Kafka writer overflow policies, used when the queue is full
+const (
+	KafKaOverflowDropNew    = "drop_new"    // drop the new message, default
+	KafKaOverflowDropOldest = "drop_oldest" // drop the oldest message in queue
+	KafKaOverflowBlock      = "block"       // block the logger until the queue has room
+)
+
+const (
+	kafkaCloseTimeoutDefault = 5 * time.Second
+	kafkaAbortGrace          = time.Second // the max wait for the stop after the close timeout aborted
 )
 
 // KafKaMSGFields kafka msg fields
@@ -15,6 +35,7 @@ type KafKaMSGFields struct {
 	File      string `json:"file"`                             // source code file:line_number
 	Message   string `json:"message"`                          // required, dynamic
 	ServerIP  string `json:"server_ip"`                        // required, init field, set by app
+	Host      string `json:"host"`                             // optional, init field, set by app
 	Timestamp string `json:"timestamp"`                        // required, dynamic, set by logger
 	Now       int64  `json:"now"`                              // choice
 
@@ -23,34 +44,160 @@ type KafKaMSGFields struct {
 
 // KafKaWriterOptions kafka writer options
 type KafKaWriterOptions struct {
-	Enable                  bool `json:"enable" mapstructure:"enable"`
-	Debug                   bool `json:"debug" mapstructure:"debug"`                     // if true, will output the send msg
-	SpecifyVersion          bool `json:"specify_version" mapstructure:"specify_version"` // if use the input version, default false
+	Enable         bool `json:"enable" mapstructure:"enable"`
+	Debug          bool `json:"debug" mapstructure:"debug"`                     // if true, will output the send msg
+	SpecifyVersion bool `json:"specify_version" mapstructure:"specify_version"` // if use the input version, default false
+	// deprecated, the successes are always returned by the async producer
 	ProducerReturnSuccesses bool `json:"producer_return_successes" mapstructure:"producer_return_successes"`
-	BufferSize              int  `json:"buffer_size" mapstructure:"buffer_size"`
+	BufferSize              int  `json:"buffer_size" mapstructure:"buffer_size"` // queue size, default 1024
+
+	// OverflowPolicy when the queue is full: drop_new, drop_oldest or block, default drop_new
+	OverflowPolicy string `json:"overflow_policy" mapstructure:"overflow_policy"`
+
+	// batch, ref sarama.Config.Producer.Flush
+	FlushMessages  int           `json:"flush_messages" mapstructure:"flush_messages"`   // best-effort number of messages to trigger a flush
+	FlushBytes     int           `json:"flush_bytes" mapstructure:"flush_bytes"`         // best-effort number of bytes to trigger a flush
+	FlushFrequency time.Duration `json:"flush_frequency" mapstructure:"flush_frequency"` // linger, best-effort frequency of flushes
+
+	Compression  string        `json:"compression" mapstructure:"compression"`     // none, gzip, snappy, lz4 or zstd, default none
+	RequiredAcks string        `json:"required_acks" mapstructure:"required_acks"` // none, local or all, default local
+	RetryMax     int           `json:"retry_max" mapstructure:"retry_max"`         // default 3, -1 means no retry
+	RetryBackoff time.Duration `json:"retry_backoff" mapstructure:"retry_backoff"` // default 100ms
 
 	Level      string `json:"level" mapstructure:"level"`
 	VersionStr string `json:"version" mapstructure:"version"` // used to specify the kafka version, ex: 0.10.0.1 or 1.1.1
 
 	Key string `json:"key" mapstructure:"key"` // kafka producer key, choice field
 
-	ProducerTopic   string        `json:"producer_topic" mapstructure:"producer_topic"`
+	// KeyMode static, field, caller, level or template, default static, fallback to the key if empty
+	KeyMode     string `json:"key_mode" mapstructure:"key_mode"`
+	KeyField    string `json:"key_field" mapstructure:"key_field"`       // the field name for key_mode field
+	KeyTemplate string `json:"key_template" mapstructure:"key_template"` // text/template for key_mode template, ex: {{.Level}}-{{.Field "request_id"}}
+
+	// Partitioner round_robin, hash, murmur2, random or manual, default round_robin
+	Partitioner string `json:"partitioner" mapstructure:"partitioner"`
+	Partition   int32  `json:"partition" mapstructure:"partition"` // the partition for partitioner manual
+
+	ProducerTopic   string        `json:"producer_topic" mapstructure:"producer_topic"` // the default topic if no route matched
 	ProducerTimeout time.Duration `json:"producer_timeout" mapstructure:"producer_timeout"`
 	Brokers         []string      `json:"brokers" mapstructure:"brokers"`
 
-	MSG KafKaMSGFields `json:"msg"`
+	// NewProducer optional, create the producer instead of sarama.NewAsyncProducer, ex: sarama/mocks in tests
+	NewProducer KafKaProducerFactory `json:"-" mapstructure:"-"`
+
+	TLS  TLSOptions       `json:"tls" mapstructure:"tls"`
+	SASL KafKaSASLOptions `json:"sasl" mapstructure:"sasl"`
+
+	// Routes topic routing rules, the first matched rule decides the topic
+	Routes []KafKaRouteOptions `json:"routes" mapstructure:"routes"`
+
+	// ErrorCallback optional, called with the messages dropped by errors, not the spooled, should not block
+	ErrorCallback KafKaErrorCallback `json:"-" mapstructure:"-"`
+
+	// CloseTimeout the deadline to deliver the queued messages when closed, default 5s
+	CloseTimeout time.Duration `json:"close_timeout" mapstructure:"close_timeout"`
+
+	// Spool write messages to the disk while kafka is unreachable, and replay them when it recovers
+	Spool KafKaSpoolOptions `json:"spool" mapstructure:"spool"`
+
+	// Encoding json, protobuf or avro, default json, the envelope except the headers only works for json
+	Encoding     string            `json:"encoding" mapstructure:"encoding"`
+	AvroSchemaID int32             `json:"avro_schema_id" mapstructure:"avro_schema_id"` // required for avro, the schema registry id
+	ValueEncoder KafKaValueEncoder `json:"-" mapstructure:"-"`                           // optional, custom value encoder instead of the encoding
+
+	MSG      KafKaMSGFields       `json:"msg"`
+	Envelope KafKaEnvelopeOptions `json:"envelope" mapstructure:"envelope"` // the message body schema and headers
+}
+
+// KafKaSASLOptions kafka sasl options
+type KafKaSASLOptions struct {
+	Enable    bool   `json:"enable" mapstructure:"enable"`
+	Mechanism string `json:"mechanism" mapstructure:"mechanism"` // PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512, default PLAIN
+	Username  string `json:"username" mapstructure:"username"`
+	Password  string `json:"password" mapstructure:"password"`
+}
+
+// kafkaSCRAMClient sarama.SCRAMClient implemented by xdg-go/scram
+type kafkaSCRAMClient struct {
+	*scram.Client
+	*scram.ClientConversation
+	scram.HashGeneratorFcn
+}
+
+// Begin prepares the client for the SCRAM exchange
+func (c *kafkaSCRAMClient) Begin(userName, password, authzID string) (err error) {
+	c.Client, err = c.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.ClientConversation = c.Client.NewConversation()
+	return nil
+}
+
+// Step steps client through the SCRAM exchange
+func (c *kafkaSCRAMClient) Step(challenge string) (string, error) {
+	return c.ClientConversation.Step(challenge)
+}
+
+// Done should return true when the SCRAM conversation is over
+func (c *kafkaSCRAMClient) Done() bool {
+	return c.ClientConversation.Done()
+}
+
+// KafKaProducer the async producer used by the kafka writer, implemented by sarama.AsyncProducer and sarama/mocks
+type KafKaProducer interface {
+	AsyncClose()
+	Close() error
+	Input() chan<- *sarama.ProducerMessage
+	Successes() <-chan *sarama.ProducerMessage
+	Errors() <-chan *sarama.ProducerError
+}
+
+// KafKaProducerFactory create the producer with the brokers and the writer config
+type KafKaProducerFactory func(brokers []string, cfg *sarama.Config) (KafKaProducer, error)
+
+// newKafkaProducer the default producer factory
+func newKafkaProducer(brokers []string, cfg *sarama.Config) (KafKaProducer, error) {
+	return sarama.NewAsyncProducer(brokers, cfg)
 }
 
 // KafKaWriter kafka writer
 type KafKaWriter struct {
-	level    int
-	producer sarama.SyncProducer
-	messages chan *sarama.ProducerMessage
-	options  KafKaWriterOptions
+	level       int
+	producer    KafKaProducer
+	keyTemplate *template.Template
+	routes      []*kafkaRoute
+	encoder     KafKaValueEncoder
+	messages    chan *sarama.ProducerMessage // bounded queue before the producer
+	options     KafKaWriterOptions
+
+	run      int32         // 1 when started, avoid the block with no running kafka writer
+	stopOnce sync.Once     // the concurrent Stop calls wait for the first one
+	quit     chan struct{} // closed when the daemon producer exit
+	done     chan struct{} // closed when the producer successes and errors drained
+	dropped  int64         // dropped messages by overflow policy
+	stats    kafkaStats
+
+	queueLock sync.RWMutex // protect the queue closed, held by the writes while sending
+	stopped   bool         // the writes are rejected instead of sending on the closed queue
+
+	pending     int64         // messages queued or in flight
+	undelivered int64         // pending messages when closed
+	abort       chan struct{} // closed when close timeout, the queued messages will be discarded
+	closeOnce   sync.Once
+	closeErr    error // the undelivered error returned by every Close
+
+	lock       sync.RWMutex   // protect the producer, it may be connected by the replay daemon
+	cfg        *sarama.Config // used to reconnect
+	spool      *kafkaSpool    // nil if spool disabled
+	available  int32          // 1 if kafka is reachable, only used with spool
+	replayStop chan struct{}  // closed to stop the replay daemon
+	replayQuit chan struct{}  // closed when the replay daemon exit
+}
 
-	run  bool // avoid the block with no running kafka writer
-	quit chan struct{}
-	stop chan struct{}
+// kafkaReplayMeta the metadata of replayed messages, used to receive the send results
+type kafkaReplayMeta struct {
+	result chan *sarama.ProducerError // nil if delivered
 }
 
 // NewKafKaWriter new kafka writer
@@ -60,12 +207,17 @@ func NewKafKaWriter(options KafKaWriterOptions) *KafKaWriter {
 		defaultLevel = getLevelDefault(options.Level, defaultLevel, "")
 	}
 
-	return &KafKaWriter{
-		options: options,
-		quit:    make(chan struct{}),
-		stop:    make(chan struct{}),
-		level:   defaultLevel,
+	w := &KafKaWriter{
+		options:    options,
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+		replayStop: make(chan struct{}),
+		replayQuit: make(chan struct{}),
+		abort:      make(chan struct{}),
+		level:      defaultLevel,
 	}
+	w.encoder = &kafkaJSONEncoder{k: w}
+	return w
 }
 
 // Init service for Record
@@ -79,107 +231,333 @@ func (k *KafKaWriter) Write(r *Record) error {
 		return nil
 	}
 
-	logMsg := r.msg
-	if logMsg == "" {
+	if r.msg == "" {
 		return nil
 	}
-	data := k.options.MSG
-	// timestamp, level
-	data.Level = LevelFlags[r.level]
-	now := time.Now()
-	data.Now = now.Unix()
-	data.Timestamp = now.Format(timestampLayout)
-	data.Message = logMsg
-	data.File = r.file
-
-	byteData, err := json.Marshal(data)
+	value, headers, err := k.encodeRecord(r)
 	if err != nil {
 		return err
 	}
 
-	var structData map[string]interface{}
-	err = json.Unmarshal(byteData, &structData)
-	if err != nil {
-		log.Printf("[log4go] kafka writer err: %v", err.Error())
+	key := k.messageKey(r)
+
+	msg := &sarama.ProducerMessage{
+		Topic: k.routeTopic(r),
+		// autofill or use specify timestamp, you must set Version >= sarama.V0_10_0_1
+		// Timestamp: time.Now(),
+		Value:     sarama.ByteEncoder(value),
+		Headers:   headers,
+		Partition: k.options.Partition,
+		Metadata:  &kafkaMessageMeta{written: time.Now()},
+	}
+	if key != "" {
+		msg.Key = sarama.ByteEncoder(key)
+	}
+
+	if k.options.Debug {
+		log.Printf("[log4go] msg [topic: %v, timestamp: %v, brokers: %v]\nkey:   %v\nvalue: %s\n", msg.Topic,
+			msg.Timestamp, k.options.Brokers, key, value)
 	}
-	delete(structData, "extraFields")
 
-	// not exist new fields will be added
-	for k, v := range data.ExtraFields {
-		if _, ok := structData[k]; !ok {
-			structData[k] = v
+	return k.enqueue(msg)
+}
+
+// enqueue put the message to the queue, deal with the overflow policy if the queue is full
+func (k *KafKaWriter) enqueue(msg *sarama.ProducerMessage) error {
+	if k.messages == nil {
+		return errors.New("kafka writer not started")
+	}
+	k.queueLock.RLock()
+	defer k.queueLock.RUnlock()
+	if k.stopped {
+		return errors.New("kafka writer stopped")
+	}
+	atomic.AddInt64(&k.pending, 1)
+
+	switch k.options.OverflowPolicy {
+	case KafKaOverflowBlock:
+		k.messages <- msg
+		return nil
+	case KafKaOverflowDropOldest:
+		for {
+			select {
+			case k.messages <- msg:
+				return nil
+			default:
+			}
+			select {
+			case <-k.messages:
+				k.drop()
+			default:
+			}
+		}
+	default:
+		select {
+		case k.messages <- msg:
+		default:
+			k.drop()
 		}
+		return nil
 	}
-	structDataByte, err := json.Marshal(structData)
-	if err != nil {
-		return err
+}
+
+func (k *KafKaWriter) drop() {
+	atomic.AddInt64(&k.pending, -1)
+	n := atomic.AddInt64(&k.dropped, 1)
+	if k.options.Debug {
+		log.Printf("[log4go] kafka writer queue full, dropped %d messages", n)
 	}
+}
 
-	jsonData := string(structDataByte)
+// Dropped return the number of messages dropped by the overflow policy
+func (k *KafKaWriter) Dropped() int64 {
+	return atomic.LoadInt64(&k.dropped)
+}
 
-	key := ""
-	if k.options.Key != "" {
-		key = k.options.Key
+// send kafka message to kafka, the producer batch them by flush config
+// with spool, the messages will be spooled while kafka is unreachable or the spool is not empty to keep in order
+func (k *KafKaWriter) daemonProducer() {
+	defer close(k.quit)
+	for msg := range k.messages {
+		if k.spool != nil && (!k.isAvailable() || k.spool.len() > 0) {
+			k.spoolMessage(msg)
+			atomic.AddInt64(&k.pending, -1)
+			continue
+		}
+		select {
+		case k.getProducer().Input() <- msg:
+		case <-k.abort:
+			// close timeout, spool or discard the queued messages
+			if k.spool != nil {
+				k.spoolMessage(msg)
+				atomic.AddInt64(&k.pending, -1)
+			}
+			for msg := range k.messages {
+				if k.spool != nil {
+					k.spoolMessage(msg)
+					atomic.AddInt64(&k.pending, -1)
+				}
+			}
+			return
+		}
 	}
+}
 
-	msg := &sarama.ProducerMessage{
-		Topic: k.options.ProducerTopic,
-		// autofill or use specify timestamp, you must set Version >= sarama.V0_10_0_1
-		// Timestamp: time.Now(),
-		Key:   sarama.ByteEncoder(key),
-		Value: sarama.ByteEncoder(jsonData),
+func (k *KafKaWriter) getProducer() KafKaProducer {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	return k.producer
+}
+
+func (k *KafKaWriter) isAvailable() bool {
+	return atomic.LoadInt32(&k.available) == 1
+}
+
+func (k *KafKaWriter) setAvailable(available bool) {
+	var v int32
+	if available {
+		v = 1
+	}
+	if atomic.SwapInt32(&k.available, v) != v && k.spool != nil {
+		log.Printf("[log4go] kafka writer available: %v, spool pending: %d", available, k.spool.len())
 	}
+}
 
-	if k.options.Debug {
-		log.Printf("[log4go] msg [topic: %v, timestamp: %v, brokers: %v]\nkey:   %v\nvalue: %v\n", msg.Topic,
-			msg.Timestamp, k.options.Brokers, key, jsonData)
+func (k *KafKaWriter) spoolMessage(msg *sarama.ProducerMessage) {
+	msg.Metadata = nil
+	if err := k.spool.append(msg); err != nil {
+		log.Printf("[log4go] kafka writer spool err: %v", err.Error())
+		k.fail(err, msg)
 	}
-	go k.asyncWriteMessages(msg)
+}
 
-	return nil
+// fail count the message finally dropped and call the error callback
+func (k *KafKaWriter) fail(err error, msg *sarama.ProducerMessage) {
+	atomic.AddInt64(&k.stats.failed, 1)
+	if k.options.ErrorCallback != nil {
+		k.options.ErrorCallback(err, msg)
+	}
 }
 
-func (k *KafKaWriter) asyncWriteMessages(msg *sarama.ProducerMessage) {
-	if msg != nil {
-		k.messages <- msg
+// SpoolStats return the disk spool metrics, zero if spool disabled
+func (k *KafKaWriter) SpoolStats() KafKaSpoolStats {
+	if k.spool == nil {
+		return KafKaSpoolStats{}
 	}
+	return k.spool.Stats()
 }
 
-// send kafka message to kafka
-func (k *KafKaWriter) daemonProducer() {
-	k.run = true
+// connect create the async producer
+func (k *KafKaWriter) connect() error {
+	newProducer := k.options.NewProducer
+	if newProducer == nil {
+		newProducer = newKafkaProducer
+	}
+	producer, err := newProducer(k.options.Brokers, k.cfg)
+	if err != nil {
+		return err
+	}
+	k.lock.Lock()
+	k.producer = producer
+	k.lock.Unlock()
+	go k.daemonResults()
+	return nil
+}
+
+// daemonReplay reconnect kafka and replay the spooled messages by interval
+func (k *KafKaWriter) daemonReplay() {
+	defer close(k.replayQuit)
+	interval := k.options.Spool.ReplayInterval
+	if interval <= 0 {
+		interval = spoolReplayIntervalDefault
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-next:
 	for {
 		select {
-		case mes, ok := <-k.messages:
-			if ok {
-				partition, offset, err := k.producer.SendMessage(mes)
-
-				if err != nil {
-					log.Printf("[log4go] SendMessage(topic=%s, partition=%v, offset=%v, key=%s, value=%s,timstamp=%v) err=%s\n\n", mes.Topic,
-						partition, offset, mes.Key, mes.Value, mes.Timestamp, err.Error())
-					continue
+		case <-k.replayStop:
+			return
+		case <-ticker.C:
+			k.replay()
+		}
+	}
+}
+
+// replay replay the spooled messages in order by batch, stop at the first retriable failure
+func (k *KafKaWriter) replay() {
+	if k.getProducer() == nil {
+		if err := k.connect(); err != nil {
+			if k.options.Debug {
+				log.Printf("[log4go] kafka writer reconnect err: %v", err.Error())
+			}
+			return
+		}
+	}
+
+	batch := k.options.Spool.ReplayBatch
+	if batch <= 0 {
+		batch = spoolReplayBatchDefault
+	}
+	for k.spool.len() > 0 {
+		msgs, pos, err := k.spool.peek(batch)
+		if err != nil {
+			log.Printf("[log4go] kafka writer spool read err: %v", err.Error())
+			return
+		}
+		if len(msgs) > 0 && !k.replayBatch(msgs) {
+			k.setAvailable(false)
+			return
+		}
+		k.spool.commit(pos)
+	}
+	k.setAvailable(true)
+}
+
+// replayBatch send the messages and wait for the results, true if all delivered or not retriable
+func (k *KafKaWriter) replayBatch(msgs []*sarama.ProducerMessage) bool {
+	meta := &kafkaReplayMeta{result: make(chan *sarama.ProducerError, len(msgs))}
+	producer := k.getProducer()
+	for _, msg := range msgs {
+		msg.Metadata = meta
+		select {
+		case producer.Input() <- msg:
+		case <-k.replayStop:
+			return false
+		}
+	}
+
+	timeout := time.NewTimer(spoolReplayTimeout)
+	defer timeout.Stop()
+	ok := true
+	for range msgs {
+		select {
+		case pErr := <-meta.result:
+			if pErr != nil {
+				if kafkaRetriable(pErr.Err) {
+					ok = false
 				} else {
-					if k.options.Debug {
-						log.Printf("[log4go] SendMessage(topic=%s, partition=%v, offset=%v, key=%s, value=%s,timstamp=%v)\n\n", mes.Topic,
-							partition, offset, mes.Key, mes.Value, mes.Timestamp)
-					}
+					log.Printf("[log4go] kafka writer drop spooled message err: %v", pErr.Err.Error())
+					k.fail(pErr.Err, pErr.Msg)
 				}
 			}
-		case <-k.stop:
-			break next
+		case <-timeout.C:
+			return false
+		case <-k.replayStop:
+			return false
 		}
 	}
-	k.quit <- struct{}{}
+	return ok
 }
 
-// Start start the kafka writer
-func (k *KafKaWriter) Start() (err error) {
-	log.Printf("[log4go] kafka writer starting")
+// kafkaRetriable return false if the message will never be delivered, like too large
+func kafkaRetriable(err error) bool {
+	var kErr sarama.KError
+	if errors.As(err, &kErr) {
+		switch kErr {
+		case sarama.ErrMessageSizeTooLarge, sarama.ErrInvalidMessage, sarama.ErrInvalidMessageSize,
+			sarama.ErrInvalidTopic, sarama.ErrInvalidRecord,
+			sarama.ErrTopicAuthorizationFailed, sarama.ErrClusterAuthorizationFailed:
+			return false
+		}
+	}
+	var cErr sarama.ConfigurationError
+	return !errors.As(err, &cErr)
+}
+
+// daemonResults drain the producer successes and errors until the producer closed
+func (k *KafKaWriter) daemonResults() {
+	successes, errs := k.producer.Successes(), k.producer.Errors()
+	for successes != nil || errs != nil {
+		select {
+		case mes, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			k.stats.delivered(mes)
+			if meta, ok := mes.Metadata.(*kafkaReplayMeta); ok {
+				meta.result <- nil
+			} else {
+				atomic.AddInt64(&k.pending, -1)
+			}
+			if k.options.Debug {
+				log.Printf("[log4go] SendMessage(topic=%s, partition=%v, offset=%v, key=%s, value=%s,timstamp=%v)\n\n", mes.Topic,
+					mes.Partition, mes.Offset, mes.Key, mes.Value, mes.Timestamp)
+			}
+		case pErr, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			mes := pErr.Msg
+			if meta, ok := mes.Metadata.(*kafkaReplayMeta); ok {
+				meta.result <- pErr
+				continue
+			}
+			atomic.AddInt64(&k.pending, -1)
+			log.Printf("[log4go] SendMessage(topic=%s, partition=%v, offset=%v, key=%s, value=%s,timstamp=%v) err=%s\n\n", mes.Topic,
+				mes.Partition, mes.Offset, mes.Key, mes.Value, mes.Timestamp, pErr.Err.Error())
+			// the spooled are replayed later, only the dropped are failed
+			if k.spool != nil && kafkaRetriable(pErr.Err) {
+				k.setAvailable(false)
+				k.spoolMessage(mes)
+			} else {
+				k.fail(pErr.Err, mes)
+			}
+		}
+	}
+	close(k.done)
+}
+
+// newConfig build the sarama config by options
+func (k *KafKaWriter) newConfig() (*sarama.Config, error) {
 	cfg := sarama.NewConfig()
-	cfg.Producer.Return.Successes = k.options.ProducerReturnSuccesses
-	cfg.Producer.Timeout = k.options.ProducerTimeout
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.Return.Errors = true
+	if k.options.ProducerTimeout > 0 {
+		cfg.Producer.Timeout = k.options.ProducerTimeout
+	}
 
 	// if want set timestamp for data should set version
 	versionStr := k.options.VersionStr
@@ -199,39 +577,240 @@ func (k *KafKaWriter) Start() (err error) {
 	// if not specify the version, use the sarama.V2_5_0_0 to guarante the timestamp can be control
 	cfg.Version = kafkaVer
 
-	// NewHashPartitioner returns a Partitioner which behaves as follows. If the message's key is nil then a
-	// random partition is chosen. Otherwise the FNV-1a hash of the encoded bytes of the message key is used,
-	// modulus the number of partitions. This ensures that messages with the same key always end up on the
-	// same partition.
-	// cfg.Producer.Partitioner = sarama.NewHashPartitioner
-	// cfg.Producer.Partitioner = sarama.NewRandomPartitioner
-	cfg.Producer.Partitioner = sarama.NewRoundRobinPartitioner
-	// cfg.Producer.Partitioner = sarama.NewReferenceHashPartitioner
+	// the messages with the same key always end up on the same partition by hash or murmur2
+	partitioner, err := newKafkaPartitioner(k.options.Partitioner)
+	if err != nil {
+		return nil, err
+	}
+	if k.options.Partitioner == KafKaPartitionerManual && k.options.Partition < 0 {
+		return nil, fmt.Errorf("kafka writer invalid partition (%d)", k.options.Partition)
+	}
+	cfg.Producer.Partitioner = partitioner
+	if err := k.initKey(); err != nil {
+		return nil, err
+	}
+	if err := k.initRoutes(); err != nil {
+		return nil, err
+	}
+	if err := k.initEnvelope(cfg); err != nil {
+		return nil, err
+	}
+	if err := k.initEncoder(); err != nil {
+		return nil, err
+	}
+
+	// batch
+	cfg.Producer.Flush.Messages = k.options.FlushMessages
+	cfg.Producer.Flush.Bytes = k.options.FlushBytes
+	cfg.Producer.Flush.Frequency = k.options.FlushFrequency
+
+	switch strings.ToLower(k.options.Compression) {
+	case "", "none":
+		cfg.Producer.Compression = sarama.CompressionNone
+	case "gzip":
+		cfg.Producer.Compression = sarama.CompressionGZIP
+	case "snappy":
+		cfg.Producer.Compression = sarama.CompressionSnappy
+	case "lz4":
+		cfg.Producer.Compression = sarama.CompressionLZ4
+	case "zstd":
+		cfg.Producer.Compression = sarama.CompressionZSTD
+	default:
+		return nil, fmt.Errorf("kafka writer invalid compression (%s)", k.options.Compression)
+	}
+
+	switch strings.ToLower(k.options.RequiredAcks) {
+	case "", "local":
+		cfg.Producer.RequiredAcks = sarama.WaitForLocal
+	case "none":
+		cfg.Producer.RequiredAcks = sarama.NoResponse
+	case "all":
+		cfg.Producer.RequiredAcks = sarama.WaitForAll
+	default:
+		return nil, fmt.Errorf("kafka writer invalid required_acks (%s)", k.options.RequiredAcks)
+	}
+
+	switch {
+	case k.options.RetryMax < 0:
+		cfg.Producer.Retry.Max = 0
+	case k.options.RetryMax > 0:
+		cfg.Producer.Retry.Max = k.options.RetryMax
+	}
+	if k.options.RetryBackoff > 0 {
+		cfg.Producer.Retry.Backoff = k.options.RetryBackoff
+	}
+	cfg.Producer.Retry.BackoffFunc = k.stats.retryBackoff(cfg.Producer.Retry.Backoff)
 
-	k.producer, err = sarama.NewSyncProducer(k.options.Brokers, cfg)
+	switch k.options.OverflowPolicy {
+	case "", KafKaOverflowDropNew, KafKaOverflowDropOldest, KafKaOverflowBlock:
+	default:
+		return nil, fmt.Errorf("kafka writer invalid overflow_policy (%s)", k.options.OverflowPolicy)
+	}
+
+	if k.options.TLS.Enable {
+		tlsConfig, err := newTLSConfig(k.options.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("kafka writer %v", err)
+		}
+		cfg.Net.TLS.Enable = true
+		cfg.Net.TLS.Config = tlsConfig
+	}
+
+	if sasl := k.options.SASL; sasl.Enable {
+		cfg.Net.SASL.Enable = true
+		cfg.Net.SASL.Handshake = true
+		cfg.Net.SASL.User = sasl.Username
+		cfg.Net.SASL.Password = sasl.Password
+		switch strings.ToUpper(sasl.Mechanism) {
+		case "", sarama.SASLTypePlaintext:
+			cfg.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		case sarama.SASLTypeSCRAMSHA256:
+			cfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+			cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &kafkaSCRAMClient{HashGeneratorFcn: sha256.New}
+			}
+		case sarama.SASLTypeSCRAMSHA512:
+			cfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+			cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &kafkaSCRAMClient{HashGeneratorFcn: sha512.New}
+			}
+		default:
+			return nil, fmt.Errorf("kafka writer invalid sasl mechanism (%s)", sasl.Mechanism)
+		}
+	}
+
+	if k.options.Spool.Enable {
+		// keep the messages in order while retry
+		cfg.Net.MaxOpenRequests = 1
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Start start the kafka writer
+// with spool, the writer starts even if kafka is unreachable, the messages will be spooled until it recovers
+func (k *KafKaWriter) Start() (err error) {
+	log.Printf("[log4go] kafka writer starting")
+	k.cfg, err = k.newConfig()
 	if err != nil {
-		log.Printf("[log4go] sarama.NewSyncProducer err, message=%s", err.Error())
+		log.Printf("[log4go] kafka writer config err, message=%s", err.Error())
 		return err
 	}
+
+	if k.options.Spool.Enable {
+		if k.spool, err = openKafkaSpool(k.options.Spool); err != nil {
+			log.Printf("[log4go] kafka writer open spool err, message=%s", err.Error())
+			return err
+		}
+	}
+
+	if err = k.connect(); err != nil {
+		log.Printf("[log4go] kafka writer new producer err, message=%s", err.Error())
+		if k.spool == nil {
+			return err
+		}
+		err = nil
+	} else {
+		k.setAvailable(true)
+	}
+
 	size := k.options.BufferSize
 	if size <= 1 {
 		size = 1024
 	}
 	k.messages = make(chan *sarama.ProducerMessage, size)
+	atomic.StoreInt32(&k.run, 1)
 
 	go k.daemonProducer()
+	if k.spool != nil {
+		go k.daemonReplay()
+	}
 	log.Printf("[log4go] kafka writer started")
 	return err
 }
 
-// Stop stop the kafka writer
+// Stop stop the kafka writer, the queued messages will be sent before the producer closed
+// with spool, the undelivered messages will be kept in the spool and replayed after restarted
 func (k *KafKaWriter) Stop() {
-	if k.run {
-		close(k.messages)
-		<-k.stop
-		err := k.producer.Close()
-		if err != nil {
-			log.Printf("[log4go] kafkaWriter stop error: %v", err.Error())
+	if atomic.LoadInt32(&k.run) == 0 {
+		return
+	}
+	k.stopOnce.Do(k.stop)
+}
+
+func (k *KafKaWriter) stop() {
+	// the blocked writes are released by the daemon producer, which drains the queue even if aborted
+	k.queueLock.Lock()
+	k.stopped = true
+	close(k.messages)
+	k.queueLock.Unlock()
+	<-k.quit
+	if k.spool != nil {
+		close(k.replayStop)
+		<-k.replayQuit
+	}
+	if producer := k.getProducer(); producer != nil {
+		producer.AsyncClose()
+		<-k.done
+	}
+	if k.spool != nil {
+		if err := k.spool.close(); err != nil {
+			log.Printf("[log4go] kafka writer close spool err: %v", err.Error())
+		}
+	}
+}
+
+// Close stop the kafka writer within the close timeout, the messages not delivered before the deadline are discarded
+// and reported by the returned error and Undelivered
+func (k *KafKaWriter) Close() error {
+	if atomic.LoadInt32(&k.run) == 0 {
+		return nil
+	}
+	k.closeOnce.Do(func() {
+		k.closeErr = k.close()
+	})
+	return k.closeErr
+}
+
+func (k *KafKaWriter) close() error {
+	timeout := k.options.CloseTimeout
+	if timeout <= 0 {
+		timeout = kafkaCloseTimeoutDefault
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		k.Stop()
+		close(stopped)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-stopped:
+	case <-timer.C:
+		// the queued messages are spooled or discarded, wait the producer closed and the spool synced
+		close(k.abort)
+		grace := time.NewTimer(kafkaAbortGrace)
+		defer grace.Stop()
+		select {
+		case <-stopped:
+		case <-grace.C:
+			log.Printf("[log4go] kafka writer not stopped in %v after close timeout", kafkaAbortGrace)
 		}
 	}
+
+	n := atomic.LoadInt64(&k.pending)
+	atomic.StoreInt64(&k.undelivered, n)
+	if n > 0 {
+		return fmt.Errorf("kafka writer closed with %d undelivered messages", n)
+	}
+	return nil
+}
+
+// Undelivered return the number of messages not delivered when closed
+func (k *KafKaWriter) Undelivered() int64 {
+	return atomic.LoadInt64(&k.undelivered)
 }
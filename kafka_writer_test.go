@@ -0,0 +1,539 @@
+package log4go
+
+import (
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/xdg-go/scram"
+)
+
+func Test_KafKaWriterConfig(t *testing.T) {
+	w := NewKafKaWriter(KafKaWriterOptions{
+		FlushMessages:  100,
+		FlushBytes:     1 << 20,
+		FlushFrequency: 50 * time.Millisecond,
+		Compression:    "zstd",
+		RequiredAcks:   "all",
+		RetryMax:       5,
+		RetryBackoff:   time.Second,
+	})
+	cfg, err := w.newConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Producer.Flush.Messages != 100 || cfg.Producer.Flush.Bytes != 1<<20 ||
+		cfg.Producer.Flush.Frequency != 50*time.Millisecond {
+		t.Errorf("unexpected flush config: %+v", cfg.Producer.Flush)
+	}
+	if cfg.Producer.Compression != sarama.CompressionZSTD {
+		t.Errorf("compression got %v, want zstd", cfg.Producer.Compression)
+	}
+	if cfg.Producer.RequiredAcks != sarama.WaitForAll {
+		t.Errorf("required acks got %v, want all", cfg.Producer.RequiredAcks)
+	}
+	if cfg.Producer.Retry.Max != 5 || cfg.Producer.Retry.Backoff != time.Second {
+		t.Errorf("unexpected retry config: %+v", cfg.Producer.Retry)
+	}
+
+	w = NewKafKaWriter(KafKaWriterOptions{RetryMax: -1})
+	if cfg, err = w.newConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Producer.Retry.Max != 0 || cfg.Producer.RequiredAcks != sarama.WaitForLocal ||
+		cfg.Producer.Compression != sarama.CompressionNone {
+		t.Errorf("unexpected default config: %+v", cfg.Producer)
+	}
+
+	for _, options := range []KafKaWriterOptions{
+		{Compression: "brotli"},
+		{RequiredAcks: "some"},
+		{OverflowPolicy: "drop_all"},
+		{Compression: "zstd", SpecifyVersion: true, VersionStr: "0.10.0.1"},
+	} {
+		if _, err := NewKafKaWriter(options).newConfig(); err == nil {
+			t.Errorf("options %+v should be invalid", options)
+		}
+	}
+}
+
+func Test_KafKaWriterOverflowPolicy(t *testing.T) {
+	cases := []struct {
+		policy string
+		want   []string
+	}{
+		{"", []string{"0", "1"}},
+		{KafKaOverflowDropNew, []string{"0", "1"}},
+		{KafKaOverflowDropOldest, []string{"2", "3"}},
+	}
+	for _, c := range cases {
+		w := NewKafKaWriter(KafKaWriterOptions{OverflowPolicy: c.policy})
+		w.messages = make(chan *sarama.ProducerMessage, 2)
+		for _, v := range []string{"0", "1", "2", "3"} {
+			if err := w.enqueue(&sarama.ProducerMessage{Value: sarama.StringEncoder(v)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if w.Dropped() != 2 {
+			t.Errorf("policy(%s) dropped got %d, want 2", c.policy, w.Dropped())
+		}
+		for _, want := range c.want {
+			msg := <-w.messages
+			if got := string(msg.Value.(sarama.StringEncoder)); got != want {
+				t.Errorf("policy(%s) message got %s, want %s", c.policy, got, want)
+			}
+		}
+	}
+
+	w := NewKafKaWriter(KafKaWriterOptions{})
+	if err := w.enqueue(&sarama.ProducerMessage{}); err == nil {
+		t.Error("enqueue should fail before the writer started")
+	}
+}
+
+func Test_KafKaWriterAsyncProducer(t *testing.T) {
+	w := NewKafKaWriter(KafKaWriterOptions{ProducerTopic: "log4go-test", Key: "key"})
+	cfg, err := w.newConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	producer := mocks.NewAsyncProducer(t, cfg)
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+
+	w.producer = producer
+	w.messages = make(chan *sarama.ProducerMessage, 2)
+	w.run = 1
+	go w.daemonProducer()
+	go w.daemonResults()
+
+	for i := 0; i < 2; i++ {
+		if err := w.Write(&Record{level: ERROR, msg: "kafka async producer"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Stop()
+}
+
+// startMockKafKaWriter start the kafka writer with the sarama mock producer, expect set the expectations
+func startMockKafKaWriter(t *testing.T, options KafKaWriterOptions, expect func(producer *mocks.AsyncProducer)) *KafKaWriter {
+	options.NewProducer = func(brokers []string, cfg *sarama.Config) (KafKaProducer, error) {
+		producer := mocks.NewAsyncProducer(t, cfg)
+		expect(producer)
+		return producer, nil
+	}
+	w := NewKafKaWriter(options)
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func Test_KafKaWriterMessage(t *testing.T) {
+	now := time.Date(2021, 6, 1, 8, 0, 0, 0, time.Local)
+	want := map[string]interface{}{
+		"es_index":  "log4go",
+		"level":     "ERROR",
+		"file":      "kafka_writer_test.go:42",
+		"message":   "kafka message",
+		"server_ip": "127.0.0.1",
+		"host":      "node-1",
+		"timestamp": now.Format(timestampLayout),
+		"now":       float64(now.Unix()),
+		"extra_fields": map[string]interface{}{
+			"app": "log4go", "version": float64(2), "level": "ignored",
+		},
+		"app":     "log4go",
+		"version": float64(2),
+		"user":    "xwi88",
+		"err":     "timeout",
+	}
+	checker := func(msg *sarama.ProducerMessage) error {
+		key, _ := msg.Key.Encode()
+		if msg.Topic != "log4go-test" || string(key) != "kafka-test" {
+			return fmt.Errorf("message topic %s key %s", msg.Topic, key)
+		}
+		value, _ := msg.Value.Encode()
+		var got map[string]interface{}
+		if err := json.Unmarshal(value, &got); err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("message value got %v, want %v", got, want)
+		}
+		return nil
+	}
+
+	w := startMockKafKaWriter(t, KafKaWriterOptions{
+		ProducerTopic: "log4go-test",
+		Key:           "kafka-test",
+		MSG: KafKaMSGFields{
+			ESIndex:  "log4go",
+			ServerIP: "127.0.0.1",
+			Host:     "node-1",
+			// the extra fields can not overwrite the message fields
+			ExtraFields: map[string]interface{}{"app": "log4go", "version": 2, "level": "ignored"},
+		},
+	}, func(producer *mocks.AsyncProducer) {
+		producer.ExpectInputWithMessageCheckerFunctionAndSucceed(checker)
+	})
+	err := w.Write(&Record{
+		level:  ERROR,
+		file:   "kafka_writer_test.go:42",
+		msg:    "kafka message",
+		now:    now,
+		fields: Fields{"user": "xwi88", "err": errors.New("timeout"), "app": "ignored"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := w.Stats(); stats.Sent != 1 || stats.Failed != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func Test_KafKaWriterLevel(t *testing.T) {
+	w := startMockKafKaWriter(t, KafKaWriterOptions{ProducerTopic: "log4go-test", Level: "ERROR"},
+		func(producer *mocks.AsyncProducer) {
+			for _, level := range []string{"EMERGENCY", "CRITICAL", "ERROR"} {
+				level := level
+				producer.ExpectInputWithCheckerFunctionAndSucceed(func(value []byte) error {
+					var body map[string]interface{}
+					if err := json.Unmarshal(value, &body); err != nil {
+						return err
+					}
+					if body["level"] != level {
+						return fmt.Errorf("level got %v, want %s", body["level"], level)
+					}
+					return nil
+				})
+			}
+		})
+	for _, level := range []int{EMERGENCY, CRITICAL, ERROR, WARNING, NOTICE, INFO, DEBUG} {
+		if err := w.Write(&Record{level: level, msg: "kafka level"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the empty message is ignored
+	if err := w.Write(&Record{level: ERROR}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := w.Stats(); stats.Sent != 3 || stats.Dropped != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func Test_KafKaWriterFailure(t *testing.T) {
+	var lock sync.Mutex
+	var failed []error
+	w := startMockKafKaWriter(t, KafKaWriterOptions{
+		ProducerTopic: "log4go-test",
+		ErrorCallback: func(err error, msg *sarama.ProducerMessage) {
+			lock.Lock()
+			defer lock.Unlock()
+			failed = append(failed, err)
+		},
+	}, func(producer *mocks.AsyncProducer) {
+		producer.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+		producer.ExpectInputAndSucceed()
+		producer.ExpectInputAndFail(sarama.ErrMessageSizeTooLarge)
+	})
+	for i := 0; i < 3; i++ {
+		if err := w.Write(&Record{level: ERROR, msg: "kafka failure"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the failed messages are not undelivered
+	if err := w.Close(); err != nil || w.Undelivered() != 0 {
+		t.Errorf("close got err: %v, undelivered: %d", err, w.Undelivered())
+	}
+	if stats := w.Stats(); stats.Sent != 1 || stats.Failed != 2 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if want := []error{sarama.ErrOutOfBrokers, sarama.ErrMessageSizeTooLarge}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("error callback got %v, want %v", failed, want)
+	}
+
+	w = NewKafKaWriter(KafKaWriterOptions{
+		NewProducer: func(brokers []string, cfg *sarama.Config) (KafKaProducer, error) {
+			return nil, sarama.ErrOutOfBrokers
+		},
+	})
+	if err := w.Start(); err != sarama.ErrOutOfBrokers {
+		t.Errorf("start got err: %v, want %v", err, sarama.ErrOutOfBrokers)
+	}
+	if err := w.Write(&Record{level: ERROR, msg: "kafka failure"}); err == nil {
+		t.Error("write should fail when the writer not started")
+	}
+}
+
+func Test_KafKaWriterDrain(t *testing.T) {
+	const n = 100
+	w := startMockKafKaWriter(t, KafKaWriterOptions{ProducerTopic: "log4go-test", BufferSize: n},
+		func(producer *mocks.AsyncProducer) {
+			for i := 0; i < n; i++ {
+				producer.ExpectInputAndSucceed()
+			}
+		})
+	for i := 0; i < n; i++ {
+		if err := w.Write(&Record{level: ERROR, msg: fmt.Sprintf("kafka drain %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// all the queued messages are delivered before stopped
+	w.Stop()
+	if stats := w.Stats(); stats.Sent != n || stats.Queued != 0 || stats.Dropped != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if err := w.Write(&Record{level: ERROR, msg: "kafka drain"}); err == nil {
+		t.Error("write should fail after stopped")
+	}
+}
+
+// blockingProducer the producer never accept messages, like kafka hangs
+type blockingProducer struct {
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+}
+
+func newBlockingProducer() *blockingProducer {
+	return &blockingProducer{
+		input:     make(chan *sarama.ProducerMessage),
+		successes: make(chan *sarama.ProducerMessage),
+		errors:    make(chan *sarama.ProducerError),
+	}
+}
+
+func (p *blockingProducer) AsyncClose() {
+	close(p.successes)
+	close(p.errors)
+}
+
+func (p *blockingProducer) Close() error {
+	p.AsyncClose()
+	return nil
+}
+
+func (p *blockingProducer) Input() chan<- *sarama.ProducerMessage {
+	return p.input
+}
+
+func (p *blockingProducer) Successes() <-chan *sarama.ProducerMessage {
+	return p.successes
+}
+
+func (p *blockingProducer) Errors() <-chan *sarama.ProducerError {
+	return p.errors
+}
+
+func Test_KafKaWriterClose(t *testing.T) {
+	w := NewKafKaWriter(KafKaWriterOptions{ProducerTopic: "log4go-test"})
+	cfg, err := w.newConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	producer := mocks.NewAsyncProducer(t, cfg)
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+
+	w.producer = producer
+	w.messages = make(chan *sarama.ProducerMessage, 2)
+	w.run = 1
+	go w.daemonProducer()
+	go w.daemonResults()
+
+	for i := 0; i < 2; i++ {
+		if err := w.Write(&Record{level: ERROR, msg: "kafka close"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the concurrent closes wait for the same stop
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := w.Close(); err != nil || w.Undelivered() != 0 {
+				t.Errorf("close got err: %v, undelivered: %d", err, w.Undelivered())
+			}
+		}()
+	}
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		t.Errorf("close twice got err: %v", err)
+	}
+}
+
+func Test_KafKaWriterCloseTimeout(t *testing.T) {
+	w := NewKafKaWriter(KafKaWriterOptions{ProducerTopic: "log4go-test", CloseTimeout: 50 * time.Millisecond})
+	w.producer = newBlockingProducer()
+	w.messages = make(chan *sarama.ProducerMessage, 4)
+	w.run = 1
+	go w.daemonProducer()
+	go w.daemonResults()
+
+	for i := 0; i < 3; i++ {
+		if err := w.Write(&Record{level: ERROR, msg: "kafka close timeout"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now()
+	if err := w.Close(); err == nil {
+		t.Error("close should fail with undelivered messages")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("close should return by the timeout, elapsed %v", elapsed)
+	}
+	if w.Undelivered() != 3 {
+		t.Errorf("undelivered got %d, want 3", w.Undelivered())
+	}
+	// the producer is closed before close returned
+	select {
+	case <-w.done:
+	default:
+		t.Error("the stop should be finished after the close timeout aborted")
+	}
+	if err := w.Close(); err == nil {
+		t.Error("close twice should return the same undelivered error")
+	}
+}
+
+func Test_KafKaWriterCloseWhileWriting(t *testing.T) {
+	w := NewKafKaWriter(KafKaWriterOptions{
+		ProducerTopic:  "log4go-test",
+		OverflowPolicy: KafKaOverflowBlock,
+		CloseTimeout:   50 * time.Millisecond,
+	})
+	w.producer = newBlockingProducer()
+	w.messages = make(chan *sarama.ProducerMessage, 2)
+	w.run = 1
+	go w.daemonProducer()
+	go w.daemonResults()
+
+	// the writers block on the full queue until the close timeout aborted, then fail after stopped
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if err := w.Write(&Record{level: ERROR, msg: "kafka close while writing"}); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := w.Close(); err == nil {
+		t.Error("close should fail with undelivered messages")
+	}
+	wg.Wait()
+}
+
+func Test_KafKaWriterSecurityConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go-kafka-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := generateTestCert(t, dir)
+
+	var options KafKaWriterOptions
+	config := `{
+  "tls": {"enable": true, "ca_file": "` + certFile + `", "cert_file": "` + certFile + `", "key_file": "` + keyFile + `",
+    "server_name": "kafka.local", "insecure_skip_verify": true},
+  "sasl": {"enable": true, "mechanism": "SCRAM-SHA-512", "username": "log4go", "password": "secret"}
+}`
+	if err := json.Unmarshal([]byte(config), &options); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := NewKafKaWriter(options).newConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Net.TLS.Enable || cfg.Net.TLS.Config.ServerName != "kafka.local" || len(cfg.Net.TLS.Config.Certificates) != 1 {
+		t.Errorf("unexpected tls config: %+v", cfg.Net.TLS)
+	}
+	if !cfg.Net.SASL.Enable || cfg.Net.SASL.Mechanism != sarama.SASLTypeSCRAMSHA512 ||
+		cfg.Net.SASL.User != "log4go" || cfg.Net.SASL.Password != "secret" || cfg.Net.SASL.SCRAMClientGeneratorFunc == nil {
+		t.Errorf("unexpected sasl config: %+v", cfg.Net.SASL)
+	}
+
+	options.SASL.Mechanism = ""
+	if cfg, err = NewKafKaWriter(options).newConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Net.SASL.Mechanism != sarama.SASLTypePlaintext {
+		t.Errorf("default sasl mechanism got %s, want PLAIN", cfg.Net.SASL.Mechanism)
+	}
+
+	options.SASL.Mechanism = "GSSAPI"
+	if _, err = NewKafKaWriter(options).newConfig(); err == nil {
+		t.Error("sasl mechanism GSSAPI should be invalid")
+	}
+	options.SASL.Mechanism = ""
+	options.TLS.CAFile = keyFile
+	if _, err = NewKafKaWriter(options).newConfig(); err == nil {
+		t.Error("tls ca_file without cert should be invalid")
+	}
+}
+
+func Test_KafKaSCRAMClient(t *testing.T) {
+	for _, mechanism := range []string{sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512} {
+		options := KafKaWriterOptions{SASL: KafKaSASLOptions{Enable: true, Mechanism: mechanism, Username: "log4go", Password: "secret"}}
+		cfg, err := NewKafKaWriter(options).newConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := cfg.Net.SASL.SCRAMClientGeneratorFunc()
+
+		hash := scram.SHA256
+		if mechanism == sarama.SASLTypeSCRAMSHA512 {
+			hash = scram.HashGeneratorFcn(sha512.New)
+		}
+		credClient, _ := hash.NewClient("log4go", "secret", "")
+		kf := scram.KeyFactors{Salt: "log4go-salt", Iters: 4096}
+		server, _ := hash.NewServer(func(string) (scram.StoredCredentials, error) {
+			return credClient.GetStoredCredentials(kf), nil
+		})
+		conv := server.NewConversation()
+
+		if err := client.Begin("log4go", "secret", ""); err != nil {
+			t.Fatal(err)
+		}
+		challenge := ""
+		for !client.Done() {
+			resp, err := client.Step(challenge)
+			if err != nil {
+				t.Fatalf("%s client step err: %v", mechanism, err)
+			}
+			if client.Done() {
+				break
+			}
+			if challenge, err = conv.Step(resp); err != nil {
+				t.Fatalf("%s server step err: %v", mechanism, err)
+			}
+		}
+		if !conv.Valid() {
+			t.Errorf("%s conversation should be valid", mechanism)
+		}
+	}
+}
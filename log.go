@@ -6,6 +6,7 @@ import (
 	"log"
 	"path"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -68,16 +69,90 @@ var (
 	recordChannelSize = recordChannelSizeDefault // log chan size
 )
 
+// Fields record structured fields, pass it in the args of log methods
+// ex: log4go.Info("user %s login", name, log4go.Fields{"user_id": 1})
+type Fields map[string]interface{}
+
 // Record log record
 type Record struct {
 	level int
 	time  string
 	file  string
 	msg   string
+
+	now      time.Time // created time
+	fileName string    // source code file with full path
+	line     int       // source code line number
+	funcName string    // source code func full name, use function() for the lazily resolved name
+	pc       uintptr   // caller program counter, resolved to funcName by function()
+	fields   Fields    // structured fields, nil if not set
+}
+
+// function return the caller func full name, resolved from the pc only when some writer needs it
+func (r *Record) function() string {
+	if r.funcName == "" && r.pc != 0 {
+		if fn := runtime.FuncForPC(r.pc); fn != nil {
+			r.funcName = fn.Name()
+		}
+		r.pc = 0
+	}
+	return r.funcName
 }
 
 func (r *Record) String() string {
-	return fmt.Sprintf("%s [%s] <%s> %s\n", r.time, LevelFlags[r.level], r.file, r.msg)
+	return fmt.Sprintf("%s [%s] <%s> %s%s\n", r.time, LevelFlags[r.level], r.file, r.msg,
+		formatFields(r.fields, nil, nil))
+}
+
+// sortedKeys return the sorted keys of fields
+func (f Fields) sortedKeys() []string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatFields format fields as " key=value key2=value2" ordered by key, empty if no fields
+// keyBrush and valueBrush can be nil for no color
+func formatFields(fields Fields, keyBrush, valueBrush brush) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	for _, k := range fields.sortedKeys() {
+		key, value := k, "="+formatFieldValue(fields[k])
+		if keyBrush != nil {
+			key = keyBrush(key)
+		}
+		if valueBrush != nil {
+			value = valueBrush(value)
+		}
+		buf.WriteString(" ")
+		buf.WriteString(key)
+		buf.WriteString(value)
+	}
+	return buf.String()
+}
+
+// formatFieldValue format field value, quote if contains space, quote or equal sign
+func formatFieldValue(v interface{}) string {
+	var s string
+	switch val := v.(type) {
+	case string:
+		s = val
+	case error:
+		s = val.Error()
+	case fmt.Stringer:
+		s = val.String()
+	default:
+		s = fmt.Sprintf("%v", v)
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
 }
 
 // Writer record writer
@@ -91,6 +166,11 @@ type Flusher interface {
 	Flush() error
 }
 
+// Closer record closer, called by the logger Close after flushed
+type Closer interface {
+	Close() error
+}
+
 // Rotater record rotater
 type Rotater interface {
 	Rotate() error
@@ -145,17 +225,18 @@ func newLoggerWithRecords(records chan *Record) *Logger {
 	return l
 }
 
-// Register register writer
+// Register register writer, the writer will not be registered if init failed
 // the writer should be register once for writers by kind
-func (l *Logger) Register(w Writer) {
+func (l *Logger) Register(w Writer) error {
 	if err := w.Init(); err != nil {
-		panic(err)
+		return err
 	}
 
 	l.writers = append(l.writers, w)
+	return nil
 }
 
-// Close close logger
+// Close close logger, flush and close the writers
 func (l *Logger) Close() {
 	close(l.records)
 	<-l.c
@@ -166,6 +247,11 @@ func (l *Logger) Close() {
 				log.Println(err)
 			}
 		}
+		if c, ok := w.(Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Println(err)
+			}
+		}
 	}
 }
 
@@ -237,6 +323,9 @@ func (l *Logger) deliverRecordToWriter(level int, f string, args ...interface{})
 		return
 	}
 
+	var fields Fields
+	args, fields = extractFields(args)
+
 	msg = f
 	sz := len(args)
 	if sz != 0 {
@@ -248,6 +337,7 @@ func (l *Logger) deliverRecordToWriter(level int, f string, args ...interface{})
 	msg = fmt.Sprintf(msg, args...)
 
 	// source code, file and line num
+	var funcName string
 	pc, file, line, ok := runtime.Caller(2)
 	if ok {
 		fileName := path.Base(file)
@@ -257,9 +347,8 @@ func (l *Logger) deliverRecordToWriter(level int, f string, args ...interface{})
 		fi.WriteString(fmt.Sprintf("%s:%d", fileName, line))
 
 		if l.withFuncName {
-			funcName := runtime.FuncForPC(pc).Name()
-			funcName = path.Base(funcName)
-			fi.WriteString(fmt.Sprintf(" %s", funcName))
+			funcName = runtime.FuncForPC(pc).Name()
+			fi.WriteString(fmt.Sprintf(" %s", path.Base(funcName)))
 		}
 	}
 
@@ -278,10 +367,45 @@ func (l *Logger) deliverRecordToWriter(level int, f string, args ...interface{})
 	r.file = fi.String()
 	r.time = lastTimeStr
 	r.level = level
+	r.now = now
+	r.fileName = file
+	r.line = line
+	r.funcName = funcName
+	r.pc = 0
+	if ok && funcName == "" {
+		r.pc = pc
+	}
+	r.fields = fields
 
 	l.records <- r
 }
 
+// extractFields remove the Fields from args and merge them, args will not be modified
+func extractFields(args []interface{}) ([]interface{}, Fields) {
+	n := 0
+	for _, arg := range args {
+		if _, ok := arg.(Fields); ok {
+			n++
+		}
+	}
+	if n == 0 {
+		return args, nil
+	}
+
+	fields := make(Fields)
+	rest := make([]interface{}, 0, len(args)-n)
+	for _, arg := range args {
+		if f, ok := arg.(Fields); ok {
+			for k, v := range f {
+				fields[k] = v
+			}
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest, fields
+}
+
 func bootstrapLogWriter(logger *Logger) {
 	var (
 		r  *Record
@@ -351,8 +475,8 @@ func init() {
 }
 
 // Register register writer
-func Register(w Writer) {
-	loggerDefault.Register(w)
+func Register(w Writer) error {
+	return loggerDefault.Register(w)
 }
 
 // Close close logger
@@ -422,6 +546,15 @@ func Emergency(fmt string, args ...interface{}) {
 
 // The method is put here, so it's easy to test
 func getLevelDefault(flag string, defaultFlag int, writer string) int {
+	if level, ok := lookupLevel(flag); ok {
+		return level
+	}
+	log.Printf("[log4go] no matching level for writer(%v, flag:%v), use default level(%d, flag:%v)", writer, flag, defaultFlag, LevelFlags[defaultFlag])
+	return defaultFlag
+}
+
+// lookupLevel the level of the flag, false if no level matches
+func lookupLevel(flag string) (int, bool) {
 	// level WARN == WARNING
 	if strings.EqualFold(flag, LevelFlagWarn) {
 		flag = LevelFlagWarning
@@ -429,9 +562,8 @@ func getLevelDefault(flag string, defaultFlag int, writer string) int {
 
 	for i, f := range LevelFlags {
 		if strings.TrimSpace(strings.ToUpper(flag)) == f {
-			return i
+			return i, true
 		}
 	}
-	log.Printf("[log4go] no matching level for writer(%v, flag:%v), use default level(%d, flag:%v)", writer, flag, defaultFlag, LevelFlags[defaultFlag])
-	return defaultFlag
+	return 0, false
 }
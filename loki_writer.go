@@ -0,0 +1,385 @@
+package log4go
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// loki push encodings
+const (
+	LokiEncodingJSON     = "json"     // default
+	LokiEncodingProtobuf = "protobuf" // snappy compressed logproto.PushRequest
+)
+
+const (
+	lokiPushPath             = "/loki/api/v1/push"
+	lokiLevelLabelDefault    = "level"
+	lokiCategoryLabelDefault = "category"
+	lokiLabelDisabled        = "-"
+	lokiStreamIdleDefault    = time.Minute // the streams not written within it are dropped from the last timestamps
+)
+
+// lokiLabelName the valid label name of prometheus
+var lokiLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// LokiWriterOptions loki writer options
+type LokiWriterOptions struct {
+	Enable   bool   `json:"enable" mapstructure:"enable"`
+	Level    string `json:"level" mapstructure:"level"`
+	URL      string `json:"url" mapstructure:"url"`           // ex: http://127.0.0.1:3100
+	Encoding string `json:"encoding" mapstructure:"encoding"` // json or protobuf, default json
+	Format   string `json:"format" mapstructure:"format"`     // the log line format: text, json or logfmt, default logfmt
+
+	Labels        map[string]string `json:"labels" mapstructure:"labels"`                 // static labels, ex: {"app": "log4go"}
+	LevelLabel    string            `json:"level_label" mapstructure:"level_label"`       // the label of the record level, default level, - to disable
+	CategoryLabel string            `json:"category_label" mapstructure:"category_label"` // the label of the record field category, default category, - to disable
+
+	TenantID string `json:"tenant_id" mapstructure:"tenant_id"` // optional, the X-Scope-OrgID header
+	Username string `json:"username" mapstructure:"username"`   // optional, basic auth
+	Password string `json:"password" mapstructure:"password"`
+
+	HTTPBatchOptions `mapstructure:",squash"`
+}
+
+// LokiWriter push the records to grafana loki, the records are grouped into streams by the labels
+type LokiWriter struct {
+	level   int
+	options LokiWriterOptions
+	batcher *httpBatcher
+	encode  recordEncoder
+
+	labels        map[string]string
+	levelLabel    string
+	categoryLabel string
+	pushURL       string
+	header        http.Header
+
+	lock   sync.Mutex
+	last   map[string]int64 // the last timestamp of the streams, loki rejects the out of order entries
+	idle   time.Duration    // the idle streams are dropped from last, at least the flush interval
+	pruned time.Time        // the last time to drop the idle streams
+}
+
+// NewLokiWriter create new loki writer
+func NewLokiWriter(options LokiWriterOptions) *LokiWriter {
+	defaultLevel := DEBUG
+	if len(options.Level) > 0 {
+		defaultLevel = getLevelDefault(options.Level, defaultLevel, "")
+	}
+	return &LokiWriter{
+		level:   defaultLevel,
+		options: options,
+		last:    make(map[string]int64),
+	}
+}
+
+// Init check the options and start the batcher
+func (w *LokiWriter) Init() (err error) {
+	options := &w.options
+	if options.URL == "" {
+		return errors.New("loki writer requires url")
+	}
+	var build func(items [][]byte) (*httpPayload, error)
+	switch options.Encoding {
+	case "", LokiEncodingJSON:
+		build = w.buildJSON
+	case LokiEncodingProtobuf:
+		build = w.buildProtobuf
+	default:
+		return fmt.Errorf("loki writer invalid encoding (%s)", options.Encoding)
+	}
+	format := options.Format
+	if format == "" {
+		format = RecordFormatLogfmt
+	}
+	if w.encode, err = newRecordEncoder(format); err != nil {
+		return fmt.Errorf("loki writer %v", err)
+	}
+
+	w.levelLabel = lokiLabelOption(options.LevelLabel, lokiLevelLabelDefault)
+	w.categoryLabel = lokiLabelOption(options.CategoryLabel, lokiCategoryLabelDefault)
+	w.labels = make(map[string]string, len(options.Labels))
+	for name, value := range options.Labels {
+		w.labels[name] = value
+	}
+	for _, name := range append(sortedLabelNames(w.labels), w.levelLabel, w.categoryLabel) {
+		if name != "" && !lokiLabelName.MatchString(name) {
+			return fmt.Errorf("loki writer invalid label name (%s)", name)
+		}
+	}
+
+	w.pushURL = strings.TrimRight(options.URL, "/") + lokiPushPath
+	w.header = make(http.Header)
+	if options.TenantID != "" {
+		w.header.Set("X-Scope-OrgID", options.TenantID)
+	}
+	if options.Username != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(options.Username + ":" + options.Password))
+		w.header.Set("Authorization", "Basic "+auth)
+	}
+
+	if w.batcher, err = newHTTPBatcher("loki writer", http.MethodPost, options.HTTPBatchOptions); err != nil {
+		return err
+	}
+	w.batcher.build = build
+	w.idle = lokiStreamIdleDefault
+	if options.FlushInterval > w.idle {
+		w.idle = options.FlushInterval
+	}
+	w.pruned = time.Now()
+	w.batcher.start()
+	return nil
+}
+
+// lokiLabelOption the label name, empty if disabled
+func lokiLabelOption(name, defaultName string) string {
+	switch name {
+	case "":
+		return defaultName
+	case lokiLabelDisabled:
+		return ""
+	}
+	return name
+}
+
+func sortedLabelNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lokiLabelsString the stream selector of the labels, ex: {app="log4go", level="error"}
+func lokiLabelsString(labels map[string]string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range sortedLabelNames(labels) {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// streamLabels the static labels with the level and category of the record, as json with the sorted keys
+func (w *LokiWriter) streamLabels(r *Record) (string, error) {
+	labels := make(map[string]string, len(w.labels)+2)
+	for name, value := range w.labels {
+		labels[name] = value
+	}
+	if w.levelLabel != "" {
+		labels[w.levelLabel] = strings.ToLower(LevelFlags[r.level])
+	}
+	if w.categoryLabel != "" {
+		if category, ok := r.fields["category"]; ok {
+			labels[w.categoryLabel] = fmt.Sprint(category)
+		}
+	}
+	b, err := json.Marshal(labels)
+	return string(b), err
+}
+
+// Write encode the record to the stream entry and add it to the batch
+func (w *LokiWriter) Write(r *Record) error {
+	if r.level > w.level {
+		return nil
+	}
+	if w.batcher == nil {
+		return errors.New("loki writer not running")
+	}
+	line, err := w.encode(r)
+	if err != nil {
+		return err
+	}
+	labels, err := w.streamLabels(r)
+	if err != nil {
+		return err
+	}
+
+	// the timestamps of one stream are kept in order
+	w.lock.Lock()
+	ts := recordTime(r).UnixNano()
+	if last := w.last[labels]; ts < last {
+		ts = last
+	}
+	w.last[labels] = ts
+	w.pruneStreams()
+	w.lock.Unlock()
+
+	return w.batcher.add(lokiItem(labels, ts, bytes.TrimSuffix(line, []byte{'\n'})))
+}
+
+// pruneStreams drop the streams not written within the idle duration, their entries have been flushed,
+// bound the last timestamps with the high cardinality labels like category, must hold the lock
+func (w *LokiWriter) pruneStreams() {
+	now := time.Now()
+	if now.Sub(w.pruned) < w.idle {
+		return
+	}
+	w.pruned = now
+	expired := now.Add(-w.idle).UnixNano()
+	for labels, ts := range w.last {
+		if ts < expired {
+			delete(w.last, labels)
+		}
+	}
+}
+
+// lokiItem the batch item: labels \n timestamp \n line, the json labels and the timestamp have no newline
+func lokiItem(labels string, ts int64, line []byte) []byte {
+	item := make([]byte, 0, len(labels)+len(line)+22)
+	item = append(append(item, labels...), '\n')
+	item = append(strconv.AppendInt(item, ts, 10), '\n')
+	return append(item, line...)
+}
+
+func parseLokiItem(item []byte) (labels string, ts int64, line []byte) {
+	i := bytes.IndexByte(item, '\n')
+	j := i + 1 + bytes.IndexByte(item[i+1:], '\n')
+	ts, _ = strconv.ParseInt(string(item[i+1:j]), 10, 64)
+	return string(item[:i]), ts, item[j+1:]
+}
+
+// lokiStream the entries of one label set
+type lokiStream struct {
+	labels  map[string]string
+	entries []lokiEntry
+}
+
+type lokiEntry struct {
+	ts   int64
+	line []byte
+}
+
+// groupLokiStreams group the items by the labels in the first seen order, the entries are sorted by the timestamp
+func groupLokiStreams(items [][]byte) ([]*lokiStream, error) {
+	var streams []*lokiStream
+	index := make(map[string]*lokiStream)
+	for _, item := range items {
+		labels, ts, line := parseLokiItem(item)
+		stream, ok := index[labels]
+		if !ok {
+			stream = &lokiStream{}
+			if err := json.Unmarshal([]byte(labels), &stream.labels); err != nil {
+				return nil, err
+			}
+			index[labels] = stream
+			streams = append(streams, stream)
+		}
+		stream.entries = append(stream.entries, lokiEntry{ts: ts, line: line})
+	}
+	for _, stream := range streams {
+		entries := stream.entries
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].ts < entries[j].ts })
+	}
+	return streams, nil
+}
+
+func (w *LokiWriter) buildJSON(items [][]byte) (*httpPayload, error) {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	var push struct {
+		Streams []stream `json:"streams"`
+	}
+	streams, err := groupLokiStreams(items)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range streams {
+		values := make([][2]string, len(s.entries))
+		for i, e := range s.entries {
+			values[i] = [2]string{strconv.FormatInt(e.ts, 10), string(e.line)}
+		}
+		push.Streams = append(push.Streams, stream{Stream: s.labels, Values: values})
+	}
+	body, err := json.Marshal(push)
+	if err != nil {
+		return nil, err
+	}
+	return &httpPayload{url: w.pushURL, body: body, contentType: "application/json", header: w.header}, nil
+}
+
+// appendProtoMessage append the embedded message field
+func appendProtoMessage(b []byte, field int, msg []byte) []byte {
+	b = appendProtoVarint(b, uint64(field<<3|protoWireBytes))
+	b = appendProtoVarint(b, uint64(len(msg)))
+	return append(b, msg...)
+}
+
+// buildProtobuf encode logproto.PushRequest and compress it by snappy
+// PushRequest{streams = 1}, StreamAdapter{labels = 1, entries = 2}, EntryAdapter{timestamp = 1, line = 2},
+// google.protobuf.Timestamp{seconds = 1, nanos = 2}
+func (w *LokiWriter) buildProtobuf(items [][]byte) (*httpPayload, error) {
+	streams, err := groupLokiStreams(items)
+	if err != nil {
+		return nil, err
+	}
+	var push []byte
+	for _, s := range streams {
+		stream := appendProtoString(nil, 1, lokiLabelsString(s.labels))
+		for _, e := range s.entries {
+			var ts []byte
+			if seconds := e.ts / 1e9; seconds != 0 {
+				ts = appendProtoVarint(appendProtoVarint(ts, uint64(1<<3|protoWireVarint)), uint64(seconds))
+			}
+			if nanos := e.ts % 1e9; nanos != 0 {
+				ts = appendProtoVarint(appendProtoVarint(ts, uint64(2<<3|protoWireVarint)), uint64(nanos))
+			}
+			entry := appendProtoMessage(nil, 1, ts)
+			entry = appendProtoString(entry, 2, string(e.line))
+			stream = appendProtoMessage(stream, 2, entry)
+		}
+		push = appendProtoMessage(push, 1, stream)
+	}
+	return &httpPayload{
+		url:         w.pushURL,
+		body:        snappy.Encode(nil, push),
+		contentType: "application/x-protobuf",
+		header:      w.header,
+	}, nil
+}
+
+// Dropped return the number of records dropped by the full queue
+func (w *LokiWriter) Dropped() int64 {
+	if w.batcher == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&w.batcher.dropped)
+}
+
+// Failed return the number of records failed to push after retries
+func (w *LokiWriter) Failed() int64 {
+	if w.batcher == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&w.batcher.failed)
+}
+
+// Close push the buffered records within the close timeout
+func (w *LokiWriter) Close() error {
+	if w.batcher == nil {
+		return nil
+	}
+	return w.batcher.close()
+}
@@ -0,0 +1,235 @@
+package log4go
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// lokiTestPush the received push request
+type lokiTestPush struct {
+	tenant string
+	body   []byte
+}
+
+func newLokiTestServer(t *testing.T, contentType string) (*httptest.Server, func() []*lokiTestPush) {
+	var lock sync.Mutex
+	var pushes []*lokiTestPush
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != lokiPushPath || r.Header.Get("Content-Type") != contentType {
+			t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		lock.Lock()
+		pushes = append(pushes, &lokiTestPush{tenant: r.Header.Get("X-Scope-OrgID"), body: body})
+		lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return server, func() []*lokiTestPush {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]*lokiTestPush(nil), pushes...)
+	}
+}
+
+func Test_LokiWriterJSON(t *testing.T) {
+	server, pushes := newLokiTestServer(t, "application/json")
+	defer server.Close()
+
+	w := NewLokiWriter(LokiWriterOptions{
+		URL:              server.URL,
+		Labels:           map[string]string{"app": "log4go"},
+		TenantID:         "team-a",
+		HTTPBatchOptions: HTTPBatchOptions{BatchSize: 4, FlushInterval: time.Hour},
+	})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+	records := []*Record{
+		{level: ERROR, msg: "e1", now: now},
+		{level: INFO, msg: "i1", now: now, fields: Fields{"category": "order"}},
+		{level: ERROR, msg: "e2", now: now.Add(-time.Second)}, // out of order, clamped to e1
+		{level: ERROR, msg: "e3", now: now.Add(time.Second)},
+	}
+	for _, r := range records {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := pushes()
+	if len(got) != 1 || got[0].tenant != "team-a" {
+		t.Fatalf("pushes got %d", len(got))
+	}
+	var push struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(got[0].body, &push); err != nil {
+		t.Fatal(err)
+	}
+	if len(push.Streams) != 2 {
+		t.Fatalf("streams got %d, want 2", len(push.Streams))
+	}
+
+	errs, infos := push.Streams[0], push.Streams[1]
+	if errs.Stream["app"] != "log4go" || errs.Stream["level"] != "error" || len(errs.Stream) != 2 {
+		t.Errorf("error stream labels got %v", errs.Stream)
+	}
+	if infos.Stream["level"] != "info" || infos.Stream["category"] != "order" {
+		t.Errorf("info stream labels got %v", infos.Stream)
+	}
+	ts := now.UnixNano()
+	wants := []struct {
+		ts  int64
+		msg string
+	}{{ts, "msg=e1"}, {ts, "msg=e2"}, {ts + int64(time.Second), "msg=e3"}}
+	if len(errs.Values) != len(wants) {
+		t.Fatalf("error stream values got %v", errs.Values)
+	}
+	for i, want := range wants {
+		value := errs.Values[i]
+		if value[0] != strconv.FormatInt(want.ts, 10) || !strings.Contains(value[1], want.msg) || strings.HasSuffix(value[1], "\n") {
+			t.Errorf("value %d got %v, want %d %s", i, value, want.ts, want.msg)
+		}
+	}
+}
+
+func Test_LokiWriterProtobuf(t *testing.T) {
+	server, pushes := newLokiTestServer(t, "application/x-protobuf")
+	defer server.Close()
+
+	w := NewLokiWriter(LokiWriterOptions{
+		URL:              server.URL,
+		Encoding:         LokiEncodingProtobuf,
+		Format:           RecordFormatJSON,
+		Labels:           map[string]string{"app": "log4go"},
+		LevelLabel:       "severity",
+		CategoryLabel:    lokiLabelDisabled,
+		HTTPBatchOptions: HTTPBatchOptions{BatchSize: 1},
+	})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 6, 1, 8, 0, 0, 500, time.UTC)
+	if err := w.Write(&Record{level: WARNING, msg: "loki", now: now, fields: Fields{"category": "order"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := pushes()
+	if len(got) != 1 {
+		t.Fatalf("pushes got %d", len(got))
+	}
+	push, err := snappy.Decode(nil, got[0].body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// PushRequest.streams
+	tag, b := readProtoVarint(t, push)
+	if tag != 1<<3|protoWireBytes {
+		t.Fatalf("push tag got %d", tag)
+	}
+	stream, _ := readProtoBytes(t, b)
+	// StreamAdapter.labels
+	tag, stream = readProtoVarint(t, stream)
+	labels, stream := readProtoBytes(t, stream)
+	if tag != 1<<3|protoWireBytes || string(labels) != `{app="log4go", severity="warning"}` {
+		t.Errorf("labels got %d %s", tag, labels)
+	}
+	// StreamAdapter.entries
+	tag, stream = readProtoVarint(t, stream)
+	entry, _ := readProtoBytes(t, stream)
+	if tag != 2<<3|protoWireBytes {
+		t.Fatalf("entry tag got %d", tag)
+	}
+	tag, entry = readProtoVarint(t, entry)
+	timestamp, entry := readProtoBytes(t, entry)
+	if tag != 1<<3|protoWireBytes {
+		t.Fatalf("timestamp tag got %d", tag)
+	}
+	_, timestamp = readProtoVarint(t, timestamp)
+	seconds, timestamp := readProtoVarint(t, timestamp)
+	_, timestamp = readProtoVarint(t, timestamp)
+	nanos, _ := readProtoVarint(t, timestamp)
+	if int64(seconds) != now.Unix() || nanos != 500 {
+		t.Errorf("timestamp got %d.%d", seconds, nanos)
+	}
+	tag, entry = readProtoVarint(t, entry)
+	line, _ := readProtoBytes(t, entry)
+	var doc map[string]interface{}
+	if err := json.Unmarshal(line, &doc); err != nil || tag != 2<<3|protoWireBytes {
+		t.Fatalf("line got %d %s", tag, line)
+	}
+	if doc["message"] != "loki" || doc["category"] != "order" {
+		t.Errorf("line got %v", doc)
+	}
+}
+
+func Test_LokiWriterStreamsPruned(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	w := NewLokiWriter(LokiWriterOptions{URL: server.URL})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.idle = 50 * time.Millisecond
+
+	for i := 0; i < 100; i++ {
+		if err := w.Write(&Record{level: INFO, msg: "stream", fields: Fields{"category": i}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := w.Write(&Record{level: INFO, msg: "stream", fields: Fields{"category": "order"}}); err != nil {
+		t.Fatal(err)
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if len(w.last) != 1 {
+		t.Errorf("the idle streams should be dropped, got %d", len(w.last))
+	}
+}
+
+func Test_LokiWriterOptions(t *testing.T) {
+	for _, options := range []LokiWriterOptions{
+		{},
+		{URL: "http://127.0.0.1:3100", Encoding: "xml"},
+		{URL: "http://127.0.0.1:3100", Format: "csv"},
+		{URL: "http://127.0.0.1:3100", Labels: map[string]string{"app-name": "log4go"}},
+		{URL: "http://127.0.0.1:3100", LevelLabel: "1level"},
+	} {
+		if err := NewLokiWriter(options).Init(); err == nil {
+			t.Errorf("options %+v should be invalid", options)
+		}
+	}
+
+	w := NewLokiWriter(LokiWriterOptions{URL: "http://127.0.0.1:3100", Level: LevelFlagError})
+	if err := w.Write(&Record{level: ERROR}); err == nil {
+		t.Error("write before init should fail")
+	}
+	if err := w.Write(&Record{level: INFO}); err != nil {
+		t.Errorf("record below the level should be skipped, err: %v", err)
+	}
+}
@@ -0,0 +1,382 @@
+package log4go
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// the minimal msgpack encoder and decoder of the fluent forward protocol
+
+const (
+	msgpackLengthMax   = 64 << 20 // the max length read from the peer
+	msgpackPreallocMax = 1024     // the max elements preallocated, the rest grow by append
+	msgpackDepthMax    = 32       // the max nesting depth of the arrays and maps read from the peer
+)
+
+func appendMsgpackNil(b []byte) []byte {
+	return append(b, 0xc0)
+}
+
+func appendMsgpackBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xc3)
+	}
+	return append(b, 0xc2)
+}
+
+func appendMsgpackUint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<7:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return append(b, 0xcd, byte(v>>8), byte(v))
+	case v <= math.MaxUint32:
+		b = append(b, 0xce)
+		return appendUint32(b, uint32(v))
+	}
+	b = append(b, 0xcf)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendMsgpackInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return appendMsgpackUint(b, uint64(v))
+	case v >= -32:
+		return append(b, byte(v))
+	case v >= math.MinInt8:
+		return append(b, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return append(b, 0xd1, byte(v>>8), byte(v))
+	case v >= math.MinInt32:
+		b = append(b, 0xd2)
+		return appendUint32(b, uint32(v))
+	}
+	b = append(b, 0xd3)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(v))
+	return append(b, buf[:]...)
+}
+
+func appendMsgpackFloat(b []byte, v float64) []byte {
+	b = append(b, 0xcb)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], math.Float64bits(v))
+	return append(b, buf[:]...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// appendMsgpackHeader the length header by the fix, 8, 16 or 32 bits code, 0 code if unsupported
+func appendMsgpackHeader(b []byte, n int, fix byte, fixMax int, code8, code16, code32 byte) []byte {
+	switch {
+	case n < fixMax:
+		return append(b, fix|byte(n))
+	case code8 != 0 && n <= math.MaxUint8:
+		return append(b, code8, byte(n))
+	case n <= math.MaxUint16:
+		return append(b, code16, byte(n>>8), byte(n))
+	}
+	b = append(b, code32)
+	return appendUint32(b, uint32(n))
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	b = appendMsgpackHeader(b, len(s), 0xa0, 32, 0xd9, 0xda, 0xdb)
+	return append(b, s...)
+}
+
+func appendMsgpackBin(b []byte, v []byte) []byte {
+	// bin has no fix format
+	b = appendMsgpackHeader(b, len(v), 0, 0, 0xc4, 0xc5, 0xc6)
+	return append(b, v...)
+}
+
+func appendMsgpackArrayHeader(b []byte, n int) []byte {
+	return appendMsgpackHeader(b, n, 0x90, 16, 0, 0xdc, 0xdd)
+}
+
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	return appendMsgpackHeader(b, n, 0x80, 16, 0, 0xde, 0xdf)
+}
+
+// appendMsgpackEventTime the fluent EventTime ext type 0: seconds and nanoseconds in big endian uint32
+func appendMsgpackEventTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xd7, 0x00)
+	b = appendUint32(b, uint32(t.Unix()))
+	return appendUint32(b, uint32(t.Nanosecond()))
+}
+
+// appendMsgpackMap the map ordered by key
+func appendMsgpackMap(b []byte, m map[string]interface{}) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b = appendMsgpackMapHeader(b, len(keys))
+	for _, k := range keys {
+		b = appendMsgpackString(b, k)
+		b = appendMsgpackValue(b, m[k])
+	}
+	return b
+}
+
+// appendMsgpackValue encode the value, the other types are encoded by the json representation
+func appendMsgpackValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return appendMsgpackNil(b)
+	case bool:
+		return appendMsgpackBool(b, v)
+	case string:
+		return appendMsgpackString(b, v)
+	case []byte:
+		return appendMsgpackBin(b, v)
+	case int:
+		return appendMsgpackInt(b, int64(v))
+	case int8:
+		return appendMsgpackInt(b, int64(v))
+	case int16:
+		return appendMsgpackInt(b, int64(v))
+	case int32:
+		return appendMsgpackInt(b, int64(v))
+	case int64:
+		return appendMsgpackInt(b, v)
+	case uint:
+		return appendMsgpackUint(b, uint64(v))
+	case uint8:
+		return appendMsgpackUint(b, uint64(v))
+	case uint16:
+		return appendMsgpackUint(b, uint64(v))
+	case uint32:
+		return appendMsgpackUint(b, uint64(v))
+	case uint64:
+		return appendMsgpackUint(b, v)
+	case float32:
+		return appendMsgpackFloat(b, float64(v))
+	case float64:
+		return appendMsgpackFloat(b, v)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return appendMsgpackInt(b, n)
+		}
+		if n, err := v.Float64(); err == nil {
+			return appendMsgpackFloat(b, n)
+		}
+		return appendMsgpackString(b, v.String())
+	case error:
+		return appendMsgpackString(b, v.Error())
+	case time.Time:
+		return appendMsgpackString(b, v.Format(time.RFC3339Nano))
+	case []interface{}:
+		b = appendMsgpackArrayHeader(b, len(v))
+		for _, item := range v {
+			b = appendMsgpackValue(b, item)
+		}
+		return b
+	case map[string]interface{}:
+		return appendMsgpackMap(b, v)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return appendMsgpackString(b, fmt.Sprint(v))
+	}
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return appendMsgpackString(b, string(data))
+	}
+	return appendMsgpackValue(b, value)
+}
+
+// readMsgpack decode one value: nil, bool, int64, uint64, float64, string, []byte for bin and ext,
+// []interface{} and map[string]interface{}
+func readMsgpack(r *bufio.Reader) (interface{}, error) {
+	return readMsgpackValue(r, 0)
+}
+
+// readMsgpackValue decode one value within the depth of the nested arrays and maps
+func readMsgpackValue(r *bufio.Reader, depth int) (interface{}, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c >= 0x80 && c <= 0x8f:
+		return readMsgpackMap(r, int(c&0x0f), depth+1)
+	case c >= 0x90 && c <= 0x9f:
+		return readMsgpackArray(r, int(c&0x0f), depth+1)
+	case c >= 0xa0 && c <= 0xbf:
+		b, err := readMsgpackBytes(r, int(c&0x1f))
+		return string(b), err
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readMsgpackLength(r, 1<<(c-0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackBytes(r, n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := readMsgpackLength(r, 1<<(c-0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackBytes(r, n+1) // the ext type and the data
+	case 0xca:
+		n, err := readMsgpackLength(r, 4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		b, err := readMsgpackBytes(r, 8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		b, err := readMsgpackBytes(r, 1<<(c-0xcc))
+		if err != nil {
+			return nil, err
+		}
+		var v uint64
+		for _, x := range b {
+			v = v<<8 | uint64(x)
+		}
+		return v, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		b, err := readMsgpackBytes(r, size)
+		if err != nil {
+			return nil, err
+		}
+		var v uint64
+		for _, x := range b {
+			v = v<<8 | uint64(x)
+		}
+		shift := uint(64 - 8*size) // sign extend
+		return int64(v<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return readMsgpackBytes(r, 1+1<<(c-0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := readMsgpackLength(r, 1<<(c-0xd9))
+		if err != nil {
+			return nil, err
+		}
+		b, err := readMsgpackBytes(r, n)
+		return string(b), err
+	case 0xdc, 0xdd:
+		n, err := readMsgpackLength(r, 2<<(c-0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackArray(r, n, depth+1)
+	case 0xde, 0xdf:
+		n, err := readMsgpackLength(r, 2<<(c-0xde))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackMap(r, n, depth+1)
+	}
+	return nil, fmt.Errorf("invalid msgpack code 0x%x", c)
+}
+
+// readMsgpackLength read the big endian length of the size bytes
+func readMsgpackLength(r *bufio.Reader, size int) (int, error) {
+	b, err := readMsgpackBytes(r, size)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, x := range b {
+		n = n<<8 | int(x)
+	}
+	return n, nil
+}
+
+func readMsgpackBytes(r *bufio.Reader, n int) ([]byte, error) {
+	if n < 0 || n > msgpackLengthMax {
+		return nil, fmt.Errorf("msgpack length %d too large", n)
+	}
+	b := make([]byte, n)
+	_, err := io.ReadFull(r, b)
+	return b, err
+}
+
+func readMsgpackArray(r *bufio.Reader, n, depth int) ([]interface{}, error) {
+	if depth > msgpackDepthMax {
+		return nil, fmt.Errorf("msgpack nesting depth over %d", msgpackDepthMax)
+	}
+	if n < 0 || n > msgpackLengthMax {
+		return nil, fmt.Errorf("msgpack array length %d too large", n)
+	}
+	a := make([]interface{}, 0, msgpackPrealloc(n))
+	for i := 0; i < n; i++ {
+		v, err := readMsgpackValue(r, depth)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+// msgpackPrealloc the capacity of n elements, the length is from the peer and not trusted
+func msgpackPrealloc(n int) int {
+	if n > msgpackPreallocMax {
+		return msgpackPreallocMax
+	}
+	return n
+}
+
+// readMsgpackMap the keys are formatted to string
+func readMsgpackMap(r *bufio.Reader, n, depth int) (map[string]interface{}, error) {
+	if depth > msgpackDepthMax {
+		return nil, fmt.Errorf("msgpack nesting depth over %d", msgpackDepthMax)
+	}
+	if n < 0 || n > msgpackLengthMax {
+		return nil, fmt.Errorf("msgpack map length %d too large", n)
+	}
+	m := make(map[string]interface{}, msgpackPrealloc(n))
+	for i := 0; i < n; i++ {
+		k, err := readMsgpackValue(r, depth)
+		if err != nil {
+			return nil, err
+		}
+		v, err := readMsgpackValue(r, depth)
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := k.(string); ok {
+			m[s] = v
+		} else {
+			m[fmt.Sprint(k)] = v
+		}
+	}
+	return m, nil
+}
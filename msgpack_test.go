@@ -0,0 +1,112 @@
+package log4go
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_MsgpackRoundTrip(t *testing.T) {
+	type point struct {
+		X int `json:"x"`
+		Y int `json:"y"`
+	}
+	long := strings.Repeat("x", 70000)
+	values := []struct {
+		in   interface{}
+		want interface{}
+	}{
+		{nil, nil},
+		{true, true},
+		{false, false},
+		{7, int64(7)},
+		{-7, int64(-7)},
+		{-100, int64(-100)},
+		{int16(-1000), int64(-1000)},
+		{int32(-100000), int64(-100000)},
+		{int64(math.MinInt64), int64(math.MinInt64)},
+		{200, uint64(200)},
+		{60000, uint64(60000)},
+		{uint32(math.MaxUint32), uint64(math.MaxUint32)},
+		{uint64(math.MaxUint64), uint64(math.MaxUint64)},
+		{1.5, 1.5},
+		{"", ""},
+		{"short", "short"},
+		{strings.Repeat("s", 200), strings.Repeat("s", 200)},
+		{long, long},
+		{[]byte{1, 2}, []byte{1, 2}},
+		{errors.New("timeout"), "timeout"},
+		{time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC), "2021-06-01T08:00:00Z"},
+		{[]interface{}{1, "a"}, []interface{}{int64(1), "a"}},
+		{map[string]interface{}{"b": 1, "a": []interface{}{}}, map[string]interface{}{"a": []interface{}{}, "b": int64(1)}},
+		{point{1, -2}, map[string]interface{}{"x": int64(1), "y": int64(-2)}},
+		{[]int{1, 2}, []interface{}{int64(1), int64(2)}},
+	}
+	for _, v := range values {
+		got, err := readMsgpack(bufio.NewReader(bytes.NewReader(appendMsgpackValue(nil, v.in))))
+		if err != nil {
+			t.Fatalf("decode %v err: %v", v.in, err)
+		}
+		if !reflect.DeepEqual(got, v.want) {
+			t.Errorf("round trip %T got %v, want %v", v.in, got, v.want)
+		}
+	}
+}
+
+func Test_MsgpackHeaders(t *testing.T) {
+	items := make([]interface{}, 20)
+	for i := range items {
+		items[i] = i
+	}
+	got, err := readMsgpack(bufio.NewReader(bytes.NewReader(appendMsgpackValue(nil, items))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := got.([]interface{}); !ok || len(a) != 20 || a[19] != int64(19) {
+		t.Errorf("array16 got %v", got)
+	}
+
+	b := appendMsgpackEventTime(nil, time.Unix(1622534400, 123))
+	want := []byte{0xd7, 0, 0x60, 0xb5, 0xe9, 0x00, 0, 0, 0, 123}
+	if !bytes.Equal(b, want) {
+		t.Errorf("event time got %x, want %x", b, want)
+	}
+	if got, err := readMsgpack(bufio.NewReader(bytes.NewReader(b))); err != nil || !bytes.Equal(got.([]byte), want[1:]) {
+		t.Errorf("event time decoded got %v, err: %v", got, err)
+	}
+
+	if _, err := readMsgpack(bufio.NewReader(bytes.NewReader([]byte{0xc1}))); err == nil {
+		t.Error("never used code should fail")
+	}
+	if _, err := readMsgpack(bufio.NewReader(bytes.NewReader([]byte{0xa5, 'a'}))); err == nil {
+		t.Error("truncated string should fail")
+	}
+	// the huge lengths fail without allocating
+	for _, b := range [][]byte{
+		{0xdd, 0xff, 0xff, 0xff, 0xff},
+		{0xdf, 0xff, 0xff, 0xff, 0xff},
+		{0xdd, 0x00, 0x10, 0x00, 0x00, 0x01},
+		{0xdf, 0x00, 0x10, 0x00, 0x00, 0xa1, 'k'},
+	} {
+		if _, err := readMsgpack(bufio.NewReader(bytes.NewReader(b))); err == nil {
+			t.Errorf("msgpack %x should fail", b)
+		}
+	}
+
+	// the nesting depth is limited, the deeply nested fail without recursing
+	nested := append(bytes.Repeat([]byte{0x91}, msgpackDepthMax), 0xc0)
+	if _, err := readMsgpack(bufio.NewReader(bytes.NewReader(nested))); err != nil {
+		t.Errorf("msgpack nested %d got err: %v", msgpackDepthMax, err)
+	}
+	for _, c := range []byte{0x91, 0x81} {
+		b := append(bytes.Repeat([]byte{c}, 100000), 0xc0)
+		if _, err := readMsgpack(bufio.NewReader(bytes.NewReader(b))); err == nil || !strings.Contains(err.Error(), "depth") {
+			t.Errorf("msgpack nested %x got err: %v", c, err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package log4go
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+)
+
+// netConn the reconnecting connection of the network writers, not safe for concurrent use
+type netConn struct {
+	network      string        // tcp, udp or unixgram
+	address      string        // host:port or the socket path
+	tls          *tls.Config   // dial tcp with tls if set
+	dialTimeout  time.Duration // default 5s
+	writeTimeout time.Duration // write deadline, default 5s
+	interval     time.Duration // min interval to redial, redial at once if 0
+
+	conn     net.Conn
+	lastDial time.Time
+}
+
+// connect dial the address, at most once per interval
+func (c *netConn) connect() (err error) {
+	if c.interval > 0 && !c.lastDial.IsZero() && time.Since(c.lastDial) < c.interval {
+		return fmt.Errorf("reconnect within %v", c.interval)
+	}
+	c.lastDial = time.Now()
+
+	dialer := &net.Dialer{Timeout: netConnTimeout(c.dialTimeout)}
+	if c.tls != nil {
+		c.conn, err = tls.DialWithDialer(dialer, "tcp", c.address, c.tls)
+	} else {
+		c.conn, err = dialer.Dial(c.network, c.address)
+	}
+	if err != nil {
+		c.conn = nil
+	}
+	return err
+}
+
+// send write the data, reconnect and retry once if failed
+func (c *netConn) send(data []byte) error {
+	var err error
+	for i := 0; i < 2; i++ {
+		if c.conn == nil {
+			if err = c.connect(); err != nil {
+				break
+			}
+		}
+		if err = c.write(data); err == nil {
+			return nil
+		}
+		c.close()
+	}
+	return err
+}
+
+func (c *netConn) write(data []byte) error {
+	if err := c.conn.SetWriteDeadline(time.Now().Add(netConnTimeout(c.writeTimeout))); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(data)
+	return err
+}
+
+func (c *netConn) close() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func netConnTimeout(timeout time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	return netTimeoutDefault
+}
@@ -0,0 +1,75 @@
+package log4go
+
+import (
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_netConnRetry(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				data, _ := ioutil.ReadAll(conn)
+				received <- string(data)
+			}()
+		}
+	}()
+
+	c := &netConn{network: "tcp", address: ln.Addr().String()}
+	if err := c.connect(); err != nil {
+		t.Fatal(err)
+	}
+	// the broken connection is closed and the data is sent by the redialed one
+	_ = c.conn.Close()
+	if err := c.send([]byte("retried")); err != nil {
+		t.Fatal(err)
+	}
+	c.close()
+	var got []string
+	for i := 0; i < 2; i++ {
+		select {
+		case data := <-received:
+			got = append(got, data)
+		case <-time.After(5 * time.Second):
+			t.Fatal("connections not closed")
+		}
+	}
+	if strings.Join(got, "") != "retried" {
+		t.Errorf("received %q", got)
+	}
+}
+
+func Test_netConnInterval(t *testing.T) {
+	// reserve a free port, the endpoint is down
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	c := &netConn{network: "tcp", address: addr, interval: time.Hour}
+	if err := c.send([]byte("down")); err == nil {
+		t.Fatal("send to the closed port should fail")
+	}
+	if err := c.send([]byte("down")); err == nil || !strings.Contains(err.Error(), "reconnect within") {
+		t.Errorf("redial within the interval got %v", err)
+	}
+	if c.conn != nil {
+		t.Error("the failed connection should be dropped")
+	}
+}
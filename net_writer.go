@@ -0,0 +1,239 @@
+package log4go
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// net writer networks
+const (
+	NetNetworkTCP = "tcp" // default
+	NetNetworkUDP = "udp" // one record per datagram
+)
+
+const (
+	netBufferSizeDefault   = 1024
+	netTimeoutDefault      = 5 * time.Second
+	netBackoffMinDefault   = 100 * time.Millisecond
+	netBackoffMaxDefault   = 30 * time.Second
+	netCloseTimeoutDefault = 5 * time.Second
+)
+
+// NetWriterOptions net writer options
+type NetWriterOptions struct {
+	Enable  bool   `json:"enable" mapstructure:"enable"`
+	Level   string `json:"level" mapstructure:"level"`
+	Network string `json:"network" mapstructure:"network"` // tcp or udp, default tcp
+	Address string `json:"address" mapstructure:"address"` // host:port
+	Format  string `json:"format" mapstructure:"format"`   // text, json or logfmt, default text
+
+	PoolSize   int `json:"pool_size" mapstructure:"pool_size"`     // connections to send in parallel, default 1
+	BufferSize int `json:"buffer_size" mapstructure:"buffer_size"` // queued records, the oldest dropped when full, default 1024
+
+	DialTimeout  time.Duration `json:"dial_timeout" mapstructure:"dial_timeout"`   // default 5s
+	WriteTimeout time.Duration `json:"write_timeout" mapstructure:"write_timeout"` // write deadline, default 5s
+	BackoffMin   time.Duration `json:"backoff_min" mapstructure:"backoff_min"`     // first reconnect delay, doubled on failures, default 100ms
+	BackoffMax   time.Duration `json:"backoff_max" mapstructure:"backoff_max"`     // max reconnect delay, default 30s
+	CloseTimeout time.Duration `json:"close_timeout" mapstructure:"close_timeout"` // the deadline to send the queued records when closed, default 5s
+}
+
+// NetWriter send the encoded records to a tcp or udp endpoint
+type NetWriter struct {
+	level   int
+	options NetWriterOptions
+	encode  recordEncoder
+
+	lock    sync.RWMutex // protect the queue closed
+	queue   chan []byte  // bounded buffer, kept while disconnected
+	closed  bool
+	abort   chan struct{} // closed when close timeout, the workers stop reconnecting
+	workers sync.WaitGroup
+
+	pending int64 // records queued or sending
+	dropped int64 // records dropped by the full queue
+}
+
+// NewNetWriter create new net writer
+func NewNetWriter(options NetWriterOptions) *NetWriter {
+	defaultLevel := DEBUG
+	if len(options.Level) > 0 {
+		defaultLevel = getLevelDefault(options.Level, defaultLevel, "")
+	}
+	return &NetWriter{
+		level:   defaultLevel,
+		options: options,
+		encode:  encodeRecordText,
+		abort:   make(chan struct{}),
+	}
+}
+
+// Init check the options and start the senders, the connections are dialed by the senders
+func (w *NetWriter) Init() (err error) {
+	options := &w.options
+	switch options.Network {
+	case "":
+		options.Network = NetNetworkTCP
+	case NetNetworkTCP, NetNetworkUDP:
+	default:
+		return fmt.Errorf("net writer invalid network (%s)", options.Network)
+	}
+	if options.Address == "" {
+		return errors.New("net writer requires address")
+	}
+	if w.encode, err = newRecordEncoder(options.Format); err != nil {
+		return fmt.Errorf("net writer %v", err)
+	}
+
+	size := options.BufferSize
+	if size <= 0 {
+		size = netBufferSizeDefault
+	}
+	w.queue = make(chan []byte, size)
+	pool := options.PoolSize
+	if pool <= 0 {
+		pool = 1
+	}
+	for i := 0; i < pool; i++ {
+		w.workers.Add(1)
+		go w.daemonSender()
+	}
+	return nil
+}
+
+// Write encode and queue the record, drop the oldest record if the queue is full
+func (w *NetWriter) Write(r *Record) error {
+	if r.level > w.level {
+		return nil
+	}
+	data, err := w.encode(r)
+	if err != nil {
+		return err
+	}
+
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	if w.queue == nil || w.closed {
+		return errors.New("net writer not running")
+	}
+	atomic.AddInt64(&w.pending, 1)
+	for {
+		select {
+		case w.queue <- data:
+			return nil
+		default:
+		}
+		select {
+		case <-w.queue:
+			atomic.AddInt64(&w.pending, -1)
+			atomic.AddInt64(&w.dropped, 1)
+		default:
+		}
+	}
+}
+
+// Dropped return the number of records dropped by the full queue
+func (w *NetWriter) Dropped() int64 {
+	return atomic.LoadInt64(&w.dropped)
+}
+
+// daemonSender send the queued records by one connection, reconnect with exponential backoff
+func (w *NetWriter) daemonSender() {
+	defer w.workers.Done()
+
+	conn := &netConn{
+		network:      w.options.Network,
+		address:      w.options.Address,
+		dialTimeout:  w.options.DialTimeout,
+		writeTimeout: w.options.WriteTimeout,
+	}
+	defer conn.close()
+
+	backoff := w.backoffMin()
+	for data := range w.queue {
+		select {
+		case <-w.abort:
+			return
+		default:
+		}
+		for {
+			if err := conn.send(data); err != nil {
+				log.Printf("[log4go] net writer send %s err: %v, retry in %v", w.options.Address, err.Error(), backoff)
+				if !w.sleep(backoff) {
+					return
+				}
+				if backoff *= 2; backoff > w.backoffMax() {
+					backoff = w.backoffMax()
+				}
+				continue
+			}
+			backoff = w.backoffMin()
+			atomic.AddInt64(&w.pending, -1)
+			break
+		}
+	}
+}
+
+// sleep wait the backoff, return false if aborted
+func (w *NetWriter) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-w.abort:
+		return false
+	}
+}
+
+func (w *NetWriter) backoffMin() time.Duration {
+	if w.options.BackoffMin > 0 {
+		return w.options.BackoffMin
+	}
+	return netBackoffMinDefault
+}
+
+func (w *NetWriter) backoffMax() time.Duration {
+	if w.options.BackoffMax > 0 {
+		return w.options.BackoffMax
+	}
+	return netBackoffMaxDefault
+}
+
+// Close send the queued records within the close timeout, the rest are discarded and reported by the returned error
+func (w *NetWriter) Close() error {
+	w.lock.Lock()
+	if w.queue == nil || w.closed {
+		w.lock.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.queue)
+	w.lock.Unlock()
+
+	timeout := w.options.CloseTimeout
+	if timeout <= 0 {
+		timeout = netCloseTimeoutDefault
+	}
+	stopped := make(chan struct{})
+	go func() {
+		w.workers.Wait()
+		close(stopped)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-stopped:
+	case <-timer.C:
+		close(w.abort)
+		<-stopped
+	}
+
+	if n := atomic.LoadInt64(&w.pending); n > 0 {
+		return fmt.Errorf("net writer closed with %d undelivered records", n)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package log4go
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readNetLines accept the connections and read n lines from them
+func readNetLines(t *testing.T, ln net.Listener, n int) []string {
+	lines := make(chan string, n)
+	var wg sync.WaitGroup
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+
+	var got []string
+	timeout := time.After(5 * time.Second)
+	for len(got) < n {
+		select {
+		case line := <-lines:
+			got = append(got, line)
+		case <-timeout:
+			t.Fatalf("read %d lines, want %d", len(got), n)
+		}
+	}
+	return got
+}
+
+func Test_NetWriterTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	w := NewNetWriter(NetWriterOptions{Address: ln.Addr().String(), Format: RecordFormatJSON, PoolSize: 2, Level: "INFO"})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := w.Write(&Record{level: INFO, msg: fmt.Sprintf("net %d", i), fields: Fields{"i": i}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Write(&Record{level: DEBUG, msg: "filtered"}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := readNetLines(t, ln, 10)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, line := range lines {
+		var body map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body["level"] != LevelFlagInfo || body["message"] != fmt.Sprintf("net %v", body["i"]) {
+			t.Errorf("unexpected record %s", line)
+		}
+		got = append(got, body["message"].(string))
+	}
+	sort.Strings(got)
+	if got[0] != "net 0" || got[9] != "net 9" {
+		t.Errorf("records got %v", got)
+	}
+	if err := w.Write(&Record{level: INFO, msg: "closed"}); err == nil {
+		t.Error("write should fail after closed")
+	}
+}
+
+func Test_NetWriterUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w := NewNetWriter(NetWriterOptions{Network: NetNetworkUDP, Address: conn.LocalAddr().String(), Format: RecordFormatLogfmt})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Write(&Record{level: ERROR, msg: "net udp", fields: Fields{"user": "xwi88"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); !strings.HasSuffix(got, ` level=ERROR msg="net udp" user=xwi88`+"\n") {
+		t.Errorf("udp got %q", got)
+	}
+}
+
+func Test_NetWriterReconnect(t *testing.T) {
+	// reserve a free port, the endpoint is down until listened again
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	w := NewNetWriter(NetWriterOptions{
+		Address:    addr,
+		BufferSize: 3,
+		BackoffMin: 10 * time.Millisecond,
+		BackoffMax: 40 * time.Millisecond,
+	})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(&Record{level: ERROR, msg: "net 0"}); err != nil {
+		t.Fatal(err)
+	}
+	// the sender holds the first record while reconnecting
+	for len(w.queue) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 1; i <= 4; i++ {
+		if err := w.Write(&Record{level: ERROR, msg: fmt.Sprintf("net %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w.Dropped() != 1 {
+		t.Errorf("dropped got %d, want 1", w.Dropped())
+	}
+
+	if ln, err = net.Listen("tcp", addr); err != nil {
+		t.Skipf("listen %s again err: %v", addr, err)
+	}
+	defer ln.Close()
+	lines := readNetLines(t, ln, 4)
+	for i, want := range []string{"net 0", "net 2", "net 3", "net 4"} {
+		if !strings.HasSuffix(lines[i], "> "+want) {
+			t.Errorf("line %d got %s, want %s", i, lines[i], want)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_NetWriterCloseTimeout(t *testing.T) {
+	w := NewNetWriter(NetWriterOptions{Address: "127.0.0.1:1", BackoffMin: time.Second, CloseTimeout: 50 * time.Millisecond})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := w.Write(&Record{level: ERROR, msg: "net close"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now()
+	if err := w.Close(); err == nil || !strings.Contains(err.Error(), "2 undelivered") {
+		t.Errorf("close got err: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("close should return by the timeout, elapsed %v", elapsed)
+	}
+}
+
+func Test_NetWriterOptions(t *testing.T) {
+	for _, options := range []NetWriterOptions{
+		{Network: "unix", Address: "127.0.0.1:514"},
+		{Network: NetNetworkTCP},
+		{Address: "127.0.0.1:514", Format: "xml"},
+	} {
+		if err := NewNetWriter(options).Init(); err == nil {
+			t.Errorf("options %+v should be invalid", options)
+		}
+	}
+	if err := NewNetWriter(NetWriterOptions{}).Write(&Record{level: ERROR, msg: "net"}); err == nil {
+		t.Error("write should fail before init")
+	}
+}
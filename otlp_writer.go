@@ -0,0 +1,497 @@
+package log4go
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+
+	"golang.org/x/net/http2"
+)
+
+// otlp protocols
+const (
+	OTLPProtocolHTTP = "http/protobuf" // default
+	OTLPProtocolGRPC = "grpc"
+)
+
+const (
+	otlpHTTPURLDefault  = "http://127.0.0.1:4318"
+	otlpGRPCURLDefault  = "http://127.0.0.1:4317"
+	otlpHTTPLogsPath    = "/v1/logs"
+	otlpGRPCExportPath  = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+	otlpScopeName       = "log4go"
+	otlpTraceIDFieldKey = "trace_id"
+	otlpSpanIDFieldKey  = "span_id"
+)
+
+// otlpSeverityNumbers the otel severity numbers of the RFC 5424 levels
+var otlpSeverityNumbers = []int{
+	EMERGENCY: 21, // FATAL
+	ALERT:     19, // ERROR3
+	CRITICAL:  18, // ERROR2
+	ERROR:     17, // ERROR
+	WARNING:   13, // WARN
+	NOTICE:    10, // INFO2
+	INFO:      9,  // INFO
+	DEBUG:     5,  // DEBUG
+}
+
+// otlpGRPCRetryableCodes the retryable grpc status codes of the otlp exporter
+var otlpGRPCRetryableCodes = map[int]bool{
+	1:  true, // CANCELLED
+	4:  true, // DEADLINE_EXCEEDED
+	8:  true, // RESOURCE_EXHAUSTED
+	10: true, // ABORTED
+	11: true, // OUT_OF_RANGE
+	14: true, // UNAVAILABLE
+	15: true, // DATA_LOSS
+}
+
+// OTLPWriterOptions otlp writer options
+type OTLPWriterOptions struct {
+	Enable   bool   `json:"enable" mapstructure:"enable"`
+	Level    string `json:"level" mapstructure:"level"`
+	Protocol string `json:"protocol" mapstructure:"protocol"` // http/protobuf or grpc, default http/protobuf
+	// URL the collector url, http://127.0.0.1:4318 with http/protobuf and http://127.0.0.1:4317 with grpc by default,
+	// the path /v1/logs is appended with http/protobuf if not set, grpc is h2c with http and tls with https
+	URL string `json:"url" mapstructure:"url"`
+
+	ServiceName        string            `json:"service_name" mapstructure:"service_name"`               // the resource service.name, default the program name
+	Hostname           string            `json:"hostname" mapstructure:"hostname"`                       // the resource host.name, default os.Hostname
+	ResourceAttributes map[string]string `json:"resource_attributes" mapstructure:"resource_attributes"` // the extra resource attributes
+
+	// the record fields of the hex trace and span id, set to the log record trace context, default trace_id and span_id
+	TraceIDField string `json:"trace_id_field" mapstructure:"trace_id_field"`
+	SpanIDField  string `json:"span_id_field" mapstructure:"span_id_field"`
+
+	HTTPBatchOptions `mapstructure:",squash"`
+}
+
+// OTLPWriter export the records as the otlp logs
+type OTLPWriter struct {
+	level   int
+	options OTLPWriterOptions
+	batcher *httpBatcher
+
+	grpc      bool
+	gzip      bool   // the grpc message compression
+	url       string // the export url
+	resource  []byte // the encoded Resource
+	scope     []byte // the encoded InstrumentationScope
+	traceKey  string
+	spanKey   string
+	header    http.Header
+	transport http.RoundTripper // optional, the grpc transport
+}
+
+// NewOTLPWriter create new otlp writer
+func NewOTLPWriter(options OTLPWriterOptions) *OTLPWriter {
+	defaultLevel := DEBUG
+	if len(options.Level) > 0 {
+		defaultLevel = getLevelDefault(options.Level, defaultLevel, "")
+	}
+	return &OTLPWriter{
+		level:   defaultLevel,
+		options: options,
+	}
+}
+
+// Init check the options and start the batcher
+func (w *OTLPWriter) Init() (err error) {
+	options := &w.options
+	batchOptions := options.HTTPBatchOptions
+	switch options.Protocol {
+	case "", OTLPProtocolHTTP:
+		if options.URL == "" {
+			options.URL = otlpHTTPURLDefault
+		}
+	case OTLPProtocolGRPC:
+		w.grpc = true
+		if options.URL == "" {
+			options.URL = otlpGRPCURLDefault
+		}
+		// the grpc message is compressed by the writer
+		w.gzip = batchOptions.Compression == HTTPCompressionGzip
+		batchOptions.Compression = ""
+	default:
+		return fmt.Errorf("otlp writer invalid protocol (%s)", options.Protocol)
+	}
+	u, err := url.Parse(options.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("otlp writer invalid url (%s)", options.URL)
+	}
+	switch {
+	case w.grpc:
+		u.Path = otlpGRPCExportPath
+	case u.Path == "" || u.Path == "/":
+		u.Path = otlpHTTPLogsPath
+	}
+	w.url = u.String()
+
+	w.traceKey, w.spanKey = options.TraceIDField, options.SpanIDField
+	if w.traceKey == "" {
+		w.traceKey = otlpTraceIDFieldKey
+	}
+	if w.spanKey == "" {
+		w.spanKey = otlpSpanIDFieldKey
+	}
+	w.initResource()
+
+	w.header = make(http.Header)
+	if w.grpc {
+		w.header.Set("TE", "trailers")
+		if w.gzip {
+			w.header.Set("Grpc-Encoding", "gzip")
+		}
+		if w.transport, err = w.grpcTransport(u.Scheme == "https"); err != nil {
+			return err
+		}
+	}
+
+	if w.batcher, err = newHTTPBatcher("otlp writer", http.MethodPost, batchOptions); err != nil {
+		return err
+	}
+	if w.transport != nil {
+		w.batcher.client.Transport = w.transport
+	}
+	w.batcher.build = w.build
+	w.batcher.check = w.checkPartialSuccess
+	if w.grpc {
+		w.batcher.status = otlpGRPCStatus
+	}
+	w.batcher.start()
+	return nil
+}
+
+// grpcTransport the http2 transport, h2c if not secure
+func (w *OTLPWriter) grpcTransport(secure bool) (http.RoundTripper, error) {
+	if secure {
+		transport := &http2.Transport{}
+		if w.options.TLS.Enable {
+			cfg, err := newTLSConfig(w.options.TLS)
+			if err != nil {
+				return nil, fmt.Errorf("otlp writer %v", err)
+			}
+			transport.TLSClientConfig = cfg
+		}
+		return transport, nil
+	}
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}, nil
+}
+
+// initResource encode the Resource{attributes = 1} and InstrumentationScope{name = 1}
+func (w *OTLPWriter) initResource() {
+	attributes := make(map[string]string, len(w.options.ResourceAttributes)+2)
+	for k, v := range w.options.ResourceAttributes {
+		attributes[k] = v
+	}
+	if w.options.ServiceName != "" {
+		attributes["service.name"] = w.options.ServiceName
+	} else if _, ok := attributes["service.name"]; !ok {
+		attributes["service.name"] = filepath.Base(os.Args[0])
+	}
+	if w.options.Hostname != "" {
+		attributes["host.name"] = w.options.Hostname
+	} else if _, ok := attributes["host.name"]; !ok {
+		attributes["host.name"], _ = os.Hostname()
+	}
+
+	w.resource = nil
+	for _, k := range sortedLabelNames(attributes) {
+		w.resource = appendProtoMessage(w.resource, 1, appendOTLPKeyValue(nil, k, attributes[k]))
+	}
+	w.scope = appendProtoString(nil, 1, otlpScopeName)
+}
+
+func appendProtoFixed64(b []byte, field int, v uint64) []byte {
+	b = appendProtoVarint(b, uint64(field<<3|protoWireFixed64))
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// appendOTLPAnyValue encode the AnyValue{string_value = 1, bool_value = 2, int_value = 3, double_value = 4, bytes_value = 7}
+func appendOTLPAnyValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case string:
+		b = appendProtoVarint(b, uint64(1<<3|protoWireBytes))
+		b = appendProtoVarint(b, uint64(len(v)))
+		return append(b, v...)
+	case bool:
+		value := uint64(0)
+		if v {
+			value = 1
+		}
+		return appendProtoVarint(appendProtoVarint(b, uint64(2<<3|protoWireVarint)), value)
+	case int:
+		return appendProtoVarint(appendProtoVarint(b, uint64(3<<3|protoWireVarint)), uint64(v))
+	case int8:
+		return appendProtoVarint(appendProtoVarint(b, uint64(3<<3|protoWireVarint)), uint64(v))
+	case int16:
+		return appendProtoVarint(appendProtoVarint(b, uint64(3<<3|protoWireVarint)), uint64(v))
+	case int32:
+		return appendProtoVarint(appendProtoVarint(b, uint64(3<<3|protoWireVarint)), uint64(v))
+	case int64:
+		return appendProtoVarint(appendProtoVarint(b, uint64(3<<3|protoWireVarint)), uint64(v))
+	case uint8:
+		return appendProtoVarint(appendProtoVarint(b, uint64(3<<3|protoWireVarint)), uint64(v))
+	case uint16:
+		return appendProtoVarint(appendProtoVarint(b, uint64(3<<3|protoWireVarint)), uint64(v))
+	case uint32:
+		return appendProtoVarint(appendProtoVarint(b, uint64(3<<3|protoWireVarint)), uint64(v))
+	case uint:
+		if uint64(v) <= math.MaxInt64 {
+			return appendProtoVarint(appendProtoVarint(b, uint64(3<<3|protoWireVarint)), uint64(v))
+		}
+	case uint64:
+		if v <= math.MaxInt64 {
+			return appendProtoVarint(appendProtoVarint(b, uint64(3<<3|protoWireVarint)), v)
+		}
+	case float32:
+		return appendProtoFixed64(b, 4, math.Float64bits(float64(v)))
+	case float64:
+		return appendProtoFixed64(b, 4, math.Float64bits(v))
+	case []byte:
+		b = appendProtoVarint(b, uint64(7<<3|protoWireBytes))
+		b = appendProtoVarint(b, uint64(len(v)))
+		return append(b, v...)
+	case error:
+		return appendOTLPAnyValue(b, v.Error())
+	}
+	return appendOTLPAnyValue(b, fmt.Sprint(v))
+}
+
+// appendOTLPKeyValue encode the KeyValue{key = 1, value = 2}
+func appendOTLPKeyValue(b []byte, key string, v interface{}) []byte {
+	b = appendProtoString(b, 1, key)
+	return appendProtoMessage(b, 2, appendOTLPAnyValue(nil, v))
+}
+
+// otlpID decode the hex id of the size, nil if invalid or all zero
+func otlpID(v interface{}, size int) []byte {
+	s, ok := v.(string)
+	if !ok || len(s) != size*2 {
+		return nil
+	}
+	id, err := hex.DecodeString(s)
+	if err != nil || bytes.Equal(id, make([]byte, size)) {
+		return nil
+	}
+	return id
+}
+
+// encode the LogRecord{time_unix_nano = 1, severity_number = 2, severity_text = 3, body = 5, attributes = 6,
+// trace_id = 9, span_id = 10, observed_time_unix_nano = 11}
+func (w *OTLPWriter) encode(r *Record) []byte {
+	now := recordTime(r)
+	b := appendProtoFixed64(nil, 1, uint64(now.UnixNano()))
+	b = appendProtoVarint(appendProtoVarint(b, uint64(2<<3|protoWireVarint)), uint64(otlpSeverityNumbers[r.level]))
+	b = appendProtoString(b, 3, LevelFlags[r.level])
+	b = appendProtoMessage(b, 5, appendOTLPAnyValue(nil, r.msg))
+
+	traceID, spanID := otlpID(r.fields[w.traceKey], 16), otlpID(r.fields[w.spanKey], 8)
+	for _, k := range r.fields.sortedKeys() {
+		if (k == w.traceKey && traceID != nil) || (k == w.spanKey && spanID != nil) {
+			continue
+		}
+		b = appendProtoMessage(b, 6, appendOTLPKeyValue(nil, k, r.fields[k]))
+	}
+	if r.fileName != "" {
+		b = appendProtoMessage(b, 6, appendOTLPKeyValue(nil, "code.filepath", r.fileName))
+		b = appendProtoMessage(b, 6, appendOTLPKeyValue(nil, "code.lineno", r.line))
+	}
+	if funcName := r.function(); funcName != "" {
+		b = appendProtoMessage(b, 6, appendOTLPKeyValue(nil, "code.function", funcName))
+	}
+
+	if traceID != nil {
+		b = appendProtoMessage(b, 9, traceID)
+	}
+	if spanID != nil {
+		b = appendProtoMessage(b, 10, spanID)
+	}
+	return appendProtoFixed64(b, 11, uint64(now.UnixNano()))
+}
+
+// Write encode the record to the log record and add it to the batch
+func (w *OTLPWriter) Write(r *Record) error {
+	if r.level > w.level {
+		return nil
+	}
+	if w.batcher == nil {
+		return errors.New("otlp writer not running")
+	}
+	return w.batcher.add(w.encode(r))
+}
+
+// build the ExportLogsServiceRequest{resource_logs = 1}, ResourceLogs{resource = 1, scope_logs = 2}
+// and ScopeLogs{scope = 1, log_records = 2}, the grpc message is length prefixed
+func (w *OTLPWriter) build(items [][]byte) (*httpPayload, error) {
+	scopeLogs := appendProtoMessage(nil, 1, w.scope)
+	for _, item := range items {
+		scopeLogs = appendProtoMessage(scopeLogs, 2, item)
+	}
+	resourceLogs := appendProtoMessage(nil, 1, w.resource)
+	resourceLogs = appendProtoMessage(resourceLogs, 2, scopeLogs)
+	body := appendProtoMessage(nil, 1, resourceLogs)
+	if !w.grpc {
+		return &httpPayload{url: w.url, body: body, contentType: "application/x-protobuf"}, nil
+	}
+
+	flag := byte(0)
+	if w.gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		flag, body = 1, buf.Bytes()
+	}
+	msg := make([]byte, 5, 5+len(body))
+	msg[0] = flag
+	binary.BigEndian.PutUint32(msg[1:], uint32(len(body)))
+	return &httpPayload{url: w.url, body: append(msg, body...), contentType: "application/grpc", header: w.header}, nil
+}
+
+// otlpGRPCStatus check the grpc-status of the trailers, or the headers if trailers only
+func otlpGRPCStatus(resp *http.Response) (bool, error) {
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return false, fmt.Errorf("invalid grpc-status (%s)", status)
+	}
+	if code == 0 {
+		return false, nil
+	}
+	if m, err := url.PathUnescape(message); err == nil {
+		message = m
+	}
+	return otlpGRPCRetryableCodes[code], fmt.Errorf("grpc status %d: %s", code, message)
+}
+
+// parseProtoField parse the field of the varint or bytes wire type, ok is false if invalid
+func parseProtoField(b []byte) (field int, value uint64, data []byte, rest []byte, ok bool) {
+	tag, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, 0, nil, nil, false
+	}
+	b = b[n:]
+	switch tag & 7 {
+	case protoWireVarint:
+		if value, n = binary.Uvarint(b); n <= 0 {
+			return 0, 0, nil, nil, false
+		}
+		return int(tag >> 3), value, nil, b[n:], true
+	case protoWireBytes:
+		size, n := binary.Uvarint(b)
+		if n <= 0 || uint64(len(b)-n) < size {
+			return 0, 0, nil, nil, false
+		}
+		b = b[n:]
+		return int(tag >> 3), 0, b[:size], b[size:], true
+	case protoWireFixed64:
+		if len(b) < 8 {
+			return 0, 0, nil, nil, false
+		}
+		return int(tag >> 3), binary.LittleEndian.Uint64(b), nil, b[8:], true
+	case protoWireFixed32:
+		if len(b) < 4 {
+			return 0, 0, nil, nil, false
+		}
+		return int(tag >> 3), uint64(binary.LittleEndian.Uint32(b)), nil, b[4:], true
+	}
+	return 0, 0, nil, nil, false
+}
+
+// checkPartialSuccess the ExportLogsServiceResponse{partial_success = 1},
+// ExportLogsPartialSuccess{rejected_log_records = 1, error_message = 2}, the rejected records are not retried
+func (w *OTLPWriter) checkPartialSuccess(items [][]byte, body []byte) ([][]byte, int, error) {
+	if w.grpc {
+		if len(body) < 5 {
+			return nil, 0, nil
+		}
+		body = body[5:]
+	}
+	for len(body) > 0 {
+		field, _, data, rest, ok := parseProtoField(body)
+		if !ok {
+			return nil, 0, nil // ignore the invalid response body
+		}
+		body = rest
+		if field != 1 {
+			continue
+		}
+
+		var rejected uint64
+		var message string
+		for len(data) > 0 {
+			field, value, s, rest, ok := parseProtoField(data)
+			if !ok {
+				break
+			}
+			data = rest
+			switch field {
+			case 1:
+				rejected = value
+			case 2:
+				message = string(s)
+			}
+		}
+		if rejected == 0 && message == "" {
+			return nil, 0, nil
+		}
+		if rejected > uint64(len(items)) {
+			rejected = uint64(len(items))
+		}
+		return nil, int(rejected), fmt.Errorf("partial success %d rejected: %s", rejected, message)
+	}
+	return nil, 0, nil
+}
+
+// Dropped return the number of records dropped by the full queue
+func (w *OTLPWriter) Dropped() int64 {
+	if w.batcher == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&w.batcher.dropped)
+}
+
+// Failed return the number of records failed to export after retries
+func (w *OTLPWriter) Failed() int64 {
+	if w.batcher == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&w.batcher.failed)
+}
+
+// Close export the buffered records within the close timeout
+func (w *OTLPWriter) Close() error {
+	if w.batcher == nil {
+		return nil
+	}
+	return w.batcher.close()
+}
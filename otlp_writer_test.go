@@ -0,0 +1,292 @@
+package log4go
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+type otlpTestField struct {
+	value uint64
+	data  []byte
+}
+
+// otlpFields decode the message fields by number
+func otlpFields(t *testing.T, b []byte) map[int][]otlpTestField {
+	fields := make(map[int][]otlpTestField)
+	for len(b) > 0 {
+		field, value, data, rest, ok := parseProtoField(b)
+		if !ok {
+			t.Fatalf("invalid protobuf %v", b)
+		}
+		fields[field] = append(fields[field], otlpTestField{value: value, data: data})
+		b = rest
+	}
+	return fields
+}
+
+// otlpAnyValue decode the AnyValue
+func otlpAnyValue(t *testing.T, b []byte) interface{} {
+	for field, values := range otlpFields(t, b) {
+		v := values[0]
+		switch field {
+		case 1:
+			return string(v.data)
+		case 2:
+			return v.value == 1
+		case 3:
+			return int64(v.value)
+		case 4:
+			return math.Float64frombits(v.value)
+		case 7:
+			return v.data
+		}
+	}
+	return nil
+}
+
+// otlpAttributes decode the repeated KeyValue
+func otlpAttributes(t *testing.T, kvs []otlpTestField) map[string]interface{} {
+	attributes := make(map[string]interface{}, len(kvs))
+	for _, kv := range kvs {
+		fields := otlpFields(t, kv.data)
+		attributes[string(fields[1][0].data)] = otlpAnyValue(t, fields[2][0].data)
+	}
+	return attributes
+}
+
+// otlpTestRequest the decoded ExportLogsServiceRequest with one resource and scope
+type otlpTestRequest struct {
+	resource map[string]interface{}
+	scope    string
+	records  []map[int][]otlpTestField
+}
+
+func decodeOTLPRequest(t *testing.T, body []byte) *otlpTestRequest {
+	resourceLogs := otlpFields(t, body)[1]
+	if len(resourceLogs) != 1 {
+		t.Fatalf("resource logs got %d", len(resourceLogs))
+	}
+	fields := otlpFields(t, resourceLogs[0].data)
+	req := &otlpTestRequest{resource: otlpAttributes(t, otlpFields(t, fields[1][0].data)[1])}
+	scopeLogs := otlpFields(t, fields[2][0].data)
+	req.scope = string(otlpFields(t, scopeLogs[1][0].data)[1][0].data)
+	for _, record := range scopeLogs[2] {
+		req.records = append(req.records, otlpFields(t, record.data))
+	}
+	return req
+}
+
+func Test_OTLPWriterHTTP(t *testing.T) {
+	var lock sync.Mutex
+	var requests []*otlpTestRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != otlpHTTPLogsPath || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		lock.Lock()
+		requests = append(requests, decodeOTLPRequest(t, body))
+		lock.Unlock()
+		// partial success: 1 rejected
+		partial := appendProtoVarint(appendProtoVarint(nil, 1<<3|protoWireVarint), 1)
+		partial = appendProtoString(partial, 2, "too old")
+		_, _ = w.Write(appendProtoMessage(nil, 1, partial))
+	}))
+	defer server.Close()
+
+	w := NewOTLPWriter(OTLPWriterOptions{
+		URL:                server.URL,
+		ServiceName:        "order",
+		Hostname:           "node-1",
+		ResourceAttributes: map[string]string{"deployment.environment": "prod", "host.name": "ignored"},
+		HTTPBatchOptions:   HTTPBatchOptions{BatchSize: 2, FlushInterval: time.Hour},
+	})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 6, 1, 8, 0, 0, 123, time.UTC)
+	traceID, spanID := "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	records := []*Record{
+		{
+			level: CRITICAL, msg: "otlp", now: now, fileName: "/app/main.go", line: 42, funcName: "main.main",
+			fields: Fields{"trace_id": traceID, "span_id": spanID, "user": "xwi88", "n": 7, "ok": true, "cost": 1.5},
+		},
+		{level: NOTICE, msg: "invalid trace", now: now, fields: Fields{"trace_id": "xyz"}},
+	}
+	for _, r := range records {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(requests) != 1 || len(requests[0].records) != 2 {
+		t.Fatalf("requests got %d", len(requests))
+	}
+	req := requests[0]
+	wantResource := map[string]interface{}{"service.name": "order", "host.name": "node-1", "deployment.environment": "prod"}
+	for k, v := range wantResource {
+		if req.resource[k] != v {
+			t.Errorf("resource %s got %v, want %v", k, req.resource[k], v)
+		}
+	}
+	if req.scope != otlpScopeName {
+		t.Errorf("scope got %s", req.scope)
+	}
+
+	record := req.records[0]
+	if record[1][0].value != uint64(now.UnixNano()) || record[2][0].value != 18 || string(record[3][0].data) != LevelFlagCritical {
+		t.Errorf("record time %d, severity %d %s", record[1][0].value, record[2][0].value, record[3][0].data)
+	}
+	if body := otlpAnyValue(t, record[5][0].data); body != "otlp" {
+		t.Errorf("body got %v", body)
+	}
+	if hex.EncodeToString(record[9][0].data) != traceID || hex.EncodeToString(record[10][0].data) != spanID {
+		t.Errorf("trace context got %x %x", record[9][0].data, record[10][0].data)
+	}
+	attributes := otlpAttributes(t, record[6])
+	wantAttributes := map[string]interface{}{
+		"user": "xwi88", "n": int64(7), "ok": true, "cost": 1.5,
+		"code.filepath": "/app/main.go", "code.lineno": int64(42), "code.function": "main.main",
+	}
+	if len(attributes) != len(wantAttributes) {
+		t.Errorf("attributes got %v", attributes)
+	}
+	for k, v := range wantAttributes {
+		if attributes[k] != v {
+			t.Errorf("attribute %s got %v, want %v", k, attributes[k], v)
+		}
+	}
+
+	// the invalid trace id is kept as the attribute
+	record = req.records[1]
+	if record[2][0].value != 10 || record[9] != nil || otlpAttributes(t, record[6])["trace_id"] != "xyz" {
+		t.Errorf("record got %v", record)
+	}
+	if w.Failed() != 1 {
+		t.Errorf("failed got %d, want 1", w.Failed())
+	}
+}
+
+func Test_OTLPWriterGRPC(t *testing.T) {
+	var lock sync.Mutex
+	var requests []*otlpTestRequest
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != otlpGRPCExportPath || r.Header.Get("Content-Type") != "application/grpc" || r.ProtoMajor != 2 {
+			t.Errorf("unexpected request %s %s %s", r.URL.Path, r.Header.Get("Content-Type"), r.Proto)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if len(body) < 5 || body[0] != 1 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+			t.Errorf("invalid grpc message %v", body)
+			return
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(body[5:]))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		msg, _ := ioutil.ReadAll(zr)
+
+		lock.Lock()
+		requests = append(requests, decodeOTLPRequest(t, msg))
+		n := len(requests)
+		lock.Unlock()
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		_, _ = w.Write(make([]byte, 5)) // the empty response
+		if n == 1 {
+			w.Header().Set("Grpc-Status", "14")
+			w.Header().Set("Grpc-Message", "collector%20unavailable")
+			return
+		}
+		w.Header().Set("Grpc-Status", "0")
+	})
+	server := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer server.Close()
+
+	w := NewOTLPWriter(OTLPWriterOptions{
+		Protocol: OTLPProtocolGRPC,
+		URL:      server.URL,
+		HTTPBatchOptions: HTTPBatchOptions{
+			BatchSize:    1,
+			Compression:  HTTPCompressionGzip,
+			RetryBackoff: 10 * time.Millisecond,
+		},
+	})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(&Record{level: ERROR, msg: "grpc"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(requests) != 2 {
+		t.Fatalf("requests got %d, want 2", len(requests))
+	}
+	if body := otlpAnyValue(t, requests[1].records[0][5][0].data); body != "grpc" {
+		t.Errorf("body got %v", body)
+	}
+	if w.Failed() != 0 {
+		t.Errorf("failed got %d", w.Failed())
+	}
+}
+
+func Test_OTLPWriterOptions(t *testing.T) {
+	for _, options := range []OTLPWriterOptions{
+		{Protocol: "http/json"},
+		{URL: "127.0.0.1:4318"},
+		{URL: "ftp://127.0.0.1:4318"},
+		{HTTPBatchOptions: HTTPBatchOptions{Compression: "zstd"}},
+	} {
+		if err := NewOTLPWriter(options).Init(); err == nil {
+			t.Errorf("options %+v should be invalid", options)
+		}
+	}
+
+	w := NewOTLPWriter(OTLPWriterOptions{URL: "https://otel.example.com/custom/logs"})
+	if err := w.Write(&Record{level: ERROR}); err == nil {
+		t.Error("write before init should fail")
+	}
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if w.url != "https://otel.example.com/custom/logs" {
+		t.Errorf("url got %s", w.url)
+	}
+
+	for _, c := range []struct {
+		status string
+		retry  bool
+		ok     bool
+	}{{"0", false, true}, {"14", true, false}, {"3", false, false}, {"", false, false}} {
+		resp := &http.Response{Header: http.Header{}, Trailer: http.Header{}}
+		resp.Trailer.Set("Grpc-Status", c.status)
+		retry, err := otlpGRPCStatus(resp)
+		if retry != c.retry || (err == nil) != c.ok {
+			t.Errorf("grpc status %s got retry %v, err %v", c.status, retry, err)
+		}
+	}
+}
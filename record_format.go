@@ -0,0 +1,90 @@
+package log4go
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// record formats of the network writers
+const (
+	RecordFormatText   = "text"   // same as the file writer, default
+	RecordFormatJSON   = "json"   // one json object per line
+	RecordFormatLogfmt = "logfmt" // key=value pairs per line
+)
+
+// recordEncoder encode the record to one line with the newline
+type recordEncoder func(r *Record) ([]byte, error)
+
+// newRecordEncoder return the encoder of the format
+func newRecordEncoder(format string) (recordEncoder, error) {
+	switch format {
+	case "", RecordFormatText:
+		return encodeRecordText, nil
+	case RecordFormatJSON:
+		return encodeRecordJSON, nil
+	case RecordFormatLogfmt:
+		return encodeRecordLogfmt, nil
+	}
+	return nil, fmt.Errorf("invalid record format (%s)", format)
+}
+
+// recordTime the created time of the record, now if not set
+func recordTime(r *Record) time.Time {
+	if r.now.IsZero() {
+		return time.Now()
+	}
+	return r.now
+}
+
+func encodeRecordText(r *Record) ([]byte, error) {
+	if r.time == "" {
+		c := *r
+		c.time = recordTime(r).Format(DefaultLayout)
+		return []byte(c.String()), nil
+	}
+	return []byte(r.String()), nil
+}
+
+// recordJSONBody the fields are flatten without overwriting the time key, level, file and message
+func recordJSONBody(r *Record, timeKey string) map[string]interface{} {
+	body := make(map[string]interface{}, 4+len(r.fields))
+	for k, v := range r.fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		body[k] = v
+	}
+	body[timeKey] = recordTime(r).Format(time.RFC3339Nano)
+	body["level"] = LevelFlags[r.level]
+	body["file"] = r.file
+	body["message"] = r.msg
+	return body
+}
+
+func encodeRecordJSON(r *Record) ([]byte, error) {
+	b, err := json.Marshal(recordJSONBody(r, "time"))
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// encodeRecordLogfmt the fields follow time, level, file and msg ordered by key
+func encodeRecordLogfmt(r *Record) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("time=")
+	b.WriteString(recordTime(r).Format(time.RFC3339Nano))
+	b.WriteString(" level=")
+	b.WriteString(LevelFlags[r.level])
+	if r.file != "" {
+		b.WriteString(" file=")
+		b.WriteString(formatFieldValue(r.file))
+	}
+	b.WriteString(" msg=")
+	b.WriteString(formatFieldValue(r.msg))
+	b.WriteString(formatFields(r.fields, nil, nil))
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,75 @@
+package log4go
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_RecordFormat(t *testing.T) {
+	r := &Record{
+		level:  WARNING,
+		file:   "format.go:12",
+		msg:    "record format",
+		now:    time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC),
+		fields: Fields{"user": "xwi88", "err": errors.New("timeout"), "level": "ignored"},
+	}
+
+	encode, _ := newRecordEncoder(RecordFormatText)
+	b, _ := encode(r)
+	if want := "2021/06/01 08:00:00 [WARNING] <format.go:12> record format err=timeout level=ignored user=xwi88\n"; string(b) != want {
+		t.Errorf("text got %q, want %q", b, want)
+	}
+	if r.time != "" {
+		t.Error("text format should not change the record")
+	}
+
+	encode, _ = newRecordEncoder(RecordFormatJSON)
+	b, _ = encode(r)
+	var body map[string]interface{}
+	if err := json.Unmarshal(b, &body); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"time":    "2021-06-01T08:00:00Z",
+		"level":   "WARNING",
+		"file":    "format.go:12",
+		"message": "record format",
+		"user":    "xwi88",
+		"err":     "timeout",
+	}
+	if !reflect.DeepEqual(body, want) || b[len(b)-1] != '\n' {
+		t.Errorf("json got %s", b)
+	}
+
+	encode, _ = newRecordEncoder(RecordFormatLogfmt)
+	b, _ = encode(r)
+	if want := `time=2021-06-01T08:00:00Z level=WARNING file=format.go:12 msg="record format" err=timeout level=ignored user=xwi88` + "\n"; string(b) != want {
+		t.Errorf("logfmt got %q, want %q", b, want)
+	}
+
+	if _, err := newRecordEncoder("xml"); err == nil {
+		t.Error("format xml should be invalid")
+	}
+}
+
+func Test_RecordFunction(t *testing.T) {
+	l := &Logger{records: make(chan *Record, 1), level: DEBUG, layout: DefaultLayout}
+	l.Info("lazy func name")
+	r := <-l.records
+	if r.funcName != "" || r.pc == 0 {
+		t.Fatalf("func name should be resolved lazily, got %q", r.funcName)
+	}
+	if name := r.function(); name != "github.com/xwi88/log4go.Test_RecordFunction" {
+		t.Errorf("func name got %q", name)
+	}
+
+	l.WithFuncName(true)
+	l.Info("func name")
+	r = <-l.records
+	if r.funcName != "github.com/xwi88/log4go.Test_RecordFunction" || r.function() != r.funcName {
+		t.Errorf("func name got %q", r.funcName)
+	}
+}
@@ -0,0 +1,332 @@
+package log4go
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslog transports
+const (
+	SyslogNetworkUDP  = "udp"  // one message per datagram, default
+	SyslogNetworkTCP  = "tcp"  // octet-counting framing, RFC 6587
+	SyslogNetworkTLS  = "tls"  // octet-counting framing over tls, RFC 5425
+	SyslogNetworkUnix = "unix" // local unix datagram socket, default address /dev/log
+)
+
+const (
+	syslogVersion           = 1
+	syslogNilValue          = "-"
+	syslogUnixAddress       = "/dev/log"
+	syslogTimestampLayout   = "2006-01-02T15:04:05.000000Z07:00"
+	syslogStructuredDataID  = "fields@32473" // the example private enterprise number of RFC 5424
+	syslogReconnectDefault  = time.Second
+	syslogBufferSizeDefault = 32 << 10
+)
+
+// syslogFacilities RFC 5424 facility codes
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"ntp":      12,
+	"security": 13,
+	"console":  14,
+	"clock":    15,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// SyslogWriterOptions syslog writer options
+type SyslogWriterOptions struct {
+	Enable bool   `json:"enable" mapstructure:"enable"`
+	Level  string `json:"level" mapstructure:"level"`
+
+	// Network udp, tcp, tls or unix, default udp
+	Network string `json:"network" mapstructure:"network"`
+	// Address host:port, or the socket path with unix, default /dev/log
+	Address string     `json:"address" mapstructure:"address"`
+	TLS     TLSOptions `json:"tls" mapstructure:"tls"` // used with tls
+
+	Facility string `json:"facility" mapstructure:"facility"` // kern, user, daemon, local0 ~ local7..., default user
+	Hostname string `json:"hostname" mapstructure:"hostname"` // default os.Hostname
+	AppName  string `json:"app_name" mapstructure:"app_name"` // default the program name
+	ProcID   string `json:"procid" mapstructure:"procid"`     // default the pid
+	MsgID    string `json:"msgid" mapstructure:"msgid"`       // optional
+
+	// StructuredDataID the SD-ID of the record fields, default fields@32473, the fields are omitted if set to -
+	StructuredDataID string `json:"structured_data_id" mapstructure:"structured_data_id"`
+
+	Timeout           time.Duration `json:"timeout" mapstructure:"timeout"`                       // dial and write timeout, default 5s
+	ReconnectInterval time.Duration `json:"reconnect_interval" mapstructure:"reconnect_interval"` // min interval to redial, default 1s
+	BufferSize        int           `json:"buffer_size" mapstructure:"buffer_size"`               // stream buffer flushed when full, default 32KB
+}
+
+// SyslogWriter RFC 5424 syslog writer
+type SyslogWriter struct {
+	level   int
+	options SyslogWriterOptions
+
+	facility int
+	header   string // HOSTNAME APP-NAME PROCID MSGID
+	sdID     string
+
+	lock   sync.Mutex
+	conn   netConn
+	stream bool         // octet-counting framing and buffered, else one message per datagram
+	buf    bytes.Buffer // framed messages to flush with stream
+}
+
+// NewSyslogWriter create new syslog writer
+func NewSyslogWriter(options SyslogWriterOptions) *SyslogWriter {
+	defaultLevel := DEBUG
+	if len(options.Level) > 0 {
+		defaultLevel = getLevelDefault(options.Level, defaultLevel, "")
+	}
+	return &SyslogWriter{
+		level:   defaultLevel,
+		options: options,
+	}
+}
+
+// Init check the options and connect the syslog server, the writer reconnects if unreachable
+func (w *SyslogWriter) Init() (err error) {
+	options := &w.options
+
+	network := strings.ToLower(options.Network)
+	address := options.Address
+	var tlsConfig *tls.Config
+	switch network {
+	case "", SyslogNetworkUDP:
+		network = SyslogNetworkUDP
+	case SyslogNetworkTCP:
+		w.stream = true
+	case SyslogNetworkTLS:
+		w.stream = true
+		if tlsConfig, err = newTLSConfig(options.TLS); err != nil {
+			return fmt.Errorf("syslog writer %v", err)
+		}
+	case SyslogNetworkUnix:
+		network = "unixgram"
+		if address == "" {
+			address = syslogUnixAddress
+		}
+	default:
+		return fmt.Errorf("syslog writer invalid network (%s)", options.Network)
+	}
+	if address == "" {
+		return fmt.Errorf("syslog writer network %s requires address", network)
+	}
+	interval := options.ReconnectInterval
+	if interval <= 0 {
+		interval = syslogReconnectDefault
+	}
+	w.conn = netConn{
+		network:      network,
+		address:      address,
+		tls:          tlsConfig,
+		dialTimeout:  options.Timeout,
+		writeTimeout: options.Timeout,
+		interval:     interval,
+	}
+
+	w.facility = syslogFacilities["user"]
+	if options.Facility != "" {
+		facility, ok := syslogFacilities[strings.ToLower(options.Facility)]
+		if !ok {
+			return fmt.Errorf("syslog writer invalid facility (%s)", options.Facility)
+		}
+		w.facility = facility
+	}
+
+	hostname := options.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	appName := options.AppName
+	if appName == "" {
+		appName = filepath.Base(os.Args[0])
+	}
+	procID := options.ProcID
+	if procID == "" {
+		procID = strconv.Itoa(os.Getpid())
+	}
+	w.header = strings.Join([]string{
+		syslogHeaderValue(hostname, 255),
+		syslogHeaderValue(appName, 48),
+		syslogHeaderValue(procID, 128),
+		syslogHeaderValue(options.MsgID, 32),
+	}, " ")
+
+	w.sdID = options.StructuredDataID
+	if w.sdID == "" {
+		w.sdID = syslogStructuredDataID
+	} else if w.sdID != syslogNilValue {
+		w.sdID = syslogSDName(w.sdID)
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if err := w.conn.connect(); err != nil {
+		log.Printf("[log4go] syslog writer connect err: %v, will reconnect", err.Error())
+	}
+	return nil
+}
+
+// syslogHeaderValue the header field is printable ascii without space, nil value if empty
+func syslogHeaderValue(s string, max int) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < max; i++ {
+		if c := s[i]; c > ' ' && c < 0x7f {
+			b = append(b, c)
+		}
+	}
+	if len(b) == 0 {
+		return syslogNilValue
+	}
+	return string(b)
+}
+
+// syslogSDName the SD-NAME is printable ascii except = ] " and space, at most 32 chars
+func syslogSDName(s string) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < 32; i++ {
+		if c := s[i]; c > ' ' && c < 0x7f && c != '=' && c != ']' && c != '"' {
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
+
+// syslogParamEscaper escape the param value
+var syslogParamEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// format the RFC 5424 message: <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (w *SyslogWriter) format(r *Record) []byte {
+	now := r.now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>%d %s %s ", w.facility*8+r.level, syslogVersion, now.Format(syslogTimestampLayout), w.header)
+	w.writeStructuredData(&b, r.fields)
+	if r.msg != "" {
+		b.WriteByte(' ')
+		b.WriteString(r.msg)
+	}
+	return b.Bytes()
+}
+
+// writeStructuredData the record fields as one SD-ELEMENT ordered by key
+func (w *SyslogWriter) writeStructuredData(b *bytes.Buffer, fields Fields) {
+	if len(fields) == 0 || w.sdID == syslogNilValue {
+		b.WriteString(syslogNilValue)
+		return
+	}
+	b.WriteByte('[')
+	b.WriteString(w.sdID)
+	for _, k := range fields.sortedKeys() {
+		name := syslogSDName(k)
+		if name == "" {
+			continue
+		}
+		var value string
+		switch v := fields[k].(type) {
+		case string:
+			value = v
+		case error:
+			value = v.Error()
+		default:
+			value = fmt.Sprint(v)
+		}
+		b.WriteByte(' ')
+		b.WriteString(name)
+		b.WriteString(`="`)
+		_, _ = syslogParamEscaper.WriteString(b, value)
+		b.WriteByte('"')
+	}
+	b.WriteByte(']')
+}
+
+// Write send the record, the stream transports are buffered until flushed or the buffer full
+func (w *SyslogWriter) Write(r *Record) error {
+	if r.level > w.level {
+		return nil
+	}
+	msg := w.format(r)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.stream {
+		return w.send(msg)
+	}
+	// octet-counting: MSG-LEN SP SYSLOG-MSG
+	w.buf.WriteString(strconv.Itoa(len(msg)))
+	w.buf.WriteByte(' ')
+	w.buf.Write(msg)
+
+	size := w.options.BufferSize
+	if size <= 0 {
+		size = syslogBufferSizeDefault
+	}
+	if w.buf.Len() >= size {
+		return w.flush()
+	}
+	return nil
+}
+
+// Flush send the buffered messages
+func (w *SyslogWriter) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.flush()
+}
+
+func (w *SyslogWriter) flush() error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	err := w.send(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+// send write the data, reconnect and retry once if failed, the data is discarded if still failed
+func (w *SyslogWriter) send(data []byte) error {
+	if err := w.conn.send(data); err != nil {
+		return fmt.Errorf("syslog writer send %d bytes err: %v", len(data), err)
+	}
+	return nil
+}
+
+// Close flush and close the connection
+func (w *SyslogWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	err := w.flush()
+	w.conn.close()
+	return err
+}
@@ -0,0 +1,281 @@
+package log4go
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSyslogRecord(msg string) *Record {
+	return &Record{
+		level:  ERROR,
+		msg:    msg,
+		now:    time.Date(2021, 6, 1, 8, 0, 0, 123456000, time.UTC),
+		fields: Fields{"user": "xwi88", "err": errors.New(`"quoted" ]`), "key=x": 1},
+	}
+}
+
+// syslogOptions the fixed header options for the tests
+func syslogOptions(network, address string) SyslogWriterOptions {
+	return SyslogWriterOptions{
+		Network:           network,
+		Address:           address,
+		Facility:          "local0",
+		Hostname:          "node-1",
+		AppName:           "log4go",
+		ProcID:            "42",
+		MsgID:             "test",
+		ReconnectInterval: time.Millisecond,
+	}
+}
+
+const syslogTestMessage = `<131>1 2021-06-01T08:00:00.123456Z node-1 log4go 42 test ` +
+	`[fields@32473 err="\"quoted\" \]" keyx="1" user="xwi88"] syslog`
+
+// readOctetCounting read one octet-counting framed message
+func readOctetCounting(t *testing.T, r *bufio.Reader) string {
+	size, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		t.Fatal(err)
+	}
+	return string(msg)
+}
+
+func Test_SyslogWriterFormat(t *testing.T) {
+	w := NewSyslogWriter(syslogOptions(SyslogNetworkUDP, "127.0.0.1:1"))
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if got := string(w.format(newTestSyslogRecord("syslog"))); got != syslogTestMessage {
+		t.Errorf("format got %s, want %s", got, syslogTestMessage)
+	}
+
+	w.header = "- - - -"
+	w.sdID = syslogNilValue
+	r := newTestSyslogRecord("")
+	r.level = DEBUG
+	if got, want := string(w.format(r)), "<135>1 2021-06-01T08:00:00.123456Z - - - - -"; got != want {
+		t.Errorf("format got %s, want %s", got, want)
+	}
+	if got := syslogHeaderValue("app name\n", 48); got != "appname" {
+		t.Errorf("header value got %s", got)
+	}
+}
+
+func Test_SyslogWriterUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w := NewSyslogWriter(syslogOptions(SyslogNetworkUDP, conn.LocalAddr().String()))
+	w.level = ERROR
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Write(&Record{level: INFO, msg: "filtered"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(newTestSyslogRecord("syslog")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != syslogTestMessage {
+		t.Errorf("udp got %s, want %s", got, syslogTestMessage)
+	}
+}
+
+func Test_SyslogWriterUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go-syslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "log")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w := NewSyslogWriter(syslogOptions(SyslogNetworkUnix, addr))
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Write(newTestSyslogRecord("syslog")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != syslogTestMessage {
+		t.Errorf("unix got %s, want %s", got, syslogTestMessage)
+	}
+}
+
+func Test_SyslogWriterTCPReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conns := make(chan net.Conn, 8)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				close(conns)
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	w := NewSyslogWriter(syslogOptions(SyslogNetworkTCP, ln.Addr().String()))
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for _, msg := range []string{"syslog", "syslog"} {
+		if err := w.Write(newTestSyslogRecord(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := <-conns
+	r := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		if got := readOctetCounting(t, r); got != syslogTestMessage {
+			t.Errorf("tcp got %s, want %s", got, syslogTestMessage)
+		}
+	}
+
+	// the server closes the connection, the writer reconnects
+	conn.Close()
+	var reconnected net.Conn
+	deadline := time.Now().Add(5 * time.Second)
+	for reconnected == nil && time.Now().Before(deadline) {
+		_ = w.Write(newTestSyslogRecord("reconnected"))
+		_ = w.Flush()
+		select {
+		case reconnected = <-conns:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if reconnected == nil {
+		t.Fatal("the writer should reconnect")
+	}
+	defer reconnected.Close()
+	if got := readOctetCounting(t, bufio.NewReader(reconnected)); !strings.HasSuffix(got, "] reconnected") {
+		t.Errorf("tcp reconnected got %s", got)
+	}
+}
+
+func Test_SyslogWriterTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log4go-syslog-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := generateTestCert(t, dir)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	options := syslogOptions(SyslogNetworkTLS, ln.Addr().String())
+	options.TLS = TLSOptions{Enable: true, CAFile: certFile, ServerName: "localhost"}
+	w := NewSyslogWriter(options)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := w.Init(); err != nil {
+			t.Error(err)
+			return
+		}
+		if err := w.Write(newTestSyslogRecord("syslog")); err != nil {
+			t.Error(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if got := readOctetCounting(t, bufio.NewReader(conn)); got != syslogTestMessage {
+		t.Errorf("tls got %s, want %s", got, syslogTestMessage)
+	}
+	<-done
+}
+
+func Test_SyslogWriterOptions(t *testing.T) {
+	for _, options := range []SyslogWriterOptions{
+		{Network: "http", Address: "127.0.0.1:514"},
+		{Network: SyslogNetworkTCP},
+		{Address: "127.0.0.1:514", Facility: "local8"},
+		{Network: SyslogNetworkTLS, Address: "127.0.0.1:514", TLS: TLSOptions{CertFile: "cert.pem"}},
+	} {
+		if err := NewSyslogWriter(options).Init(); err == nil {
+			t.Errorf("options %+v should be invalid", options)
+		}
+	}
+
+	// the writer starts even if the server is unreachable
+	w := NewSyslogWriter(SyslogWriterOptions{Network: SyslogNetworkTCP, Address: "127.0.0.1:1"})
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(newTestSyslogRecord("syslog")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err == nil {
+		t.Error("close should fail with the unreachable server")
+	}
+	if w.facility != 1 || !strings.HasSuffix(w.header, " "+strconv.Itoa(os.Getpid())+" -") {
+		t.Errorf("unexpected defaults: facility %d, header %s", w.facility, w.header)
+	}
+}
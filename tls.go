@@ -0,0 +1,51 @@
+package log4go
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSOptions tls options for the network writers
+type TLSOptions struct {
+	Enable             bool   `json:"enable" mapstructure:"enable"`
+	CAFile             string `json:"ca_file" mapstructure:"ca_file"`                           // optional, use system CAs if empty
+	CertFile           string `json:"cert_file" mapstructure:"cert_file"`                       // optional, client cert
+	KeyFile            string `json:"key_file" mapstructure:"key_file"`                         // optional, client key
+	ServerName         string `json:"server_name" mapstructure:"server_name"`                   // optional, verify the server name
+	InsecureSkipVerify bool   `json:"insecure_skip_verify" mapstructure:"insecure_skip_verify"` // skip verify the server cert
+}
+
+// newTLSConfig build the tls config by options
+func newTLSConfig(options TLSOptions) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         options.ServerName,
+		InsecureSkipVerify: options.InsecureSkipVerify,
+	}
+
+	if options.CAFile != "" {
+		ca, err := ioutil.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls read ca_file err: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("tls ca_file (%s) has no valid cert", options.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if options.CertFile != "" || options.KeyFile != "" {
+		if options.CertFile == "" || options.KeyFile == "" {
+			return nil, errors.New("tls cert_file and key_file should be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls load cert_file and key_file err: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}